@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/e1z0/switch-ssh/switchssh"
+	"golang.org/x/term"
+)
+
+// reads a secret from the terminal without echo, or a line from stdin when it is not a terminal
+func readSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(secret), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// returns the master passphrase of the credential store from the environment or the terminal,
+// a new store asks for it twice
+func storePassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(switchssh.CredentialPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	passphrase, err := readSecret("Credential store passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("empty passphrase")
+	}
+	if confirm {
+		again, err := readSecret("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+// opens the credential store, a missing file gives an empty store when create is set
+func openCredentialStore(filename string, create bool) (*switchssh.CredentialStore, string, error) {
+	if _, err := os.Stat(filename); os.IsNotExist(err) && create {
+		passphrase, err := storePassphrase(true)
+		if err != nil {
+			return nil, "", err
+		}
+		return switchssh.NewCredentialStore(), passphrase, nil
+	}
+	passphrase, err := storePassphrase(false)
+	if err != nil {
+		return nil, "", err
+	}
+	store, err := switchssh.LoadCredentialStore(filename, passphrase)
+	return store, passphrase, err
+}
+
+// cred-set, cred-list and cred-delete modes managing the profiles of the credential store
+func credentialMode(mode string, filename string, profile string, cred switchssh.Credentials) error {
+	store, passphrase, err := openCredentialStore(filename, mode == "cred-set")
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case "cred-list":
+		for _, name := range store.Names() {
+			cred, _ := store.Get(name)
+			snmp := "-"
+			if cred.SNMP != nil && cred.SNMP.User != "" {
+				snmp = "v3:" + cred.SNMP.User
+			} else if cred.SNMP != nil {
+				snmp = "v2c"
+			}
+			fmt.Printf("%s\tuser=%s key=%s agent=%t enable-secret=%t snmp=%s\n", name, cred.User, cred.KeyFile, cred.UseAgent, cred.EnableSecret != "", snmp)
+		}
+		return nil
+	case "cred-set":
+		if profile == "" || (cred.User == "" && cred.SNMP == nil) {
+			return errors.New("cred-set needs -profile and -user, -snmp-community or -snmp-user")
+		}
+		if cred.User != "" && cred.Password == "" && cred.KeyFile == "" && !cred.UseAgent {
+			if cred.Password, err = readSecret(fmt.Sprintf("Password of %s for profile %s: ", cred.User, profile)); err != nil {
+				return err
+			}
+		}
+		store.Set(profile, cred)
+	case "cred-delete":
+		if !store.Delete(profile) {
+			return fmt.Errorf("no profile %s", profile)
+		}
+	default:
+		return fmt.Errorf("unknown mode %s", mode)
+	}
+	if err := store.Save(filename, passphrase); err != nil {
+		return err
+	}
+	fmt.Printf("Credential store %s saved\n", filename)
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/e1z0/switch-ssh/switchssh"
+)
+
+// category of failures that are not one of failureKinds, and exit code of errors without a more specific one
+const (
+	failureOther = "other"
+	exitFailure  = 1
+	// a -mass run where hosts failed for different reasons
+	exitMixedFailures = 2
+)
+
+// kinds of failures counted in the run summary and the exit code they give, checked in order
+var failureKinds = []struct {
+	err      error
+	category string
+	exitCode int
+}{
+	{switchssh.ErrAuthFailed, "authentication", 3},
+	{switchssh.ErrHostKey, "host key", 4},
+	{switchssh.ErrUnreachable, "unreachable", 5},
+	{switchssh.ErrConnectTimeout, "connect timeout", 6},
+	{switchssh.ErrNoShell, "shell refused", 7},
+	{switchssh.ErrPromptNotFound, "prompt not found", 8},
+	{switchssh.ErrEnableFailed, "privileged mode", 9},
+	{switchssh.ErrCommandRejected, "command rejected", 10},
+	{switchssh.ErrOutputTruncated, "truncated output", 11},
+	{context.DeadlineExceeded, "host timeout", 12},
+	{context.Canceled, "interrupted", 130},
+}
+
+// returns the summary category of the error
+func failureCategory(err error) string {
+	for _, kind := range failureKinds {
+		if errors.Is(err, kind.err) {
+			return kind.category
+		}
+	}
+	return failureOther
+}
+
+// returns the exit code of a single host mode that failed with the error
+func exitCode(err error) int {
+	for _, kind := range failureKinds {
+		if errors.Is(err, kind.err) {
+			return kind.exitCode
+		}
+	}
+	return exitFailure
+}
+
+// returns the exit code of the category
+func categoryExitCode(category string) int {
+	for _, kind := range failureKinds {
+		if kind.category == category {
+			return kind.exitCode
+		}
+	}
+	return exitFailure
+}
+
+// prints how many hosts succeeded and failed, by failure category, and returns the exit code of the run:
+// 0 when all hosts succeeded, the code of the category when all failures are alike, exitMixedFailures otherwise
+func printSummary(results []massResult) int {
+	counts := map[string]int{}
+	ok, skipped := 0, 0
+	for _, result := range results {
+		switch {
+		case !result.done:
+			skipped++
+		case result.failure != "":
+			counts[result.category]++
+		default:
+			ok++
+		}
+	}
+	fmt.Printf("Summary: %d hosts, %d ok", len(results), ok)
+	code := 0
+	categories := []string{}
+	for _, kind := range failureKinds {
+		categories = append(categories, kind.category)
+	}
+	for _, category := range append(categories, failureOther) {
+		if counts[category] == 0 {
+			continue
+		}
+		fmt.Printf(", %d %s failures", counts[category], category)
+		if code == 0 {
+			code = categoryExitCode(category)
+		} else {
+			code = exitMixedFailures
+		}
+	}
+	if skipped > 0 {
+		fmt.Printf(", %d not processed", skipped)
+		if code == 0 {
+			code = categoryExitCode("interrupted")
+		}
+	}
+	fmt.Println()
+	return code
+}
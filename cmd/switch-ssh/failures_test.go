@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/e1z0/switch-ssh/switchssh"
+)
+
+func TestExitCode(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	timeout := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	for _, test := range []struct {
+		name     string
+		err      error
+		category string
+		code     int
+	}{
+		{"authentication", fmt.Errorf("sw1: %w", &switchssh.AuthError{Address: "10.0.0.1:22", Tried: []string{"admin"}, Err: errors.New("ssh: unable to authenticate")}),
+			"authentication", 3},
+		{"host key", &switchssh.HostKeyChangedError{Host: "10.0.0.1:22"}, "host key", 4},
+		{"connection refused", fmt.Errorf("sw1: %w", fmt.Errorf("%w: %w", switchssh.ErrUnreachable, refused)), "unreachable", 5},
+		{"connect timeout", fmt.Errorf("%w: %w", switchssh.ErrConnectTimeout, timeout), "connect timeout", 6},
+		// Not classified by the library, the network errors alone give no specific code
+		{"bare net.OpError", refused, failureOther, exitFailure},
+		{"bare timeout", timeout, failureOther, exitFailure},
+		{"command rejected", fmt.Errorf("sw1: %w", switchssh.CommandResult{Command: "show clok", Failed: true}.Err()), "command rejected", 10},
+		{"enable", fmt.Errorf("%w: %w", switchssh.ErrEnableFailed, errors.New("% Access denied")), "privileged mode", 9},
+		{"host timeout", fmt.Errorf("reading MAC table: %w", context.DeadlineExceeded), "host timeout", 12},
+		{"interrupted", fmt.Errorf("sw1: %w", context.Canceled), "interrupted", 130},
+		// Checked in order: the first kind in the chain of an error of several kinds wins
+		{"authentication timeout", fmt.Errorf("%w: %w", switchssh.ErrAuthFailed, context.DeadlineExceeded), "authentication", 3},
+		{"other", errors.New("unknown OS"), failureOther, exitFailure},
+	} {
+		if category := failureCategory(test.err); category != test.category {
+			t.Errorf("%s: category %q, expected %q", test.name, category, test.category)
+		}
+		if code := exitCode(test.err); code != test.code {
+			t.Errorf("%s: exit code %d, expected %d", test.name, code, test.code)
+		}
+		if code := categoryExitCode(test.category); code != test.code {
+			t.Errorf("%s: exit code of %q %d, expected %d", test.name, test.category, code, test.code)
+		}
+	}
+}
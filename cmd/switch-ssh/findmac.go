@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/e1z0/switch-ssh/switchssh"
+)
+
+// failure of a device whose LLDP neighbors could not be read
+const lldpFailure = "MAC table not searched, cannot read the LLDP neighbors"
+
+// reads the MAC tables and LLDP neighbors of all devices concurrently and prints where the searched MAC addresses
+// are connected: the edge port first, then the other ports they were seen on. The MAC tables are recorded in the
+// history database. Devices whose LLDP neighbors could not be read are left out of the search, as their uplinks
+// would look like edge ports. Returns the exit code of the run.
+func findMacMode(ctx context.Context, client *switchssh.Client, hosts []string, targets []switchssh.Target, options switchssh.PoolOptions, queries []string, maxEdgeMACs int, format string, historyFile string) int {
+	if len(queries) == 0 {
+		fmt.Println("-macs is required: the MAC addresses or OUI prefixes to look for")
+		return exitFailure
+	}
+	for _, query := range queries {
+		if _, err := switchssh.ParseMACQuery(query); err != nil {
+			fmt.Printf("Invalid -macs: %s\n", err)
+			return exitFailure
+		}
+	}
+	results := make([]massResult, len(targets))
+	tables := make([]switchssh.DeviceMacTable, len(targets))
+	lldpFailed := make([]bool, len(targets))
+	err := client.RunPool(ctx, targets, options, func(ctx context.Context, i int, t switchssh.Target) {
+		h := hosts[i]
+		results[i].done = true
+		brand, err := macTargetBrand(ctx, client, t)
+		if err != nil {
+			results[i].failErr(h, "Failed detect brand", err)
+			return
+		}
+		if brand == "" {
+			results[i].fail(failureOther, fmt.Sprintf("Detected brand string is empty on %s\n", h))
+			return
+		}
+		entries, err := client.MacTableContext(ctx, t)
+		if err != nil {
+			results[i].failErr(h, "Cannot read the mac address table", err)
+			return
+		}
+		tables[i] = switchssh.DeviceMacTable{Host: h, OS: brand, Entries: entries}
+		// devices without LLDP (or read over SNMP) are judged by the number of MAC addresses per port only
+		lldp := ""
+		if t.Transport != switchssh.TransportSNMP {
+			lldp, err = client.GetContext(ctx, t, switchssh.GetterLLDPNeighbors)
+		}
+		if err != nil && !errors.Is(err, switchssh.ErrNotSupported) && !errors.Is(err, switchssh.ErrCommandRejected) {
+			lldpFailed[i] = true
+			results[i].failErr(h, lldpFailure, err)
+			return
+		}
+		if lldp == "" {
+			return
+		}
+		interfaces := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			interfaces = append(interfaces, entry.Interface)
+		}
+		// OSes without lldp-format in devices.json are judged like devices without LLDP
+		tables[i].LLDPPorts, err = client.LLDPInterfacesOf(brand, lldp, interfaces)
+		if err != nil && !errors.Is(err, switchssh.ErrNotSupported) {
+			lldpFailed[i] = true
+			results[i].failErr(h, lldpFailure, err)
+		}
+	})
+	if err != nil {
+		fmt.Println("Interrupted, skipping the remaining hosts")
+	}
+	for _, result := range results {
+		if result.failure != "" {
+			fmt.Print(result.failure)
+		}
+	}
+	recordMacHistory(historyFile, tables, targets)
+	located := make([]switchssh.DeviceMacTable, 0, len(tables))
+	for i, table := range tables {
+		if !lldpFailed[i] {
+			located = append(located, table)
+		}
+	}
+	found, _ := switchssh.LocateMACs(located, queries, maxEdgeMACs)
+	if format == macOutputJSON {
+		data, _ := json.MarshalIndent(found, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printMacLocations(queries, found)
+	}
+	return printSummary(results)
+}
+
+// prints the most likely location of each MAC address found, followed by the other ports it was seen on
+func printMacLocations(queries []string, found [][]switchssh.MacLocation) {
+	seen := make(map[string]bool)
+	for _, locations := range found {
+		seen[locations[0].Query] = true
+		best := locations[0]
+		if best.Uplink == "" {
+			fmt.Printf("%s: %s port %s vlan %d (%d MAC addresses on the port)\n", best.MAC, best.Host, best.Interface, best.VLAN, best.PortMACs)
+		} else {
+			fmt.Printf("%s: no edge port found, closest %s port %s vlan %d (uplink: %s)\n", best.MAC, best.Host, best.Interface, best.VLAN, best.Uplink)
+		}
+		for _, other := range locations[1:] {
+			kind := "edge"
+			if other.Uplink != "" {
+				kind = "uplink: " + other.Uplink
+			}
+			fmt.Printf("    also seen on %s port %s vlan %d (%s)\n", other.Host, other.Interface, other.VLAN, kind)
+		}
+	}
+	for _, query := range queries {
+		if !seen[query] {
+			fmt.Printf("%s: not found\n", strings.TrimSpace(query))
+		}
+	}
+}
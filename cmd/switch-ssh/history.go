@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/e1z0/switch-ssh/switchssh"
+)
+
+// layouts accepted by -since and -until, in local time
+var historyTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// parses -since and -until: a date, a date and time, or a duration back from now (48h, 7d).
+// A date alone given as the end of the range covers the whole day.
+func parseHistoryTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	for _, layout := range historyTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			if end && layout == "2006-01-02" {
+				t = t.AddDate(0, 0, 1).Add(-time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (2006-01-02, 2006-01-02 15:04 or a duration such as 48h or 7d)", value)
+}
+
+// records the MAC tables read by a run in the history database, tables without a host are skipped.
+// Failures are reported but do not fail the run.
+func recordMacHistory(filename string, tables []switchssh.DeviceMacTable, targets []switchssh.Target) {
+	if filename == "" {
+		return
+	}
+	history, err := switchssh.OpenMacHistory(filename)
+	if err != nil {
+		fmt.Printf("Unable to open the MAC history %s: %s\n", filename, err)
+		return
+	}
+	defer history.Close()
+	now := time.Now()
+	hosts, entries := 0, 0
+	for i, table := range tables {
+		if table.Host == "" {
+			continue
+		}
+		address, _, err := net.SplitHostPort(targets[i].Address)
+		if err != nil {
+			address = targets[i].Address
+		}
+		if err := history.Record(table.Host, address, table.OS, table.Entries, now); err != nil {
+			fmt.Printf("Unable to record the MAC table of %s in %s: %s\n", table.Host, filename, err)
+			continue
+		}
+		hosts++
+		entries += len(table.Entries)
+	}
+	fmt.Printf("MAC history: %d entries of %d hosts recorded in %s\n", entries, hosts, filename)
+}
+
+// prints sightings as aligned columns
+func printSightings(sightings []switchssh.MacSighting) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "MAC Address\tSwitch\tInterface\tVLAN\tFirst seen\tLast seen")
+	for _, s := range sightings {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%s\t%s\n", s.MAC, s.Switch, s.Interface, s.VLAN, s.FirstSeen.Format("2006-01-02 15:04"), s.LastSeen.Format("2006-01-02 15:04"))
+	}
+	writer.Flush()
+}
+
+// history-seen, history-moves and history-port modes querying the MAC history database
+func historyMode(mode string, filename string, macs []string, host string, port string, since string, until string, format string) error {
+	if filename == "" {
+		return errors.New("-history is empty")
+	}
+	if _, err := os.Stat(filename); err != nil {
+		return fmt.Errorf("no MAC history: %w", err)
+	}
+	sinceTime, err := parseHistoryTime(since, false)
+	if err != nil {
+		return fmt.Errorf("-since: %w", err)
+	}
+	untilTime, err := parseHistoryTime(until, true)
+	if err != nil {
+		return fmt.Errorf("-until: %w", err)
+	}
+	history, err := switchssh.OpenMacHistory(filename)
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+
+	var result interface{}
+	switch mode {
+	case "history-seen":
+		if len(macs) == 0 {
+			return errors.New("history-seen needs -macs")
+		}
+		sightings := []switchssh.MacSighting{}
+		for _, mac := range macs {
+			found, err := history.Sightings(mac, sinceTime, untilTime)
+			if err != nil {
+				return err
+			}
+			if len(found) == 0 && format != macOutputJSON {
+				fmt.Printf("%s: never seen\n", mac)
+			}
+			sightings = append(sightings, found...)
+		}
+		result = sightings
+	case "history-moves":
+		moves, err := history.Moves(sinceTime)
+		if err != nil {
+			return err
+		}
+		if format != macOutputJSON {
+			for _, move := range moves {
+				fmt.Printf("%s moved on %s:\n", move[0].MAC, move[0].Switch)
+				printSightings(move)
+				fmt.Println()
+			}
+			fmt.Printf("%d MAC addresses moved\n", len(moves))
+			return nil
+		}
+		result = moves
+	case "history-port":
+		if host == "" || port == "" {
+			return errors.New("history-port needs -host and -interface")
+		}
+		if result, err = history.PortHistory(host, port, sinceTime, untilTime); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown mode %s", mode)
+	}
+	if format == macOutputJSON {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if sightings := result.([]switchssh.MacSighting); len(sightings) > 0 {
+		printSightings(sightings)
+	} else if mode == "history-port" {
+		fmt.Printf("No MAC addresses seen on %s %s\n", host, port)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/e1z0/switch-ssh/switchssh"
+)
+
+// Output formats of -mode mac
+const (
+	macOutputText = "text"
+	macOutputJSON = "json"
+	macOutputCSV  = "csv"
+)
+
+// columns of the CSV output of -mode mac
+var macCSVHeader = []string{"mac", "vlan", "interface", "type", "age"}
+
+// formats the parsed MAC table as JSON, CSV or aligned text columns (for tables read over SNMP, which have
+// no device output to print), an empty age column means the device does not report it
+func formatMacTable(format string, entries []switchssh.MacEntry) (string, error) {
+	switch format {
+	case macOutputText:
+		var buffer bytes.Buffer
+		writer := tabwriter.NewWriter(&buffer, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(writer, "MAC Address\tVLAN\tInterface\tType")
+		for _, entry := range entries {
+			fmt.Fprintf(writer, "%s\t%d\t%s\t%s\n", entry.MAC, entry.VLAN, entry.Interface, entry.Type)
+		}
+		writer.Flush()
+		return buffer.String(), nil
+	case macOutputJSON:
+		data, err := json.MarshalIndent(entries, "", "  ")
+		return string(data) + "\n", err
+	case macOutputCSV:
+		var buffer bytes.Buffer
+		writer := csv.NewWriter(&buffer)
+		writer.Write(macCSVHeader)
+		for _, entry := range entries {
+			age := ""
+			if entry.Age != nil {
+				age = strconv.Itoa(*entry.Age)
+			}
+			writer.Write([]string{entry.MAC, strconv.Itoa(entry.VLAN), entry.Interface, entry.Type, age})
+		}
+		writer.Flush()
+		return buffer.String(), writer.Error()
+	}
+	return "", fmt.Errorf("unknown format %q (text, json or csv)", format)
+}
+
+// detects the OS of the target for the MAC table modes. The MAC table of SNMP targets does not depend on it:
+// those not detected over SNMP are named "snmp".
+func macTargetBrand(ctx context.Context, client *switchssh.Client, target switchssh.Target) (string, error) {
+	brand, err := client.GetSSHBrandContext(ctx, target)
+	if err == nil && brand == "" && target.Transport == switchssh.TransportSNMP {
+		brand = switchssh.TransportSNMP
+	}
+	return brand, err
+}
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/e1z0/switch-ssh/switchssh"
+)
+
+var ver = "0.1"
+
+// parses a switches.txt line: "host user password [key=file] [key-pass=passphrase] [agent] [kbd-interactive] [jump=chain] [transport=ssh|telnet|auto|snmp] [enable=secret] [community=snmp-community]",
+// a password of "-" means no password, options not given on the line are taken from defaults,
+// jump hosts without own credentials use jumpCred, or the device credentials when jumpCred has no user
+func parseSwitchLine(line string, port int, defaults switchssh.Target, jumpCred switchssh.Credentials) (string, switchssh.Target, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return "", defaults, errors.New("expected at least host, user and password")
+	}
+	target := defaults
+	target.Address = fmt.Sprintf("%s:%d", fields[0], port)
+	cred := &target.Credentials
+	cred.User = fields[1]
+	cred.Password = fields[2]
+	if cred.Password == "-" {
+		cred.Password = ""
+	}
+	jump := ""
+	for _, option := range fields[3:] {
+		name, value, _ := strings.Cut(option, "=")
+		switch name {
+		case "key":
+			cred.KeyFile = value
+		case "key-pass":
+			cred.KeyPassphrase = value
+		case "agent":
+			cred.UseAgent = true
+		case "kbd-interactive":
+			cred.KeyboardInteractive = true
+		case "jump":
+			jump = value
+		case "enable":
+			cred.EnableSecret = value
+		case "community":
+			cred.SNMP = &switchssh.SNMPCredentials{Community: value}
+		case "transport":
+			if value != switchssh.TransportSSH && value != switchssh.TransportTelnet && value != switchssh.TransportAuto && value != switchssh.TransportSNMP {
+				return "", defaults, fmt.Errorf("unknown transport %s", value)
+			}
+			target.Transport = value
+		default:
+			return "", defaults, fmt.Errorf("unknown option %s", option)
+		}
+	}
+	if jump != "" {
+		if jumpCred.User == "" {
+			jumpCred = target.Credentials
+		}
+		hops, err := switchssh.ParseJumpHosts(jump, jumpCred)
+		if err != nil {
+			return "", defaults, err
+		}
+		target.JumpHosts = hops
+	}
+	return fields[0], target, nil
+}
+
+// reads switches.txt, corrupt lines are reported and skipped
+func readSwitches(filename string, port int, defaults switchssh.Target, jumpCred switchssh.Credentials) ([]string, []switchssh.Target, error) {
+	inFile, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer inFile.Close()
+	hosts := []string{}
+	targets := []switchssh.Target{}
+	scanner := bufio.NewScanner(inFile)
+	for scanner.Scan() {
+		line := scanner.Text()
+		h, t, err := parseSwitchLine(line, port, defaults, jumpCred)
+		if err != nil {
+			fmt.Printf("Corrupt line: %s (%s)\n", line, err)
+			continue
+		}
+		hosts = append(hosts, h)
+		targets = append(targets, t)
+	}
+	return hosts, targets, scanner.Err()
+}
+
+// reads the devices of a YAML, JSON or CSV inventory selected by the group and hostname filters,
+// a .txt file is read as the legacy switches.txt format which does not support the filters
+func readInventory(filename string, store *switchssh.CredentialStore, port int, defaults switchssh.Target, jumpCred switchssh.Credentials, groups []string, limit []string) ([]string, []switchssh.Target, error) {
+	if strings.EqualFold(filepath.Ext(filename), ".txt") {
+		if len(groups) > 0 || len(limit) > 0 {
+			return nil, nil, errors.New("-group and -limit need a YAML, JSON or CSV inventory")
+		}
+		return readSwitches(filename, port, defaults, jumpCred)
+	}
+	inventory, err := switchssh.LoadInventory(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	inventory.Store = store
+	// -port applies to hosts the inventory sets no port for
+	if inventory.Defaults.Port == 0 {
+		inventory.Defaults.Port = port
+	}
+	selected, err := inventory.Filter(groups, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	hosts := []string{}
+	targets := []switchssh.Target{}
+	for _, host := range selected {
+		t, err := inventory.Target(host, defaults)
+		if err != nil {
+			return nil, nil, err
+		}
+		hosts = append(hosts, host.Hostname)
+		targets = append(targets, t)
+	}
+	return hosts, targets, nil
+}
+
+// splits a comma separated flag value, an empty value gives an empty list
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// outcome of a single host of a -mass run
+type massResult struct {
+	done     bool
+	brand    string
+	output   string
+	macs     []switchssh.MacEntry
+	failure  string
+	category string
+}
+
+// records a failed host in the result
+func (this *massResult) fail(category string, failure string) {
+	this.category = category
+	this.failure = failure
+}
+
+// records a host that failed with an error, classifying it for the run summary
+func (this *massResult) failErr(host string, what string, err error) {
+	this.fail(failureCategory(err), describeFailure(host, what, err))
+}
+
+// describes why a host failed for fail.log, host key and authentication problems are reported explicitly
+func describeFailure(host string, what string, err error) string {
+	var changed *switchssh.HostKeyChangedError
+	var unknown *switchssh.HostKeyUnknownError
+	var auth *switchssh.AuthError
+	switch {
+	case errors.As(err, &changed):
+		return fmt.Sprintf("HOST KEY CHANGED on %s: presented %s, recorded at %v\n", host, changed.Fingerprint, changed.Known)
+	case errors.As(err, &unknown):
+		return fmt.Sprintf("Unknown host key on %s: %s\n", host, unknown.Fingerprint)
+	case errors.As(err, &auth):
+		return fmt.Sprintf("Authentication failed on %s: refused %s\n", host, strings.Join(auth.Tried, ", "))
+	}
+	return fmt.Sprintf("%s on %s: %s\n", what, host, err)
+}
+
+// prints the OS candidates of a detection, best first, with the signatures they matched
+func printCandidates(candidates []switchssh.Candidate) {
+	for i, candidate := range candidates {
+		fmt.Printf("%d. %s: confidence %.0f%%, score %d\n", i+1, candidate.Name, candidate.Confidence*100, candidate.Score)
+		for _, matched := range candidate.Matched {
+			fmt.Printf("     %s\n", matched)
+		}
+	}
+}
+
+func SaveFile(filename string, content string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Printf("Error creating file: %s\n", err)
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(content)
+	if err != nil {
+		fmt.Printf("Error writing to file: %s\n", err)
+		return err
+	}
+	fmt.Println("Data written to file successfully.")
+	return nil
+}
+
+func main() {
+	client := switchssh.NewClient()
+	defer client.Close()
+	client.UnknownModelsFile = "unknown_models/data.txt"
+	// Ctrl-C aborts the device being processed and stops mass jobs
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	mode := flag.String("mode", "detect", "The mode to run the application (e.g., detect, run, testmodel, mac, findmac, validate, history-seen, history-moves, history-port")
+	host := flag.String("host", "", "Hostname to connect to")
+	port := flag.Int("port", 22, "A ssh port number")
+	user := flag.String("user", "", "Username")
+	pass := flag.String("pass", "", "Password")
+	model := flag.String("model", "", "Device Model or version")
+	version := flag.String("version", "", "Device version")
+	sysObjectID := flag.String("sysobjectid", "", "-mode testmodel: SNMP sysObjectID of the device, e.g. 1.3.6.1.4.1.9.1.1208")
+	debug := flag.Bool("debug", false, "Aggresive debugging on")
+	mass := flag.Bool("mass", false, "Mass do")
+	dump := flag.String("dump", "", "Dump command, example.: dump running-config")
+	save := flag.String("save", "", "show command, for example running-config")
+	getter := flag.String("get", "", "Getter of the device OS to run: "+strings.Join(switchssh.GetterNames, ", "))
+	execCmds := flag.String("exec", "", "Commands separated by ';' to run, results are printed as JSON, example.: \"show version;show clock\"")
+	cmdTimeout := flag.Duration("cmd-timeout", client.CommandTimeout, "Maximum time to wait for the prompt after each command")
+	keyFile := flag.String("key", "", "Private key file for public-key authentication")
+	keyPass := flag.String("key-pass", "", "Passphrase of the private key")
+	useAgent := flag.Bool("agent", false, "Authenticate with the keys of the ssh-agent (SSH_AUTH_SOCK)")
+	enableSecret := flag.String("enable-secret", "", "Secret for entering privileged mode (enable, super)")
+	kbdInteractive := flag.Bool("kbd-interactive", false, "Allow keyboard-interactive authentication answered with -pass")
+	transport := flag.String("transport", switchssh.TransportSSH, "Transport: ssh, telnet, auto (ssh, falling back to telnet when refused) or snmp (-mode detect, mac and findmac only)")
+	telnetPort := flag.Int("telnet-port", client.TelnetPort, "Telnet port used when -transport auto falls back to telnet")
+	snmpPort := flag.Int("snmp-port", client.SNMPPort, "UDP port of the SNMP agents (-transport snmp)")
+	snmpCommunity := flag.String("snmp-community", "", "SNMPv2c community (-transport snmp)")
+	snmpUser := flag.String("snmp-user", "", "SNMPv3 user, used instead of the community (-transport snmp)")
+	snmpAuthProto := flag.String("snmp-auth-proto", "", "SNMPv3 authentication protocol: md5, sha, sha224, sha256, sha384 or sha512")
+	snmpAuthPass := flag.String("snmp-auth-pass", "", "SNMPv3 authentication passphrase")
+	snmpPrivProto := flag.String("snmp-priv-proto", "", "SNMPv3 privacy protocol: des, aes, aes192, aes256, aes192c or aes256c")
+	snmpPrivPass := flag.String("snmp-priv-pass", "", "SNMPv3 privacy passphrase")
+	jump := flag.String("jump", "", "Jump hosts to tunnel through, comma separated: [user[:password]@]host[:port],...")
+	jumpUser := flag.String("jump-user", "", "Username for jump hosts (default: device credentials)")
+	jumpPass := flag.String("jump-pass", "", "Password for jump hosts")
+	jumpKey := flag.String("jump-key", "", "Private key file for jump hosts")
+	hostKeyPolicy := flag.String("hostkey", client.HostKeyPolicy, "Host key policy: strict, tofu (record on first use) or insecure")
+	knownHosts := flag.String("known-hosts", client.KnownHostsFile, "OpenSSH known_hosts file used by the strict and tofu policies")
+	credStore := flag.String("credentials", "credentials.enc", "Encrypted credential store (passphrase from "+switchssh.CredentialPassphraseEnv+" or the terminal)")
+	profile := flag.String("profile", "", "Credential profiles to log in with, comma separated, tried in order (-mode cred-set/cred-delete: the profile to change)")
+	credHistory := flag.String("credential-history", "credential_history.json", "File remembering which credential profile each device accepted last, tried first on the next run (empty disables it)")
+	inventory := flag.String("inventory", "switches.txt", "Devices for -mass: YAML, JSON or CSV inventory, or the legacy switches.txt format")
+	group := flag.String("group", "", "Only process inventory hosts of these groups, comma separated")
+	limit := flag.String("limit", "", "Only process inventory hosts whose hostname or address matches these globs, comma separated")
+	workers := flag.Int("workers", 10, "Number of devices processed at the same time by -mass")
+	hostTimeout := flag.Duration("host-timeout", 5*time.Minute, "Maximum time spent on a single device by -mass (0 means no limit)")
+	subnetDelay := flag.Duration("subnet-delay", 0, "Minimum delay between connections to devices of the same subnet by -mass (0 disables it)")
+	subnetPrefix := flag.Int("subnet-prefix", 24, "Prefix length grouping devices into subnets for -subnet-delay")
+	macFormat := flag.String("format", macOutputText, "-mode mac: output format, text (as printed by the device), json or csv (parsed MAC table); -mode findmac: text or json")
+	findMacs := flag.String("macs", "", "-mode findmac: MAC addresses or OUI prefixes (00:50:56) to look for, comma separated")
+	maxEdgeMACs := flag.Int("uplink-macs", 10, "-mode findmac: ports with more MAC addresses than this are uplinks")
+	historyFile := flag.String("history", "mac_history.db", "SQLite database recording the MAC tables read by -mode mac and findmac, queried by the history- modes (empty disables it)")
+	since := flag.String("since", "", "history- modes: only entries seen since this time: 2006-01-02, 2006-01-02 15:04 or a duration back from now (48h, 7d)")
+	until := flag.String("until", "", "history- modes: only entries seen until this time (a date alone covers the whole day)")
+	iface := flag.String("interface", "", "-mode history-port: interface of the -host switch")
+	corpus := flag.String("corpus", "", "-mode validate: directory of sample outputs, samples in a subdirectory named after an OS must be detected as it")
+	flag.Parse()
+
+	fmt.Printf("VER: %s\n", ver)
+
+	client.Debug = *debug
+	client.CommandTimeout = *cmdTimeout
+	client.HostKeyPolicy = *hostKeyPolicy
+	client.KnownHostsFile = *knownHosts
+	client.TelnetPort = *telnetPort
+	client.SNMPPort = *snmpPort
+	client.CredentialHistoryFile = *credHistory
+	cred := switchssh.Credentials{
+		User:                *user,
+		Password:            *pass,
+		KeyFile:             *keyFile,
+		KeyPassphrase:       *keyPass,
+		UseAgent:            *useAgent,
+		KeyboardInteractive: *kbdInteractive,
+		EnableSecret:        *enableSecret,
+	}
+	if *snmpCommunity != "" || *snmpUser != "" {
+		cred.SNMP = &switchssh.SNMPCredentials{
+			Community:    *snmpCommunity,
+			User:         *snmpUser,
+			AuthProtocol: *snmpAuthProto,
+			AuthPassword: *snmpAuthPass,
+			PrivProtocol: *snmpPrivProto,
+			PrivPassword: *snmpPrivPass,
+		}
+	}
+	if *mode == "mac" && *macFormat != macOutputText {
+		if _, err := formatMacTable(*macFormat, nil); err != nil {
+			fmt.Printf("Invalid -format: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if *mode == "validate" {
+		os.Exit(validateMode(client, "devices.json", *corpus))
+	}
+	if strings.HasPrefix(*mode, "history-") {
+		if err := historyMode(*mode, *historyFile, splitList(*findMacs), *host, *iface, *since, *until, *macFormat); err != nil {
+			fmt.Printf("error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if strings.HasPrefix(*mode, "cred-") {
+		if err := credentialMode(*mode, *credStore, *profile, cred); err != nil {
+			fmt.Printf("error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// profiles are read from the credential store, which inventories can reference as well
+	var store *switchssh.CredentialStore
+	_, statErr := os.Stat(*credStore)
+	useInventory := *mass && !strings.EqualFold(filepath.Ext(*inventory), ".txt")
+	var fallback []switchssh.Credentials
+	if *profile != "" || (useInventory && statErr == nil) {
+		var err error
+		store, _, err = openCredentialStore(*credStore, false)
+		if err != nil {
+			fmt.Printf("Unable to open the credential store: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if *profile != "" {
+		creds, err := store.Resolve(switchssh.ParseProfileList(*profile))
+		if err != nil || len(creds) == 0 {
+			fmt.Printf("Invalid -profile: %v\n", err)
+			os.Exit(1)
+		}
+		cred, fallback = creds[0], creds[1:]
+	}
+	hasAuth := (*user != "" && (*pass != "" || *keyFile != "" || *useAgent)) || *profile != "" || (*transport == switchssh.TransportSNMP && cred.SNMP != nil)
+	jumpCred := switchssh.Credentials{User: *jumpUser, Password: *jumpPass, KeyFile: *jumpKey, UseAgent: *useAgent}
+	cliJumpCred := jumpCred
+	if cliJumpCred.User == "" {
+		cliJumpCred = cred
+	}
+	jumps, err := switchssh.ParseJumpHosts(*jump, cliJumpCred)
+	if err != nil {
+		fmt.Printf("Invalid -jump: %s\n", err)
+		os.Exit(1)
+	}
+	// jump hosts given on the command line apply to all devices, switches.txt lines can override them
+	defaults := switchssh.Target{Credentials: cred, Fallback: fallback, JumpHosts: jumps, Transport: *transport}
+	target := defaults
+	target.Address = fmt.Sprintf("%s:%d", *host, *port)
+	poolOptions := switchssh.PoolOptions{Workers: *workers, HostTimeout: *hostTimeout, SubnetDelay: *subnetDelay, SubnetPrefix: *subnetPrefix}
+
+	if *mode == "testmodel" && *model != "" {
+		err := client.LoadOSData("devices.json")
+		if err != nil {
+			fmt.Printf("Error loading OS data: %v\n", err)
+			return
+		}
+		// model and version are matched as the output of the detection probes
+		candidates := client.DetectOS(switchssh.DetectionSignals{Output: *model + "\n" + *version, SysObjectID: *sysObjectID})
+		printCandidates(candidates)
+		if len(candidates) == 0 || candidates[0].Confidence < client.MinConfidence {
+			fmt.Println("No match found for the given model and version.")
+		} else {
+			result, _ := client.ReturnOsInfo(candidates[0].Name)
+			fmt.Printf("Match Found:\nName: %s\nDescription: %s\n", result.Name, result.Description)
+		}
+	}
+
+	// find the switch ports of MAC addresses in the whole inventory
+	if *mode == "findmac" {
+		err := client.LoadOSData("devices.json")
+		if err != nil {
+			fmt.Printf("Error loading OS data: %v\n", err)
+			return
+		}
+		hosts, targets, err := readInventory(*inventory, store, *port, defaults, jumpCred, splitList(*group), splitList(*limit))
+		if err != nil {
+			fmt.Printf("error: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(findMacMode(ctx, client, hosts, targets, poolOptions, splitList(*findMacs), *maxEdgeMACs, *macFormat, *historyFile))
+	}
+
+	// mass get mac address list
+	if *mode == "mac" && *mass {
+		err := client.LoadOSData("devices.json")
+		if err != nil {
+			fmt.Printf("Error loading OS data: %v\n", err)
+			return
+		}
+		hosts, targets, err := readInventory(*inventory, store, *port, defaults, jumpCred, splitList(*group), splitList(*limit))
+		if err != nil {
+			fmt.Printf("error: %s\n", err)
+			os.Exit(1)
+		}
+		results := make([]massResult, len(targets))
+		err = client.RunPool(ctx, targets, poolOptions, func(ctx context.Context, i int, t switchssh.Target) {
+			h := hosts[i]
+			results[i].done = true
+			fmt.Printf("Processing host: %s\n", t.Address)
+			brand, err := macTargetBrand(ctx, client, t)
+			if err != nil {
+				fmt.Printf("GetSSHBrand err on %s: %s\n", h, err)
+				results[i].failErr(h, "Failed detect brand", err)
+				return
+			}
+			if brand == "" {
+				fmt.Printf("unknown model for host: %s\n", h)
+				results[i].fail(failureOther, fmt.Sprintf("Detected brand string is empty on %s\n", h))
+				return
+			}
+			fmt.Printf("Device: %s OS is: %s\n", h, brand)
+			results[i].brand = brand
+			if *macFormat == macOutputText && t.Transport != switchssh.TransportSNMP {
+				results[i].output, err = client.GetContext(ctx, t, switchssh.GetterMacTable)
+			} else {
+				results[i].macs, err = client.MacTableContext(ctx, t)
+			}
+			if errors.Is(err, switchssh.ErrNotSupported) {
+				results[i].fail(failureOther, fmt.Sprintf("Cannot return os command for view mac addresses on %s\n", h))
+			} else if err != nil {
+				results[i].failErr(h, "Cannot read the mac address table", err)
+			}
+		})
+		if err != nil {
+			fmt.Println("Interrupted, skipping the remaining hosts")
+		}
+		// results are written in the order of switches.txt, regardless of which host finished first
+		failed_devices := []string{}
+		for i, result := range results {
+			switch {
+			case !result.done:
+				failed_devices = append(failed_devices, fmt.Sprintf("Not processed (interrupted) %s\n", hosts[i]))
+			case result.failure != "":
+				failed_devices = append(failed_devices, result.failure)
+			default:
+				output, ext := result.output, "txt"
+				if result.macs != nil {
+					output, _ = formatMacTable(*macFormat, result.macs)
+				}
+				if *macFormat != macOutputText {
+					ext = *macFormat
+				}
+				if err := SaveFile(fmt.Sprintf("macs/%s-%s.%s", hosts[i], result.brand, ext), output); err != nil {
+					failed_devices = append(failed_devices, fmt.Sprintf("Unable save output file for command on %s\n", hosts[i]))
+				}
+			}
+		}
+		// MAC tables printed as text are parsed for the history, OSes without a known table format are not recorded
+		tables := make([]switchssh.DeviceMacTable, len(results))
+		for i, result := range results {
+			if !result.done || result.failure != "" {
+				continue
+			}
+			entries := result.macs
+			if entries == nil {
+				if entries, err = client.ParseMacTableOf(result.brand, result.output); err != nil {
+					continue
+				}
+			}
+			tables[i] = switchssh.DeviceMacTable{Host: hosts[i], OS: result.brand, Entries: entries}
+		}
+		recordMacHistory(*historyFile, tables, targets)
+		// write about the problems in the file
+		content := strings.Join(failed_devices, "")
+		SaveFile("fail.log", content)
+		if code := printSummary(results); code != 0 {
+			os.Exit(code)
+		}
+
+	}
+
+	// mass detect
+	if *mode == "detect" && *mass {
+		err := client.LoadOSData("devices.json")
+		if err != nil {
+			fmt.Printf("Error loading OS data: %v\n", err)
+			return
+		}
+		hosts, targets, err := readInventory(*inventory, store, *port, defaults, jumpCred, splitList(*group), splitList(*limit))
+		if err != nil {
+			fmt.Printf("error: %s\n", err)
+			os.Exit(1)
+		}
+		results := make([]massResult, len(targets))
+		err = client.RunPool(ctx, targets, poolOptions, func(ctx context.Context, i int, t switchssh.Target) {
+			h := hosts[i]
+			results[i].done = true
+			fmt.Printf("Processing host: %s\n", t.Address)
+			brand, err := client.GetSSHBrandContext(ctx, t)
+			if err != nil {
+				fmt.Printf("GetSSHBrand err on %s: %s\n", h, err)
+				results[i].failErr(h, "Failed detect brand", err)
+				return
+			}
+			if brand == "" {
+				fmt.Printf("unknown model for host: %s\n", h)
+			} else {
+				fmt.Printf("Device: %s OS is: %s\n", h, brand)
+			}
+			results[i].brand = brand
+		})
+		if err != nil {
+			fmt.Println("Interrupted, skipping the remaining hosts")
+		}
+		// results are written in the order of switches.txt, regardless of which host finished first
+		devices := []string{}
+		failed_devices := []string{}
+		for i, result := range results {
+			switch {
+			case !result.done:
+				failed_devices = append(failed_devices, fmt.Sprintf("Not processed (interrupted) %s\n", hosts[i]))
+			case result.failure != "":
+				failed_devices = append(failed_devices, result.failure)
+			case result.brand != "":
+				devices = append(devices, fmt.Sprintf("%s -> %s", hosts[i], result.brand))
+			}
+		}
+		// write devices to file
+		content := strings.Join(devices, "\n")
+		SaveFile("detected_models.txt", content)
+		if len(failed_devices) > 0 {
+			SaveFile("fail.log", strings.Join(failed_devices, ""))
+		}
+		if code := printSummary(results); code != 0 {
+			os.Exit(code)
+		}
+
+	}
+
+	if *mode == "mac" && hasAuth {
+		err := client.LoadOSData("devices.json")
+		if err != nil {
+			fmt.Printf("Error loading OS data: %v\n", err)
+			return
+		}
+		brand, err := macTargetBrand(ctx, client, target)
+		if err != nil {
+			fmt.Printf("GetSSHBrand err: %s\n", err.Error())
+			os.Exit(exitCode(err))
+		}
+		if brand == "" {
+			fmt.Printf("unknown model for host: %s\n", *host)
+		} else {
+			fmt.Printf("Device OS is: %s\n", brand)
+			if *macFormat == macOutputText && target.Transport != switchssh.TransportSNMP {
+				result, err := client.GetContext(ctx, target, switchssh.GetterMacTable)
+				if err != nil {
+					fmt.Printf("Error: %s\n", err.Error())
+					os.Exit(exitCode(err))
+				}
+				fmt.Printf("%s\n", result)
+				if entries, err := client.ParseMacTableOf(brand, result); err == nil {
+					recordMacHistory(*historyFile, []switchssh.DeviceMacTable{{Host: *host, OS: brand, Entries: entries}}, []switchssh.Target{target})
+				}
+			} else {
+				entries, err := client.MacTableContext(ctx, target)
+				if err != nil {
+					fmt.Printf("Error: %s\n", err.Error())
+					os.Exit(exitCode(err))
+				}
+				output, _ := formatMacTable(*macFormat, entries)
+				fmt.Print(output)
+				recordMacHistory(*historyFile, []switchssh.DeviceMacTable{{Host: *host, OS: brand, Entries: entries}}, []switchssh.Target{target})
+			}
+
+		}
+		os.Exit(0)
+	}
+
+	if *mode == "detect" && hasAuth {
+		err := client.LoadOSData("devices.json")
+		if err != nil {
+			fmt.Printf("Error loading OS data: %v\n", err)
+			return
+		}
+		candidates, err := client.DetectContext(ctx, target)
+		if err != nil {
+			fmt.Printf("GetSSHBrand err: %s\n", err.Error())
+			os.Exit(exitCode(err))
+		}
+		if target.Transport == switchssh.TransportSNMP {
+			if descr, objectID, err := client.SNMPSystemContext(ctx, target); err == nil {
+				fmt.Printf("sysObjectID: %s\nsysDescr:\n%s\n", objectID, descr)
+			}
+		} else if serverVersion, banner, err := client.ServerInfoContext(ctx, target); err == nil {
+			fmt.Printf("SSH server: %s\n", serverVersion)
+			if banner != "" {
+				fmt.Printf("Banner:\n%s\n", banner)
+			}
+		}
+		printCandidates(candidates)
+		brand, _ := client.GetSSHBrandContext(ctx, target)
+		if brand == "" {
+			fmt.Printf("unknown model for host: %s\n", *host)
+		} else {
+			fmt.Printf("Device OS is: %s\n", brand)
+		}
+		os.Exit(0)
+	}
+
+	if *mode == "run" && hasAuth {
+		err := client.LoadOSData("devices.json")
+		if err != nil {
+			fmt.Printf("Error loading OS data: %v\n", err)
+			return
+		}
+		brand, err := client.GetSSHBrandContext(ctx, target)
+		if err != nil {
+			fmt.Printf("GetSSHBrand err: %s\n", err.Error())
+			os.Exit(exitCode(err))
+		}
+		fmt.Printf("Device brand is: %s\n", brand)
+		OS, _ := client.ReturnOsInfo(brand)
+
+		if *dump != "" {
+			result, err := client.RunCommandsContext(ctx, target, OS.Pager, "show "+*dump)
+			if err != nil {
+				fmt.Println("RunCommands err:\n", err.Error())
+				os.Exit(exitCode(err))
+			}
+			fmt.Printf("OUTPUT: \n----------------------------------------\n%s\n--------------------------------------\n", result)
+		}
+		if *save != "" {
+			result, err := client.RunCommandsContext(ctx, target, OS.Pager, "show "+*save)
+			if err != nil {
+				fmt.Println("RunCommands err:\n", err.Error())
+				os.Exit(exitCode(err))
+			}
+			fmt.Printf("Sanitizing output...\n")
+			err, out := switchssh.SanitizeConfigOutput(result)
+			if err != nil {
+				fmt.Printf("Unable to sanitize output!\n")
+				os.Exit(1)
+			}
+			err = SaveFile(fmt.Sprintf("dump_%s.txt", *save), out)
+			if err != nil {
+				fmt.Printf("error when saving file for command: %s\n", *save)
+			}
+		}
+		if *getter != "" {
+			result, err := client.GetContext(ctx, target, *getter)
+			if err != nil {
+				fmt.Println("Get err:\n", err.Error())
+				os.Exit(exitCode(err))
+			}
+			fmt.Printf("%s\n", result)
+		}
+		if *execCmds != "" {
+			results, err := client.RunCommandsWithResultsContext(ctx, target, OS.Pager, strings.Split(*execCmds, ";")...)
+			out, _ := json.MarshalIndent(results, "", "  ")
+			fmt.Printf("%s\n", out)
+			if err != nil {
+				fmt.Println("RunCommandsWithResults err:\n", err.Error())
+				os.Exit(exitCode(err))
+			}
+			for _, result := range results {
+				if err := result.Err(); err != nil {
+					os.Exit(exitCode(err))
+				}
+			}
+		}
+	}
+
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/e1z0/switch-ssh/switchssh"
+)
+
+// lints the signature file and, when a corpus directory is given, detects the OS of every sample in it.
+// Samples are outputs of the detection probes, optionally preceded by header lines giving the other signals
+// (see parseSample). A sample in a subdirectory is expected to be detected as the OS the subdirectory is named
+// after. Returns the exit code: 1 if the file is invalid or a sample is invalid or detected wrongly.
+func validateMode(client *switchssh.Client, path string, corpus string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+		return exitFailure
+	}
+	osData, err := switchssh.ParseOSData(data)
+	if err == nil {
+		err = client.SetOSData(osData)
+	}
+	if err != nil {
+		fmt.Printf("%s: %s\n", path, err)
+		return exitFailure
+	}
+	warnings := client.LintOSData()
+	for _, warning := range warnings {
+		fmt.Printf("warning: %s\n", warning)
+	}
+	fmt.Printf("%s: %d entries, %d warnings\n", path, len(osData), len(warnings))
+	if corpus == "" {
+		return 0
+	}
+
+	samples, wrong, overlaps := 0, 0, 0
+	err = filepath.WalkDir(corpus, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		samples++
+		signals, err := parseSample(string(data))
+		if err != nil {
+			wrong++
+			fmt.Printf("INVALID %s: %s\n", file, err)
+			return nil
+		}
+		expected := ""
+		if dir := filepath.Dir(file); dir != filepath.Clean(corpus) {
+			expected = filepath.Base(dir)
+		}
+		candidates := client.DetectOS(signals)
+		detected := ""
+		if len(candidates) > 0 && candidates[0].Confidence >= client.MinConfidence {
+			detected = candidates[0].Name
+		}
+		switch {
+		case expected != "" && detected == "":
+			wrong++
+			fmt.Printf("MISSED %s: expected %s, not detected (%s)\n", file, expected, switchssh.FormatCandidates(candidates))
+		case expected != "" && detected != expected:
+			wrong++
+			fmt.Printf("WRONG %s: expected %s, detected %s\n", file, expected, detected)
+		case expected == "":
+			fmt.Printf("%s: %s\n", file, switchssh.FormatCandidates(candidates))
+		}
+		confident := []string{}
+		for _, candidate := range candidates {
+			if candidate.Confidence >= client.MinConfidence {
+				confident = append(confident, candidate.Name)
+			}
+			if expected != "" && candidate.Name != expected {
+				fmt.Printf("  signatures of %s match %s: %s\n", candidate.Name, file, strings.Join(candidate.Matched, ", "))
+			}
+		}
+		if len(confident) > 1 {
+			overlaps++
+			fmt.Printf("OVERLAP %s: %s all reach the confidence\n", file, strings.Join(confident, ", "))
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+		return exitFailure
+	}
+	fmt.Printf("%s: %d samples, %d detected wrongly, %d overlaps\n", corpus, samples, wrong, overlaps)
+	if wrong > 0 {
+		return exitFailure
+	}
+	return 0
+}
+
+// prefix of the header lines of a sample
+const sampleHeaderPrefix = "#! "
+
+// reads a corpus sample: header lines "#! signal: value" for the ssh-version, banner, prompt and sysobjectid
+// signals (banner lines are joined), the rest of the file is the probe output
+func parseSample(data string) (switchssh.DetectionSignals, error) {
+	signals := switchssh.DetectionSignals{}
+	banner := []string{}
+	for strings.HasPrefix(data, sampleHeaderPrefix) {
+		line, rest, _ := strings.Cut(data, "\n")
+		data = rest
+		name, value, ok := strings.Cut(strings.TrimPrefix(strings.TrimRight(line, "\r"), sampleHeaderPrefix), ":")
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(name) {
+		case switchssh.SignalSSHVersion:
+			signals.SSHVersion = value
+		case switchssh.SignalBanner:
+			banner = append(banner, value)
+		case switchssh.SignalPrompt:
+			signals.Prompt = value
+		case switchssh.SignalSysObjectID:
+			signals.SysObjectID = strings.TrimPrefix(value, ".")
+		default:
+			if !ok {
+				return signals, fmt.Errorf("header line %q is not \"signal: value\"", line)
+			}
+			return signals, fmt.Errorf("unknown signal %q in the header (known: %s, %s, %s, %s)", name,
+				switchssh.SignalSSHVersion, switchssh.SignalBanner, switchssh.SignalPrompt, switchssh.SignalSysObjectID)
+		}
+	}
+	signals.Banner = strings.Join(banner, "\n")
+	signals.Output = data
+	return signals, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/e1z0/switch-ssh/switchssh"
+)
+
+func TestParseSample(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		data    string
+		signals switchssh.DetectionSignals
+		err     string
+	}{
+		{"all headers",
+			"#! ssh-version: SSH-2.0-Cisco-1.25\n#! banner: Authorized access only\n#! banner: Disconnect now\n#! prompt: sw1#\n" +
+				"#! sysobjectid: .1.3.6.1.4.1.9.1.1208\nCisco IOS Software, C2960X Software\n",
+			switchssh.DetectionSignals{SSHVersion: "SSH-2.0-Cisco-1.25", Banner: "Authorized access only\nDisconnect now", Prompt: "sw1#",
+				SysObjectID: "1.3.6.1.4.1.9.1.1208", Output: "Cisco IOS Software, C2960X Software\n"}, ""},
+		{"windows line ends", "#! prompt: <HUAWEI>\r\nHuawei Versatile Routing Platform Software\r\n",
+			switchssh.DetectionSignals{Prompt: "<HUAWEI>", Output: "Huawei Versatile Routing Platform Software\r\n"}, ""},
+		// Values may contain colons
+		{"colon in the value", "#! banner: Site: DC1\n", switchssh.DetectionSignals{Banner: "Site: DC1"}, ""},
+		{"output only", "Cisco IOS Software\n#! prompt: sw1#\n", switchssh.DetectionSignals{Output: "Cisco IOS Software\n#! prompt: sw1#\n"}, ""},
+		{"unknown signal", "#! motd: hello\nCisco IOS Software\n", switchssh.DetectionSignals{}, `unknown signal "motd"`},
+		{"not a header", "#! SSH-2.0-Cisco-1.25\nCisco IOS Software\n", switchssh.DetectionSignals{}, `header line "#! SSH-2.0-Cisco-1.25" is not "signal: value"`},
+	} {
+		signals, err := parseSample(test.data)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if signals != test.signals {
+			t.Errorf("%s: signals %+v, expected %+v", test.name, signals, test.signals)
+		}
+	}
+}
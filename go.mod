@@ -1,8 +1,13 @@
-module example.com/m
+module github.com/e1z0/switch-ssh
 
 go 1.22.4
 
 require (
-	golang.org/x/crypto v0.32.0 // indirect
-	golang.org/x/sys v0.29.0 // indirect
+	github.com/gosnmp/gosnmp v1.38.0
+	github.com/mattn/go-sqlite3 v1.14.33
+	golang.org/x/crypto v0.32.0
+	golang.org/x/term v0.28.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.29.0 // indirect
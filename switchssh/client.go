@@ -0,0 +1,127 @@
+// Package switchssh connects to network switches and routers over SSH or telnet,
+// detects their operating system from the signatures in devices.json and runs commands on them.
+package switchssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+/**
+ * Entry point of the library, holding the settings, the OS signatures and the cache of opened sessions.
+ * Independent clients do not share sessions, signatures or settings.
+ * Settings must be changed before the first connection.
+ *
+ * @attr Debug                 Print debug logs
+ * @attr LogOutput             Destination of the logs (default os.Stdout)
+ * @attr CommandTimeout        Maximum time to wait for the prompt after a single command
+ * @attr LoginTimeout          Maximum time to wait for the first prompt after login
+ * @attr DialTimeout           Maximum time to establish the TCP connection and complete the SSH handshake
+ * @attr HostKeyPolicy         Host key policy (HostKeyStrict, HostKeyTOFU, HostKeyInsecure)
+ * @attr KnownHostsFile        OpenSSH known_hosts file used by the strict and tofu policies
+ * @attr TelnetPort            Port used by the auto transport when falling back to telnet
+ * @attr SNMPPort              UDP port of the SNMP agents
+ * @attr SNMPTimeout           Maximum time to wait for the answer to an SNMP request, before retrying it
+ * @attr UnknownModelsFile     File collecting the output of devices that could not be detected (empty disables it)
+ * @attr CredentialHistoryFile File remembering per device the credentials it accepted last (empty keeps them in memory only)
+ * @attr MinConfidence         Confidence the best OS candidate needs to be detected (see DetectOS)
+ */
+type Client struct {
+	Debug                 bool
+	LogOutput             io.Writer
+	CommandTimeout        time.Duration
+	LoginTimeout          time.Duration
+	DialTimeout           time.Duration
+	HostKeyPolicy         string
+	KnownHostsFile        string
+	TelnetPort            int
+	SNMPPort              int
+	SNMPTimeout           time.Duration
+	UnknownModelsFile     string
+	CredentialHistoryFile string
+	MinConfidence         float64
+
+	osData       []OS
+	osSignatures []compiledOS
+	driverCache  map[string]Driver
+	osLocker     sync.RWMutex
+	sessions     *SessionManager
+	hostKeys     *hostKeyVerifier
+	jumpHosts    *jumpPool
+	credHistory  *credentialHistory
+}
+
+/**
+ * Creates a Client with the default settings and no OS signatures (see LoadOSData).
+ *
+ * @return Client instance
+ */
+func NewClient() *Client {
+	client := &Client{
+		LogOutput:      os.Stdout,
+		CommandTimeout: 60 * time.Second,
+		LoginTimeout:   20 * time.Second,
+		DialTimeout:    20 * time.Second,
+		HostKeyPolicy:  HostKeyTOFU,
+		KnownHostsFile: "known_hosts",
+		TelnetPort:     23,
+		SNMPPort:       161,
+		SNMPTimeout:    5 * time.Second,
+		MinConfidence:  0.5,
+	}
+	client.hostKeys = &hostKeyVerifier{client: client}
+	client.jumpHosts = newJumpPool(client)
+	client.credHistory = &credentialHistory{client: client}
+	client.sessions = NewSessionManager(client)
+	return client
+}
+
+/**
+ * Returns the manager caching the sessions opened by the client.
+ */
+func (this *Client) SessionManager() *SessionManager {
+	return this.sessions
+}
+
+/**
+ * Closes all cached sessions and stops the automatic cleanup of the session cache.
+ */
+func (this *Client) Close() {
+	this.sessions.Close()
+}
+
+func (this *Client) LogDebug(format string, a ...interface{}) {
+	if this.Debug {
+		fmt.Fprintln(this.LogOutput, "[DEBUG]:"+fmt.Sprintf(format, a...))
+	}
+}
+
+func (this *Client) LogError(format string, a ...interface{}) {
+	fmt.Fprintln(this.LogOutput, "[ERROR]:"+fmt.Sprintf(format, a...))
+}
+
+// collects the output of a device that could not be detected, for adding its signature later
+func (this *Client) saveUnknownModel(output string) {
+	if this.UnknownModelsFile == "" {
+		return
+	}
+	if err := appendFile(this.UnknownModelsFile, output); err != nil {
+		this.LogError("Unable to save unknown model output:%s", err)
+	}
+}
+
+func appendFile(filename string, text string) error {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = f.WriteString(text); err != nil {
+		return err
+	}
+	return nil
+}
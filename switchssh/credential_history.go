@@ -0,0 +1,165 @@
+package switchssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+/**
+ * Returned when the device refused all credentials of the target.
+ *
+ * @attr Address Address of the device
+ * @attr Tried   Credentials tried, in order (user and profile, no secrets)
+ * @attr Err     Error of the last attempt
+ */
+type AuthError struct {
+	Address string
+	Tried   []string
+	Err     error
+}
+
+func (this *AuthError) Error() string {
+	return fmt.Sprintf("authentication to %s failed (tried %s): %s", this.Address, strings.Join(this.Tried, ", "), this.Err)
+}
+
+func (this *AuthError) Unwrap() error {
+	return this.Err
+}
+
+func newAuthError(address string, creds []Credentials, err error) *AuthError {
+	tried := make([]string, 0, len(creds))
+	for _, cred := range creds {
+		tried = append(tried, cred.describe())
+	}
+	return &AuthError{Address: address, Tried: tried, Err: err}
+}
+
+/**
+ * Remembers per device the credentials it accepted last, so the next connections try them first.
+ * Credential profiles are remembered by name in memory and, when the client has a CredentialHistoryFile, in that file.
+ * Unnamed credentials are only remembered in memory, by their session cache key, so nothing derived
+ * from their secrets is written to the file.
+ *
+ * @attr client  Client holding the history file setting
+ * @attr entries Profile name of the accepted credentials by device address, saved in the history file
+ * @attr unnamed Session cache key of the accepted unnamed credentials by device address
+ * @attr loaded  The history file has been read
+ * @attr locker  Lock of entries, unnamed and of the history file
+ */
+type credentialHistory struct {
+	client  *Client
+	entries map[string]string
+	unnamed map[string]string
+	loaded  bool
+	locker  sync.Mutex
+}
+
+// Prefix of the profile names in the history file
+const historyProfilePrefix = "profile:"
+
+/**
+ * Reads the history file once. Must be called with the locker held.
+ */
+func (this *credentialHistory) load() {
+	if this.loaded {
+		return
+	}
+	this.loaded = true
+	this.entries = make(map[string]string)
+	this.unnamed = make(map[string]string)
+	if this.client.CredentialHistoryFile == "" {
+		return
+	}
+	data, err := os.ReadFile(this.client.CredentialHistoryFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			this.client.LogError("Unable to read credential history:%s", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &this.entries); err != nil {
+		this.client.LogError("Unable to parse credential history:%s", err)
+		this.entries = make(map[string]string)
+	}
+	// Older versions stored hashes of unnamed credentials, they are dropped on the next save
+	for address, id := range this.entries {
+		if !strings.HasPrefix(id, historyProfilePrefix) {
+			delete(this.entries, address)
+		}
+	}
+}
+
+/**
+ * Checks whether the device accepted these credentials last. Must be called with the locker held.
+ */
+func (this *credentialHistory) accepted(address string, cred Credentials) bool {
+	if cred.Profile == "" {
+		last, ok := this.unnamed[address]
+		return ok && last == cred.key()
+	}
+	return this.entries[address] == historyProfilePrefix+cred.Profile
+}
+
+/**
+ * Returns the credentials with the ones the device accepted last moved to the front.
+ *
+ * @param address Address of the device
+ * @param creds   Credentials in the configured order
+ * @return        Credentials in the order to try them
+ */
+func (this *credentialHistory) order(address string, creds []Credentials) []Credentials {
+	if len(creds) < 2 {
+		return creds
+	}
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	this.load()
+	for i, cred := range creds {
+		if i > 0 && this.accepted(address, cred) {
+			ordered := append([]Credentials{cred}, creds[:i]...)
+			return append(ordered, creds[i+1:]...)
+		}
+	}
+	return creds
+}
+
+/**
+ * Records the credentials the device accepted, saving the history file when they changed.
+ *
+ * @param address Address of the device
+ * @param cred    Accepted credentials
+ */
+func (this *credentialHistory) remember(address string, cred Credentials) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	this.load()
+	if this.accepted(address, cred) {
+		return
+	}
+	if cred.Profile == "" {
+		this.unnamed[address] = cred.key()
+		if _, ok := this.entries[address]; !ok {
+			return
+		}
+		delete(this.entries, address)
+	} else {
+		delete(this.unnamed, address)
+		this.entries[address] = historyProfilePrefix + cred.Profile
+	}
+	if this.client.CredentialHistoryFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(this.entries, "", "  ")
+	if err == nil {
+		tmp := this.client.CredentialHistoryFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, this.client.CredentialHistoryFile)
+		}
+	}
+	if err != nil {
+		this.client.LogError("Unable to save credential history:%s", err)
+	}
+}
@@ -0,0 +1,86 @@
+package switchssh
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readCredentialHistory(t *testing.T, filename string) map[string]string {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]string)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("history file %q: %s", data, err)
+	}
+	return entries
+}
+
+func TestCredentialHistoryKeepsNoSecrets(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+	client.CredentialHistoryFile = filepath.Join(t.TempDir(), "credential_history.json")
+	tacacs := Credentials{User: "admin", Password: "tacacs-pass", Profile: "tacacs"}
+	local := Credentials{User: "admin", Password: "local-pass", EnableSecret: "enable-pass"}
+	creds := []Credentials{tacacs, local}
+
+	// Unnamed credentials are tried first again, but not saved
+	client.credHistory.remember("10.0.0.1:22", local)
+	if order := client.credHistory.order("10.0.0.1:22", creds); order[0].Password != local.Password {
+		t.Errorf("unnamed credentials accepted last not tried first: %+v", order)
+	}
+	if entries := readCredentialHistory(t, client.CredentialHistoryFile); entries != nil {
+		t.Errorf("unnamed credentials saved: %v", entries)
+	}
+
+	client.credHistory.remember("10.0.0.2:22", local)
+	client.credHistory.remember("10.0.0.2:22", tacacs)
+	client.credHistory.remember("10.0.0.3:22", tacacs)
+	// The device accepting unnamed credentials now forgets its profile
+	client.credHistory.remember("10.0.0.3:22", local)
+	data, err := os.ReadFile(client.CredentialHistoryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := readCredentialHistory(t, client.CredentialHistoryFile); !reflect.DeepEqual(entries, map[string]string{"10.0.0.2:22": "profile:tacacs"}) {
+		t.Errorf("history file %v", entries)
+	}
+	for _, cred := range creds {
+		for _, secret := range []string{cred.Password, cred.EnableSecret, cred.key()} {
+			if secret != "" && strings.Contains(string(data), secret) {
+				t.Errorf("history file %q contains %q", data, secret)
+			}
+		}
+		// Nor any part of the hash of the secrets
+		hash := strings.Split(cred.key(), "_")[1]
+		if strings.Contains(string(data), hash[:8]) {
+			t.Errorf("history file %q contains the hash %s of the secrets", data, hash)
+		}
+	}
+
+	// Hashes saved by older versions are ignored and dropped
+	if err := os.WriteFile(client.CredentialHistoryFile, []byte(`{"10.0.0.2:22": "profile:tacacs", "10.0.0.4:22": "key:`+local.key()+`"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := newTestClient(t)
+	defer reloaded.Close()
+	reloaded.CredentialHistoryFile = client.CredentialHistoryFile
+	if order := reloaded.credHistory.order("10.0.0.2:22", []Credentials{local, tacacs}); order[0].Profile != "tacacs" {
+		t.Errorf("saved profile not tried first: %+v", order)
+	}
+	if order := reloaded.credHistory.order("10.0.0.4:22", creds); order[0].Profile != "tacacs" {
+		t.Errorf("saved hash used: %+v", order)
+	}
+	reloaded.credHistory.remember("10.0.0.5:22", tacacs)
+	if entries := readCredentialHistory(t, client.CredentialHistoryFile); !reflect.DeepEqual(entries, map[string]string{"10.0.0.2:22": "profile:tacacs", "10.0.0.5:22": "profile:tacacs"}) {
+		t.Errorf("history file after reloading %v", entries)
+	}
+}
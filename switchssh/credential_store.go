@@ -0,0 +1,266 @@
+package switchssh
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Environment variable holding the master passphrase of the credential store.
+const CredentialPassphraseEnv = "SWITCHSSH_PASSPHRASE"
+
+// Returned when the master passphrase does not decrypt the credential store.
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted credential store")
+
+// scrypt parameters for new credential stores
+const (
+	credentialStoreVersion = 1
+	credentialScryptN      = 1 << 15
+	credentialScryptR      = 8
+	credentialScryptP      = 1
+	// Limits of the parameters read from a store, so an edited file cannot exhaust the memory or the CPU
+	// before the passphrase is checked: memory is 128*N*r bytes, time grows with N*r*p
+	credentialScryptMaxMemory = 256 << 20
+	credentialScryptMaxP      = 16
+)
+
+/**
+ * Named credential profiles, saved in a file encrypted with a key derived from a master passphrase
+ * (scrypt, AES-256-GCM).
+ *
+ * @attr profiles Credentials by profile name
+ */
+type CredentialStore struct {
+	profiles map[string]Credentials
+}
+
+/**
+ * Encrypted file format of the credential store.
+ */
+type credentialStoreFile struct {
+	Version int    `json:"version"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+/**
+ * Creates an empty credential store.
+ */
+func NewCredentialStore() *CredentialStore {
+	return &CredentialStore{profiles: make(map[string]Credentials)}
+}
+
+/**
+ * Loads and decrypts a credential store.
+ *
+ * @param filename   Encrypted credential store
+ * @param passphrase Master passphrase
+ * @return           Credential store, ErrWrongPassphrase if the passphrase does not match, other errors
+ */
+func LoadCredentialStore(filename, passphrase string) (*CredentialStore, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var file credentialStoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	if file.Version != credentialStoreVersion {
+		return nil, fmt.Errorf("%s: unsupported credential store version %d", filename, file.Version)
+	}
+	gcm, err := credentialCipher(passphrase, file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	store := NewCredentialStore()
+	if err := json.Unmarshal(plain, &store.profiles); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return store, nil
+}
+
+/**
+ * Encrypts and saves the credential store, readable by the owner only.
+ *
+ * @param filename   Encrypted credential store
+ * @param passphrase Master passphrase
+ * @return           Errors
+ */
+func (this *CredentialStore) Save(filename, passphrase string) error {
+	if passphrase == "" {
+		return errors.New("empty passphrase")
+	}
+	plain, err := json.Marshal(this.profiles)
+	if err != nil {
+		return err
+	}
+	file := credentialStoreFile{
+		Version: credentialStoreVersion,
+		N:       credentialScryptN,
+		R:       credentialScryptR,
+		P:       credentialScryptP,
+		Salt:    make([]byte, 16),
+	}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	gcm, err := credentialCipher(passphrase, file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plain, nil)
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write next to the store and rename, so an interrupted save does not destroy it
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+/**
+ * Derives the AES-256-GCM cipher from the passphrase.
+ */
+func credentialCipher(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	if n <= 1 || r <= 0 || p <= 0 || p > credentialScryptMaxP || n > credentialScryptMaxMemory/128/r {
+		return nil, fmt.Errorf("scrypt parameters out of range (N=%d r=%d p=%d)", n, r, p)
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/**
+ * Returns the credentials of the profile.
+ *
+ * @param name Profile name
+ * @return     Credentials (with Profile set) and false if there is no such profile
+ */
+func (this *CredentialStore) Get(name string) (Credentials, bool) {
+	cred, ok := this.profiles[name]
+	cred.Profile = name
+	return cred, ok
+}
+
+/**
+ * Adds or replaces a profile.
+ */
+func (this *CredentialStore) Set(name string, cred Credentials) {
+	cred.Profile = ""
+	this.profiles[name] = cred
+}
+
+/**
+ * Removes a profile.
+ *
+ * @return false if there was no such profile
+ */
+func (this *CredentialStore) Delete(name string) bool {
+	_, ok := this.profiles[name]
+	delete(this.profiles, name)
+	return ok
+}
+
+/**
+ * Returns the sorted profile names.
+ */
+func (this *CredentialStore) Names() []string {
+	names := make([]string, 0, len(this.profiles))
+	for name := range this.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/**
+ * Returns the credentials of the profiles, in the given order.
+ *
+ * @param names Profile names
+ * @return      Credentials and an error naming the first unknown profile
+ */
+func (this *CredentialStore) Resolve(names []string) ([]Credentials, error) {
+	creds := make([]Credentials, 0, len(names))
+	for _, name := range names {
+		cred, ok := this.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown credential profile %s", name)
+		}
+		creds = append(creds, cred)
+	}
+	return creds, nil
+}
+
+/**
+ * List of credential profile names, tried in order.
+ * Accepts a single name, a comma separated string or a list.
+ */
+type ProfileList []string
+
+func (this *ProfileList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*this = list
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("credentials must be a profile name or a list of profile names")
+	}
+	*this = ParseProfileList(value)
+	return nil
+}
+
+func (this *ProfileList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*this = list
+		return nil
+	}
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return fmt.Errorf("credentials must be a profile name or a list of profile names")
+	}
+	*this = ParseProfileList(value)
+	return nil
+}
+
+/**
+ * Parses profile names separated by commas, semicolons or spaces.
+ */
+func ParseProfileList(value string) ProfileList {
+	return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' || r == ' ' })
+}
@@ -0,0 +1,53 @@
+package switchssh
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCredentialStoreRoundTrip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "credentials.enc")
+	store := NewCredentialStore()
+	store.Set("lab", Credentials{User: "admin", Password: "secret"})
+	if err := store.Save(filename, "master"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCredentialStore(filename, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred, ok := loaded.Get("lab"); !ok || cred.Password != "secret" {
+		t.Errorf("profile lab not restored: %+v", cred)
+	}
+	if _, err := LoadCredentialStore(filename, "other"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+func TestCredentialStoreScryptLimits(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "credentials.enc")
+	if err := NewCredentialStore().Save(filename, "master"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, params := range [][3]int{{1 << 30, 8, 1}, {1 << 15, 1 << 20, 1}, {1 << 15, 8, 1 << 20}, {0, 8, 1}, {1 << 15, 0, 1}} {
+		var file credentialStoreFile
+		json.Unmarshal(data, &file)
+		file.N, file.R, file.P = params[0], params[1], params[2]
+		edited, _ := json.Marshal(file)
+		if err := os.WriteFile(filename, edited, 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadCredentialStore(filename, "master")
+		if err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("N=%d r=%d p=%d: expected the parameters to be refused, got %v", params[0], params[1], params[2], err)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package switchssh
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Weights of detection signatures
+const (
+	// the OS is not a candidate unless the signature matches
+	WeightRequired = "required"
+	WeightStrong   = "strong"
+	// the default, for patterns that also match devices of other vendors (version numbers, model numbers)
+	WeightWeak = "weak"
+)
+
+// Signals a signature can be matched against
+const (
+	// SSH server version string, e.g. SSH-2.0-Cisco-1.25
+	SignalSSHVersion = "ssh-version"
+	// banner shown before the login
+	SignalBanner = "banner"
+	// the prompt learned after login
+	SignalPrompt = "prompt"
+	// output of the detection probes (show version, ...), or the SNMP sysDescr
+	SignalOutput = "output"
+	// SNMP sysObjectID, dotted without the leading dot, e.g. 1.3.6.1.4.1.9.1.1208
+	SignalSysObjectID = "sysobjectid"
+)
+
+// all signal names, in the order they are documented
+var SignalNames = []string{SignalSSHVersion, SignalBanner, SignalPrompt, SignalOutput, SignalSysObjectID}
+
+// points a matching signature adds to the score of its OS
+var signatureScores = map[string]int{
+	WeightRequired: 3,
+	WeightStrong:   3,
+	WeightWeak:     1,
+}
+
+// score at which a candidate is fully confident: two strong signatures
+const fullConfidenceScore = 6
+
+// maximum time to wait for the prompt after a probe
+const probeTimeout = 15 * time.Second
+
+// probes of entries that declare none, the commands earlier versions ran on every device
+var defaultProbes = []string{"dis version", "show version", "show inventory", "show system"}
+
+// detection signature of devices.json
+type Signature struct {
+	Field   string `json:"field"`
+	Pattern string `json:"pattern"`
+	Weight  string `json:"weight"`
+}
+
+/**
+ * Everything known about a device when its OS is detected.
+ *
+ * @attr SSHVersion  SSH server version string (empty for telnet)
+ * @attr Banner      Banner shown before the login
+ * @attr Prompt      Prompt learned after login
+ * @attr Output      Output of the detection probes, or the SNMP sysDescr
+ * @attr SysObjectID SNMP sysObjectID (empty when not detected over SNMP)
+ */
+type DetectionSignals struct {
+	SSHVersion  string
+	Banner      string
+	Prompt      string
+	Output      string
+	SysObjectID string
+}
+
+func (this DetectionSignals) value(field string) string {
+	switch field {
+	case SignalSSHVersion:
+		return this.SSHVersion
+	case SignalBanner:
+		return this.Banner
+	case SignalPrompt:
+		return this.Prompt
+	case SignalSysObjectID:
+		return this.SysObjectID
+	}
+	return this.Output
+}
+
+/**
+ * OS the device may run, as ranked by DetectOS.
+ *
+ * @attr Name       OS name from devices.json
+ * @attr Score      Sum of the points of the matched signatures
+ * @attr Confidence Score relative to two strong signatures, between 0 and 1
+ * @attr Matched    Matched signatures, as "weight field: pattern"
+ */
+type Candidate struct {
+	Name       string
+	Score      int
+	Confidence float64
+	Matched    []string
+}
+
+// signature groups of an OS entry: each group scores once, when any of its patterns matches
+type signatureGroup struct {
+	field    string
+	weight   string
+	patterns []*regexp.Regexp
+}
+
+// OS entry with its signatures compiled once, when the OS data is set
+type compiledOS struct {
+	OS
+	groups []signatureGroup
+}
+
+/**
+ * Compiles the signatures of the entry; models and versions of earlier devices.json files are
+ * required groups, so an entry using only them is detected when both match, as before.
+ *
+ * @param osEntry OS entry of devices.json
+ * @return        Entry with compiled signatures, an error naming the entry, the field and the pattern that does not compile
+ */
+func compileSignatures(osEntry OS) (compiledOS, error) {
+	compiled := compiledOS{OS: osEntry}
+	add := func(where string, field string, weight string, patterns ...string) error {
+		group := signatureGroup{field: field, weight: weight}
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: %s: invalid regex %q: %s", osEntry.Name, where, pattern, err)
+			}
+			group.patterns = append(group.patterns, re)
+		}
+		compiled.groups = append(compiled.groups, group)
+		return nil
+	}
+	if len(osEntry.Models) > 0 {
+		if err := add("models", SignalOutput, WeightRequired, osEntry.Models...); err != nil {
+			return compiled, err
+		}
+	}
+	if len(osEntry.Versions) > 0 {
+		if err := add("versions", SignalOutput, WeightRequired, osEntry.Versions...); err != nil {
+			return compiled, err
+		}
+	}
+	for n, signature := range osEntry.Signatures {
+		field, weight := signature.Field, signature.Weight
+		if field == "" {
+			field = SignalOutput
+		}
+		if weight == "" {
+			weight = WeightWeak
+		}
+		if err := add(fmt.Sprintf("signatures[%d]", n), field, weight, signature.Pattern); err != nil {
+			return compiled, err
+		}
+	}
+	return compiled, nil
+}
+
+// returns the highest score the entry can reach
+func (this compiledOS) maxScore() int {
+	score := 0
+	for _, group := range this.groups {
+		score += signatureScores[group.weight]
+	}
+	return score
+}
+
+// returns the probe commands of the entry
+func (this OS) probeCommands() []string {
+	if len(this.Probes) > 0 {
+		return this.Probes
+	}
+	return defaultProbes
+}
+
+/**
+ * Scores the entry against the signals.
+ *
+ * @param signals What is known about the device
+ * @param pending Fields not collected completely yet: their required signatures do not rule the OS out
+ * @return        The scored candidate, whether a required signature did not match,
+ *                and whether a required signature waits for a pending field
+ */
+func (this compiledOS) score(signals DetectionSignals, pending map[string]bool) (candidate Candidate, ruledOut bool, waiting bool) {
+	candidate = Candidate{Name: this.Name, Matched: []string{}}
+	for _, group := range this.groups {
+		value := signals.value(group.field)
+		matched := ""
+		for _, pattern := range group.patterns {
+			if pattern.MatchString(value) {
+				matched = pattern.String()
+				break
+			}
+		}
+		if matched == "" {
+			if group.weight == WeightRequired {
+				if !pending[group.field] {
+					return candidate, true, false
+				}
+				waiting = true
+			}
+			continue
+		}
+		candidate.Score += signatureScores[group.weight]
+		candidate.Matched = append(candidate.Matched, fmt.Sprintf("%s %s: %s", group.weight, group.field, matched))
+	}
+	candidate.Confidence = float64(candidate.Score) / fullConfidenceScore
+	if candidate.Confidence > 1 {
+		candidate.Confidence = 1
+	}
+	return candidate, false, waiting
+}
+
+/**
+ * Scores every OS of devices.json against the signals.
+ *
+ * @param signals What is known about the device
+ * @return        OSes with a score above zero whose required signatures all match, best first
+ *                (equal scores keep the order of devices.json)
+ */
+func (this *Client) DetectOS(signals DetectionSignals) []Candidate {
+	candidates := []Candidate{}
+	for _, osEntry := range this.signatures() {
+		candidate, ruledOut, _ := osEntry.score(signals, nil)
+		if ruledOut || candidate.Score == 0 {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+/**
+ * Collects the output signal in stages instead of running the probes of every OS:
+ * the OSes are ranked on what is known, the next probe of the best candidate that has one left is run
+ * and the OSes are ranked again, until the best candidate reaches Client.MinConfidence with all its
+ * required signatures known, or no probe is left.
+ *
+ * @param ctx     Context of the detection
+ * @param signals Signals known before running any command (SSH version, banner, prompt)
+ * @return        The signals with the output of the probes that were run, the context error when cancelled
+ */
+func (this *SSHSession) probe(ctx context.Context, signals DetectionSignals) (DetectionSignals, error) {
+	type ranked struct {
+		candidate Candidate
+		waiting   bool
+		probes    []string
+	}
+	probed := map[string]bool{}
+	for {
+		ranking := []ranked{}
+		for _, osEntry := range this.client.signatures() {
+			probes := osEntry.probeCommands()
+			complete := true
+			for _, cmd := range probes {
+				complete = complete && probed[cmd]
+			}
+			candidate, ruledOut, waiting := osEntry.score(signals, map[string]bool{SignalOutput: !complete})
+			if !ruledOut {
+				ranking = append(ranking, ranked{candidate, waiting, probes})
+			}
+		}
+		sort.SliceStable(ranking, func(i, j int) bool {
+			return ranking[i].candidate.Score > ranking[j].candidate.Score
+		})
+		if len(ranking) > 0 && !ranking[0].waiting && ranking[0].candidate.Confidence >= this.client.MinConfidence {
+			return signals, nil
+		}
+		next := ""
+		for _, entry := range ranking {
+			for _, cmd := range entry.probes {
+				if !probed[cmd] {
+					next = cmd
+					break
+				}
+			}
+			if next != "" {
+				this.client.LogDebug("Probe '%s' for %s (score %d)", next, entry.candidate.Name, entry.candidate.Score)
+				break
+			}
+		}
+		if next == "" {
+			return signals, nil
+		}
+		probed[next] = true
+		// Each probe returns as soon as the prompt reappears, pagination prompts are answered while reading.
+		if err := this.WriteChannelContext(ctx, next); err != nil {
+			return signals, err
+		}
+		output, err := this.ReadChannelPromptContext(ctx, probeTimeout)
+		signals.Output += output
+		if ctx.Err() != nil {
+			return signals, ctx.Err()
+		}
+		if err != nil {
+			this.client.LogDebug("GetSSHBrand probe '%s' err:%s", next, err.Error())
+		}
+	}
+}
+
+/**
+ * Returns the OS detected from the ranked candidates.
+ *
+ * @param candidates Candidates ranked by DetectOS
+ * @return           The best candidate if its confidence reaches MinConfidence, nil otherwise
+ */
+func (this *Client) detectedOS(candidates []Candidate) *Candidate {
+	if len(candidates) == 0 || candidates[0].Confidence < this.MinConfidence {
+		return nil
+	}
+	if len(candidates) > 1 && candidates[1].Score == candidates[0].Score {
+		this.LogDebug("Detection ambiguous between %s and %s, using the first", candidates[0].Name, candidates[1].Name)
+	}
+	return &candidates[0]
+}
+
+// describes the candidates for logs and the CLI, e.g. "Cisco IOS 100% (strong output: ...), Cisco IOS XE 17%"
+func FormatCandidates(candidates []Candidate) string {
+	parts := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		parts = append(parts, fmt.Sprintf("%s %.0f%% (%s)", candidate.Name, candidate.Confidence*100, strings.Join(candidate.Matched, ", ")))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,267 @@
+package switchssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+// OS data of the detection tests: equal scores keep this order
+var detectOSData = []OS{
+	{Name: "Cisco IOS", Probes: CommandList{"show version"}, Signatures: []Signature{
+		{Field: SignalSSHVersion, Pattern: `^SSH-2\.0-Cisco`, Weight: WeightStrong},
+		{Pattern: `Cisco IOS Software`, Weight: WeightStrong},
+		{Field: SignalPrompt, Pattern: `#$`},
+	}},
+	{Name: "Cisco IOS XE", Probes: CommandList{"show version"}, Signatures: []Signature{
+		{Pattern: `IOS[ -]XE`, Weight: WeightRequired},
+		{Field: SignalSSHVersion, Pattern: `^SSH-2\.0-Cisco`, Weight: WeightStrong},
+		{Pattern: `Cisco IOS Software`, Weight: WeightStrong},
+	}},
+	{Name: "Huawei VRP", Probes: CommandList{"display version"}, Signatures: []Signature{
+		{Pattern: `Huawei Versatile Routing Platform`, Weight: WeightStrong},
+		{Field: SignalPrompt, Pattern: `^<[^>]+>$`, Weight: WeightStrong},
+		{Field: SignalBanner, Pattern: `Huawei`},
+	}},
+	{Name: "H3C Comware", Probes: CommandList{"display version"}, Signatures: []Signature{
+		{Pattern: `H3C Comware`, Weight: WeightStrong},
+		{Field: SignalPrompt, Pattern: `^<[^>]+>$`, Weight: WeightStrong},
+	}},
+	// Models and versions of earlier files, probed with the default probes
+	{Name: "Legacy", Models: []string{`WS-C2960`}, Versions: []string{`Version 12\.2`}},
+}
+
+func newDetectClient(t *testing.T) *Client {
+	client := newTestClient(t)
+	t.Cleanup(func() { client.Close() })
+	if err := client.SetOSData(detectOSData); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// describes the candidates as "name score confidence"
+func candidateScores(candidates []Candidate) []string {
+	scores := []string{}
+	for _, candidate := range candidates {
+		scores = append(scores, fmt.Sprintf("%s %d %.2f", candidate.Name, candidate.Score, candidate.Confidence))
+	}
+	return scores
+}
+
+func TestDetectOS(t *testing.T) {
+	client := newDetectClient(t)
+	for _, test := range []struct {
+		name     string
+		signals  DetectionSignals
+		expected []string
+		detected string
+	}{
+		{"two strong and a weak signature", DetectionSignals{SSHVersion: "SSH-2.0-Cisco-1.25", Prompt: "sw1#", Output: "Cisco IOS Software, C2960X Software"},
+			[]string{"Cisco IOS 7 1.00"}, "Cisco IOS"},
+		// The required signature matches: more signatures match than for Cisco IOS
+		{"required signature", DetectionSignals{SSHVersion: "SSH-2.0-Cisco-1.25", Prompt: "sw1#", Output: "Cisco IOS Software [Bengaluru], IOS-XE Software"},
+			[]string{"Cisco IOS XE 9 1.00", "Cisco IOS 7 1.00"}, "Cisco IOS XE"},
+		{"required signature alone", DetectionSignals{Output: "IOS XE"},
+			[]string{"Cisco IOS XE 3 0.50"}, "Cisco IOS XE"},
+		{"one strong signature", DetectionSignals{SSHVersion: "SSH-2.0-Cisco-1.25"},
+			[]string{"Cisco IOS 3 0.50"}, "Cisco IOS"},
+		{"weak signature only", DetectionSignals{Prompt: "sw1#"},
+			[]string{"Cisco IOS 1 0.17"}, ""},
+		{"strong and weak signatures", DetectionSignals{Prompt: "<sw1>", Banner: "Huawei Technologies"},
+			[]string{"Huawei VRP 4 0.67", "H3C Comware 3 0.50"}, "Huawei VRP"},
+		// Equal scores keep the order of the OS data
+		{"tie", DetectionSignals{Prompt: "<sw1>"},
+			[]string{"Huawei VRP 3 0.50", "H3C Comware 3 0.50"}, "Huawei VRP"},
+		{"tie broken by the output", DetectionSignals{Prompt: "<sw1>", Output: "H3C Comware Software, Version 7.1.070"},
+			[]string{"H3C Comware 6 1.00", "Huawei VRP 3 0.50"}, "H3C Comware"},
+		{"models and versions", DetectionSignals{Output: "cisco WS-C2960X-48TS-L\nVersion 12.2(55)SE"},
+			[]string{"Legacy 6 1.00"}, "Legacy"},
+		{"model without version", DetectionSignals{Output: "cisco WS-C2960X-48TS-L\nVersion 15.2(7)E"},
+			[]string{}, ""},
+		{"nothing known", DetectionSignals{}, []string{}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			candidates := client.DetectOS(test.signals)
+			if scores := candidateScores(candidates); !reflect.DeepEqual(scores, test.expected) {
+				t.Errorf("candidates %v, expected %v", scores, test.expected)
+			}
+			detected := ""
+			if best := client.detectedOS(candidates); best != nil {
+				detected = best.Name
+			}
+			if detected != test.detected {
+				t.Errorf("detected %q, expected %q", detected, test.detected)
+			}
+		})
+	}
+}
+
+func TestDetectOSMinConfidence(t *testing.T) {
+	client := newDetectClient(t)
+	candidates := client.DetectOS(DetectionSignals{SSHVersion: "SSH-2.0-Cisco-1.25", Prompt: "sw1#"})
+	if scores := candidateScores(candidates); !reflect.DeepEqual(scores, []string{"Cisco IOS 4 0.67"}) {
+		t.Fatalf("candidates %v", scores)
+	}
+	if matched := candidates[0].Matched; !reflect.DeepEqual(matched, []string{"strong ssh-version: ^SSH-2\\.0-Cisco", "weak prompt: #$"}) {
+		t.Errorf("matched %q", matched)
+	}
+	for _, test := range []struct {
+		minConfidence float64
+		detected      bool
+	}{
+		{0.5, true},
+		{4.0 / fullConfidenceScore, true},
+		{0.7, false},
+		{1, false},
+	} {
+		client.MinConfidence = test.minConfidence
+		if detected := client.detectedOS(candidates) != nil; detected != test.detected {
+			t.Errorf("minimum confidence %.2f: detected %t, expected %t", test.minConfidence, detected, test.detected)
+		}
+	}
+}
+
+func TestSignatureScore(t *testing.T) {
+	compiled, err := compileSignatures(detectOSData[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxScore := compiled.maxScore(); maxScore != 9 {
+		t.Errorf("highest score %d, expected 9", maxScore)
+	}
+	signals := DetectionSignals{SSHVersion: "SSH-2.0-Cisco-1.25"}
+	// The output is not known yet: the required signature waits for it
+	candidate, ruledOut, waiting := compiled.score(signals, map[string]bool{SignalOutput: true})
+	if ruledOut || !waiting || candidate.Score != 3 {
+		t.Errorf("pending output: %+v ruled out %t waiting %t", candidate, ruledOut, waiting)
+	}
+	candidate, ruledOut, waiting = compiled.score(signals, nil)
+	if !ruledOut || waiting {
+		t.Errorf("known output: %+v ruled out %t waiting %t", candidate, ruledOut, waiting)
+	}
+	signals.Output = "Cisco IOS XE Software"
+	candidate, ruledOut, waiting = compiled.score(signals, nil)
+	if ruledOut || waiting || candidate.Score != 6 || candidate.Confidence != 1 {
+		t.Errorf("matching output: %+v ruled out %t waiting %t", candidate, ruledOut, waiting)
+	}
+}
+
+// session of a device answering the commands with the given outputs ("% Unknown command" for others),
+// returns the session and the list of the commands the device received
+func newProbeSession(t *testing.T, client *Client, answers map[string]string) (*SSHSession, func() []string) {
+	session := &SSHSession{client: client, in: make(chan string, 1), out: make(chan string), prompt: regexp.MustCompile(`^sw1#$`)}
+	locker := sync.Mutex{}
+	received := []string{}
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		for {
+			select {
+			case cmd := <-session.in:
+				locker.Lock()
+				received = append(received, cmd)
+				locker.Unlock()
+				answer, ok := answers[cmd]
+				if !ok {
+					answer = "% Unknown command"
+				}
+				select {
+				case session.out <- cmd + "\r\n" + answer + "\r\nsw1#":
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return session, func() []string {
+		locker.Lock()
+		defer locker.Unlock()
+		return append([]string{}, received...)
+	}
+}
+
+func TestProbeStages(t *testing.T) {
+	answers := map[string]string{
+		"show version":    "Cisco IOS Software, C2960X Software, Version 15.2(7)E",
+		"display version": "Huawei Versatile Routing Platform Software\r\nVRP (R) software, Version 5.170",
+	}
+	for _, test := range []struct {
+		name          string
+		minConfidence float64
+		signals       DetectionSignals
+		answers       map[string]string
+		probes        []string
+		detected      string
+	}{
+		{"confident without probing", 0.5, DetectionSignals{SSHVersion: "SSH-2.0-Cisco-1.25", Prompt: "sw1#"},
+			answers, []string{}, "Cisco IOS"},
+		{"probe of the best candidate", 0.8, DetectionSignals{SSHVersion: "SSH-2.0-Cisco-1.25", Prompt: "sw1#"},
+			answers, []string{"show version"}, "Cisco IOS"},
+		{"probe of the best candidate in the prompt tie", 0.8, DetectionSignals{Prompt: "<sw1>"},
+			answers, []string{"display version"}, "Huawei VRP"},
+		// The probe of the first entry fails, the next candidate's probe runs
+		{"next stage", 0.5, DetectionSignals{},
+			map[string]string{"display version": answers["display version"]}, []string{"show version", "display version"}, "Huawei VRP"},
+		// Each probe runs once, the probes of entries declaring none are the default ones
+		{"nothing detected", 0.5, DetectionSignals{},
+			map[string]string{}, []string{"show version", "display version", "dis version", "show inventory", "show system"}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := newDetectClient(t)
+			client.MinConfidence = test.minConfidence
+			session, received := newProbeSession(t, client, test.answers)
+			signals, err := session.probe(context.Background(), test.signals)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if probes := received(); !reflect.DeepEqual(probes, test.probes) {
+				t.Errorf("probes %q, expected %q", probes, test.probes)
+			}
+			detected := ""
+			if best := client.detectedOS(client.DetectOS(signals)); best != nil {
+				detected = best.Name
+			}
+			if detected != test.detected {
+				t.Errorf("detected %q, expected %q (%s)", detected, test.detected, FormatCandidates(client.DetectOS(signals)))
+			}
+		})
+	}
+}
+
+func TestProbeWaitsForRequiredSignature(t *testing.T) {
+	// The required signature of Cisco IOS XE needs the output: the SSH version alone makes it a candidate
+	// as good as Cisco IOS, the probe rules it out
+	client := newDetectClient(t)
+	client.MinConfidence = 0.5
+	if err := client.SetOSData([]OS{detectOSData[1], detectOSData[0]}); err != nil {
+		t.Fatal(err)
+	}
+	session, received := newProbeSession(t, client, map[string]string{"show version": "Cisco IOS Software, C2960X Software"})
+	signals, err := session.probe(context.Background(), DetectionSignals{SSHVersion: "SSH-2.0-Cisco-1.25"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probes := received(); !reflect.DeepEqual(probes, []string{"show version"}) {
+		t.Errorf("probes %q", probes)
+	}
+	if scores := candidateScores(client.DetectOS(signals)); !reflect.DeepEqual(scores, []string{"Cisco IOS 6 1.00"}) {
+		t.Errorf("candidates %v", scores)
+	}
+}
+
+func TestProbeCancel(t *testing.T) {
+	client := newDetectClient(t)
+	session, _ := newProbeSession(t, client, map[string]string{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := session.probe(ctx, DetectionSignals{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
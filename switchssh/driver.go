@@ -0,0 +1,344 @@
+package switchssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+/**
+ * Vendor specific behaviour of a device OS, looked up by the OS name detected from devices.json.
+ */
+type Driver interface {
+	// Name of the OS, as in devices.json
+	Name() string
+	// Regex of the prompt, empty keeps the prompt learned after login
+	PromptPattern() string
+	// Output lines by which the device reports a rejected command, nil uses CommandErrorPatterns
+	ErrorPatterns() []*regexp.Regexp
+	// Disables pagination for the session
+	DisablePager(ctx context.Context, session *SSHSession) error
+	// Enters privileged mode, the secret can be empty
+	Enable(ctx context.Context, session *SSHSession, secret string) error
+	// Enters configuration mode
+	EnterConfig(ctx context.Context, session *SSHSession) error
+	// Leaves configuration mode
+	ExitConfig(ctx context.Context, session *SSHSession) error
+	// Saves the running configuration
+	SaveConfig(ctx context.Context, session *SSHSession) error
+	// Ends the CLI session before the connection is closed
+	Logout(ctx context.Context, session *SSHSession) error
+	// Command of the named getter (see GetterNames), empty if the OS has none
+	Getter(name string) string
+}
+
+// Returned by drivers that do not support an operation.
+var ErrNotSupported = errors.New("not supported by the driver")
+
+// Prompts asking to confirm a command, answered by CommandDriver.
+var confirmPromptRegexp = regexp.MustCompile(`(?i)(\[y/n\]|\(y/n\)|\[yes/no\]|\(yes/no\)|\[confirm\]|continue\?)[^\r\n]*$`)
+
+// Time waited for the device to close the connection after the logout command.
+const logoutTimeout = 500 * time.Millisecond
+
+/**
+ * Driver running fixed commands for each operation.
+ *
+ * @attr OSName     Name of the OS
+ * @attr Prompt     Regex of the prompt (can be empty)
+ * @attr Pager      Commands disabling pagination
+ * @attr EnableBy   Sequence entering privileged mode (nil when the login is already privileged)
+ * @attr Config     Commands entering configuration mode
+ * @attr EndConfig  Commands leaving configuration mode
+ * @attr Save       Commands saving the running configuration, confirmation questions are answered with Confirm
+ * @attr Confirm    Answer to confirmation questions (default "y")
+ * @attr Errors     Output lines by which the device reports a rejected command (nil uses CommandErrorPatterns)
+ * @attr Exit       Command ending the CLI session
+ * @attr Getters    Commands by getter name (see GetterNames)
+ * @attr MacFormat  Format of the output of the mac-table getter (see MacFormats), empty if it can not be parsed
+ * @attr LLDPFormat Format of the output of the lldp-neighbors getter (see LLDPFormats), empty if it can not be parsed
+ */
+type CommandDriver struct {
+	OSName     string
+	Prompt     string
+	Pager      []string
+	EnableBy   *EnableSequence
+	Config     []string
+	EndConfig  []string
+	Save       []string
+	Confirm    string
+	Errors     []*regexp.Regexp
+	Exit       string
+	Getters    map[string]string
+	MacFormat  string
+	LLDPFormat string
+}
+
+func (this *CommandDriver) Name() string {
+	return this.OSName
+}
+
+func (this *CommandDriver) PromptPattern() string {
+	return this.Prompt
+}
+
+func (this *CommandDriver) ErrorPatterns() []*regexp.Regexp {
+	return this.Errors
+}
+
+func (this *CommandDriver) Getter(name string) string {
+	return this.Getters[name]
+}
+
+func (this *CommandDriver) DisablePager(ctx context.Context, session *SSHSession) error {
+	return this.run(ctx, session, this.Pager)
+}
+
+func (this *CommandDriver) Enable(ctx context.Context, session *SSHSession, secret string) error {
+	if this.EnableBy == nil {
+		return nil
+	}
+	return session.EnableContext(ctx, *this.EnableBy, secret)
+}
+
+func (this *CommandDriver) EnterConfig(ctx context.Context, session *SSHSession) error {
+	if len(this.Config) == 0 {
+		return fmt.Errorf("configuration mode of %s: %w", this.OSName, ErrNotSupported)
+	}
+	return this.run(ctx, session, this.Config)
+}
+
+func (this *CommandDriver) ExitConfig(ctx context.Context, session *SSHSession) error {
+	return this.run(ctx, session, this.EndConfig)
+}
+
+func (this *CommandDriver) SaveConfig(ctx context.Context, session *SSHSession) error {
+	if len(this.Save) == 0 {
+		return fmt.Errorf("saving the configuration of %s: %w", this.OSName, ErrNotSupported)
+	}
+	answer := this.Confirm
+	if answer == "" {
+		answer = "y"
+	}
+	for _, cmd := range this.Save {
+		result, err := session.execConfirmed(ctx, cmd, answer)
+		if err != nil {
+			return err
+		}
+		if err := result.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *CommandDriver) Logout(ctx context.Context, session *SSHSession) error {
+	if this.Exit == "" {
+		return nil
+	}
+	if err := session.WriteChannelContext(ctx, this.Exit); err != nil {
+		return err
+	}
+	// Give the device a moment to close the connection by itself
+	if !session.waitHangup(ctx, logoutTimeout) {
+		session.client.LogDebug("Device did not close the connection after '%s'", this.Exit)
+	}
+	return nil
+}
+
+/**
+ * Executes the commands one by one, failing on the first one the device rejects.
+ */
+func (this *CommandDriver) run(ctx context.Context, session *SSHSession, cmds []string) error {
+	for _, cmd := range cmds {
+		result, err := session.ExecCommandContext(ctx, cmd, session.client.CommandTimeout)
+		if err != nil {
+			return err
+		}
+		if err := result.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * Executes a command, answering its confirmation questions until the prompt reappears.
+ *
+ * @param ctx    Context of the command
+ * @param cmd    Command to execute
+ * @param answer Answer to the confirmation questions
+ * @return       The command result and execution errors
+ */
+func (this *SSHSession) execConfirmed(ctx context.Context, cmd string, answer string) (CommandResult, error) {
+	result := CommandResult{Command: cmd, StartTime: time.Now()}
+	prompt := this.prompt
+	if prompt == nil {
+		prompt = defaultPromptRegexp
+	}
+	promptOrConfirm := regexp.MustCompile("(?:" + prompt.String() + ")|(?:" + confirmPromptRegexp.String() + ")")
+	if err := this.WriteChannelContext(ctx, cmd); err != nil {
+		return result, err
+	}
+	output := ""
+	for i := 0; i < 3; i++ {
+		part, err := this.readChannelRegexp(ctx, promptOrConfirm, this.client.CommandTimeout)
+		output += part
+		if err != nil {
+			result.EndTime = time.Now()
+			result.Output = cleanCommandOutput(output+"\n", cmd)
+			return result, withKind(ErrOutputTruncated, err)
+		}
+		if !confirmPromptRegexp.MatchString(lastLine(part)) || prompt.MatchString(lastLine(part)) {
+			break
+		}
+		this.client.LogDebug("Confirming '%s' with '%s'", lastLine(part), answer)
+		this.WriteChannelContext(ctx, answer)
+	}
+	result.EndTime = time.Now()
+	result.Output = cleanCommandOutput(output, cmd)
+	result.Failed = this.isCommandError(result.Output)
+	return result, nil
+}
+
+var (
+	drivers       = make(map[string]Driver)
+	driversLocker sync.RWMutex
+)
+
+/**
+ * Registers the driver under its OS name, replacing a driver registered before under that name.
+ * Drivers registered this way are used by all clients.
+ *
+ * @param driver Driver to register
+ */
+func RegisterDriver(driver Driver) {
+	registerDriverAlias(driver.Name(), driver)
+}
+
+func registerDriverAlias(name string, driver Driver) {
+	driversLocker.Lock()
+	defer driversLocker.Unlock()
+	drivers[name] = driver
+}
+
+/**
+ * Returns the driver registered for the OS name, or nil.
+ */
+func LookupDriver(name string) Driver {
+	driversLocker.RLock()
+	defer driversLocker.RUnlock()
+	return drivers[name]
+}
+
+/**
+ * Returns the driver of the OS. Drivers written in Go are used as registered. Otherwise the entry of the OS
+ * in devices.json declares the driver: its prompt, errors, enable sequence, configuration commands, save
+ * and logout commands, getters, MAC table and LLDP formats, replacing those of a CommandDriver registered under
+ * the same name, if any. The deprecated brand names (HUAWEI, CISCO_SM...) stand for their OS.
+ *
+ * @param name OS name
+ * @return     Driver and false if the OS is unknown
+ */
+func (this *Client) Driver(name string) (Driver, bool) {
+	if name == "" {
+		return nil, false
+	}
+	if osName, ok := driverAliases[name]; ok && LookupDriver(name) == nil {
+		name = osName
+	}
+	this.osLocker.Lock()
+	defer this.osLocker.Unlock()
+	if driver, ok := this.driverCache[name]; ok {
+		return driver, true
+	}
+	registered := LookupDriver(name)
+	var osEntry *OS
+	for i := range this.osData {
+		if this.osData[i].Name == name {
+			osEntry = &this.osData[i]
+			break
+		}
+	}
+	base, declarative := registered.(*CommandDriver)
+	if osEntry == nil || (registered != nil && !declarative) {
+		return registered, registered != nil
+	}
+	driver := &CommandDriver{OSName: osEntry.Name}
+	if base != nil {
+		*driver = *base
+	}
+	this.overlayDriver(driver, *osEntry)
+	if this.driverCache == nil {
+		this.driverCache = make(map[string]Driver)
+	}
+	this.driverCache[name] = driver
+	return driver, true
+}
+
+/**
+ * Replaces the parts of the driver declared by the OS entry.
+ */
+func (this *Client) overlayDriver(driver *CommandDriver, osEntry OS) {
+	if osEntry.Prompt != "" {
+		driver.Prompt = osEntry.Prompt
+	}
+	if osEntry.Pager != "" {
+		driver.Pager = []string{osEntry.Pager}
+	}
+	if osEntry.Enable != nil {
+		driver.EnableBy = osEntry.Enable
+	}
+	if len(osEntry.Errors) > 0 {
+		driver.Errors = nil
+		for _, pattern := range osEntry.Errors {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				this.LogError("OS %s: invalid error regex %q: %s", osEntry.Name, pattern, err)
+				continue
+			}
+			driver.Errors = append(driver.Errors, re)
+		}
+	}
+	if len(osEntry.ConfigEnter) > 0 {
+		driver.Config = osEntry.ConfigEnter
+		driver.EndConfig = osEntry.ConfigExit
+	}
+	if len(osEntry.Save) > 0 {
+		driver.Save = osEntry.Save
+	}
+	if osEntry.Logout != "" {
+		driver.Exit = osEntry.Logout
+	}
+	getters := make(map[string]string)
+	for name, cmd := range driver.Getters {
+		getters[name] = cmd
+	}
+	// mac-addr-list is the mac-table getter of earlier devices.json files
+	if osEntry.MacAddrComm != "" {
+		getters[GetterMacTable] = osEntry.MacAddrComm
+	}
+	for name, cmd := range osEntry.Getters {
+		getters[name] = cmd
+	}
+	driver.Getters = getters
+	if osEntry.MacFormat != "" {
+		driver.MacFormat = osEntry.MacFormat
+	}
+	if osEntry.LLDPFormat != "" {
+		driver.LLDPFormat = osEntry.LLDPFormat
+	}
+}
+
+// DEPRECATED: brand names of earlier versions and the OS of devices.json they stand for
+var driverAliases = map[string]string{
+	HUAWEI:    "Huawei VRP",
+	H3C:       "H3C Comware",
+	CISCO_SM:  "Cisco SBOS",
+	CISCO_SM1: "Cisco SBOS",
+	CISCO_SM2: "Cisco SBOS",
+	ARUBA_CX:  "Aruba CX",
+}
@@ -0,0 +1,56 @@
+package switchssh
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDriversFromDevicesJSON(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+	if _, ok := client.Driver("Cisco IOS"); ok {
+		t.Error("driver found before loading devices.json")
+	}
+	if err := client.LoadOSData("../devices.json"); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name   string
+		osName string
+		getter string
+	}{
+		{"Cisco IOS", "Cisco IOS", "show mac address-table"},
+		{"Aruba CX", "Aruba CX", "show mac-address-table"},
+		{HUAWEI, "Huawei VRP", "display mac-address"},
+		{CISCO_SM1, "Cisco SBOS", "show mac address-table"},
+	} {
+		driver, ok := client.Driver(test.name)
+		if !ok {
+			t.Errorf("%s: no driver", test.name)
+			continue
+		}
+		if driver.Name() != test.osName {
+			t.Errorf("%s: driver of %s, expected %s", test.name, driver.Name(), test.osName)
+		}
+		if cmd := driver.Getter(GetterMacTable); cmd != test.getter {
+			t.Errorf("%s: mac-table getter %q, expected %q", test.name, cmd, test.getter)
+		}
+	}
+}
+
+func TestValidateOSDataMacAddrListConflict(t *testing.T) {
+	osData := []OS{{
+		Name:        "Aruba CX",
+		Signatures:  []Signature{{Pattern: "ArubaOS-CX"}},
+		MacAddrComm: "show mac-address",
+		Getters:     map[string]string{GetterMacTable: "show mac-address-table"},
+	}}
+	err := ValidateOSData(osData)
+	if err == nil || !strings.Contains(err.Error(), "mac-addr-list") {
+		t.Errorf("conflicting mac-addr-list accepted: %v", err)
+	}
+	osData[0].MacAddrComm = "show mac-address-table"
+	if err := ValidateOSData(osData); err != nil {
+		t.Errorf("matching mac-addr-list refused: %s", err)
+	}
+}
@@ -0,0 +1,137 @@
+package switchssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Returned when the device refuses to enter privileged mode.
+var ErrEnableFailed = errors.New("unable to enter privileged mode")
+
+// Password prompt expected when the enable sequence does not declare one.
+const DefaultEnablePasswordPrompt = `(?i)password:\s*$`
+
+/**
+ * Sequence for entering privileged mode, declared per OS in devices.json.
+ *
+ * @attr Command        Command entering privileged mode (enable, super)
+ * @attr PasswordPrompt Regex of the prompt asking for the enable secret
+ * @attr SuccessPrompt  Regex the prompt matches once in privileged mode, a session already matching it is not escalated
+ * @attr SuccessOutput  Regex the command output must match, for devices whose prompt does not change
+ */
+type EnableSequence struct {
+	Command        string `json:"command"`
+	PasswordPrompt string `json:"password-prompt"`
+	SuccessPrompt  string `json:"success-prompt"`
+	SuccessOutput  string `json:"success-output"`
+}
+
+/**
+ * Enters privileged mode with the enable sequence of the OS.
+ * When the device asks for a secret and none is configured, the session stays unprivileged.
+ *
+ * @param sequence Enable sequence of the OS
+ * @param secret   Enable secret (can be empty)
+ * @return         ErrEnableFailed (wrapped) if the device refused the secret
+ */
+func (this *SSHSession) Enable(sequence EnableSequence, secret string) error {
+	return this.EnableContext(context.Background(), sequence, secret)
+}
+
+/**
+ * Same as Enable, but gives up when the context is cancelled.
+ *
+ * @param ctx      Context of the escalation
+ * @param sequence Enable sequence of the OS
+ * @param secret   Enable secret (can be empty)
+ * @return         ErrEnableFailed (wrapped) if the device refused the secret, the context error when cancelled
+ */
+func (this *SSHSession) EnableContext(ctx context.Context, sequence EnableSequence, secret string) error {
+	if sequence.Command == "" {
+		return nil
+	}
+	successPrompt, err := compileOptional(sequence.SuccessPrompt)
+	if err != nil {
+		return err
+	}
+	successOutput, err := compileOptional(sequence.SuccessOutput)
+	if err != nil {
+		return err
+	}
+	if sequence.PasswordPrompt == "" {
+		sequence.PasswordPrompt = DefaultEnablePasswordPrompt
+	}
+	passwordPrompt, err := regexp.Compile(sequence.PasswordPrompt)
+	if err != nil {
+		return fmt.Errorf("invalid enable password prompt %q: %s", sequence.PasswordPrompt, err)
+	}
+	if successPrompt != nil && successPrompt.MatchString(this.promptStr) {
+		this.client.LogDebug("Enable: already privileged at '%s'", this.promptStr)
+		return nil
+	}
+	passwordOrPrompt := regexp.MustCompile("(?:" + passwordPrompt.String() + ")|(?:" + this.prompt.String() + ")")
+
+	this.WriteChannel(sequence.Command)
+	output, err := this.readChannelRegexp(ctx, passwordOrPrompt, this.client.CommandTimeout)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrEnableFailed, err)
+	}
+	if passwordPrompt.MatchString(lastLine(output)) {
+		if secret == "" {
+			this.client.LogDebug("Enable: secret requested but none configured, staying unprivileged")
+			return this.abortEnable(ctx, passwordOrPrompt, passwordPrompt)
+		}
+		this.WriteChannel(secret)
+		output, err = this.readChannelRegexp(ctx, passwordOrPrompt, this.client.CommandTimeout)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrEnableFailed, err)
+		}
+		if passwordPrompt.MatchString(lastLine(output)) {
+			this.abortEnable(ctx, passwordOrPrompt, passwordPrompt)
+			return fmt.Errorf("%w: secret refused", ErrEnableFailed)
+		}
+	}
+	promptStr := lastLine(output)
+	if this.isCommandError(output) ||
+		(successPrompt != nil && !successPrompt.MatchString(promptStr)) ||
+		(successOutput != nil && !successOutput.MatchString(output)) {
+		return fmt.Errorf("%w: device answered %q", ErrEnableFailed, strings.TrimSpace(cleanCommandOutput(output, sequence.Command)))
+	}
+	this.promptStr = promptStr
+	this.client.LogDebug("Enable: privileged prompt '%s'", promptStr)
+	return nil
+}
+
+/**
+ * Answers the remaining password prompts with empty lines until the device returns to the prompt.
+ */
+func (this *SSHSession) abortEnable(ctx context.Context, passwordOrPrompt, passwordPrompt *regexp.Regexp) error {
+	for i := 0; i < 3; i++ {
+		this.WriteChannel("")
+		output, err := this.readChannelRegexp(ctx, passwordOrPrompt, this.client.CommandTimeout)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrEnableFailed, err)
+		}
+		if !passwordPrompt.MatchString(lastLine(output)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: device keeps asking for the secret", ErrEnableFailed)
+}
+
+/**
+ * Compiles the regex, an empty pattern gives nil.
+ */
+func compileOptional(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enable regex %q: %s", pattern, err)
+	}
+	return re, nil
+}
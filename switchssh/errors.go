@@ -0,0 +1,97 @@
+package switchssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Kinds of failures, matched with errors.Is against the errors returned by the library.
+// The original error stays in the chain, so errors.Is(err, syscall.ECONNREFUSED) and the like keep working.
+var (
+	// The device name does not resolve, or the device or its network cannot be reached (connection refused included).
+	ErrUnreachable = errors.New("device unreachable")
+	// The TCP connection or the SSH handshake did not complete within the dial timeout.
+	ErrConnectTimeout = errors.New("connection timed out")
+	// The device refused all credentials (see AuthError).
+	ErrAuthFailed = errors.New("authentication failed")
+	// The host key is unknown under the strict policy or differs from the recorded one (see HostKeyChangedError, HostKeyUnknownError).
+	ErrHostKey = errors.New("host key verification failed")
+	// The device accepted the login but refused the session, the PTY or the shell.
+	ErrNoShell = errors.New("shell refused")
+	// No prompt was recognized after the login.
+	ErrPromptNotFound = errors.New("prompt not found")
+	// The device answered a command with an error message (see CommandErrorPatterns and CommandResult.Err).
+	ErrCommandRejected = errors.New("command rejected by device")
+	// The prompt did not reappear after a command, the output read so far is incomplete.
+	ErrOutputTruncated = errors.New("output truncated")
+)
+
+func (this *AuthError) Is(target error) bool {
+	return target == ErrAuthFailed
+}
+
+func (this *HostKeyChangedError) Is(target error) bool {
+	return target == ErrHostKey
+}
+
+func (this *HostKeyUnknownError) Is(target error) bool {
+	return target == ErrHostKey
+}
+
+/**
+ * Adds the kind of failure to an error of dialing or of the SSH handshake.
+ * Context errors, authentication and host key errors are returned unchanged.
+ *
+ * @param ctx Context of the connection
+ * @param err Error of the connection
+ * @return    The error, wrapped with ErrUnreachable or ErrConnectTimeout when it is one of them
+ */
+func classifyDialError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != nil || errors.Is(err, ErrUnreachable) || errors.Is(err, ErrConnectTimeout) {
+		return err
+	}
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr) && !dnsErr.IsTimeout,
+		isConnectionRefused(err), errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return fmt.Errorf("%w: %w", ErrUnreachable, err)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrConnectTimeout, err)
+	}
+	return err
+}
+
+/**
+ * Checks if the port of the device refused the connection, directly or behind a jump host,
+ * which answers the forwarding request with a connect failure then.
+ */
+func isConnectionRefused(err error) bool {
+	var channelErr *ssh.OpenChannelError
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.As(err, &channelErr) && channelErr.Reason == ssh.ConnectionFailed
+}
+
+/**
+ * Wraps the error with the kind of failure, unless it is nil, a context error or already of that kind.
+ */
+func withKind(kind error, err error) error {
+	if err == nil || errors.Is(err, kind) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+/**
+ * Returns ErrCommandRejected (wrapped) if the device rejected the command, nil otherwise.
+ */
+func (this CommandResult) Err() error {
+	if !this.Failed {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrCommandRejected, this.Command)
+}
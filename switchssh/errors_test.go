@@ -0,0 +1,69 @@
+package switchssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// error of net.Dialer for the system call error
+func dialError(err error) error {
+	return &net.OpError{Op: "dial", Net: "tcp", Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}, Err: os.NewSyscallError("connect", err)}
+}
+
+func TestClassifyDialError(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	timeout := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	authErr := &authRefusedError{err: errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]")}
+	for _, test := range []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		kind     error
+		original error
+	}{
+		{"connection refused", context.Background(), dialError(syscall.ECONNREFUSED), ErrUnreachable, syscall.ECONNREFUSED},
+		{"host unreachable", context.Background(), fmt.Errorf("jump host 10.0.0.9:22: %w", dialError(syscall.EHOSTUNREACH)), ErrUnreachable, syscall.EHOSTUNREACH},
+		{"network unreachable", context.Background(), dialError(syscall.ENETUNREACH), ErrUnreachable, syscall.ENETUNREACH},
+		{"unknown name", context.Background(), &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "sw9", IsNotFound: true}}, ErrUnreachable, nil},
+		{"refused behind a jump host", context.Background(), &ssh.OpenChannelError{Reason: ssh.ConnectionFailed, Message: "Connection refused"}, ErrUnreachable, nil},
+		{"dial timeout", context.Background(), timeout, ErrConnectTimeout, os.ErrDeadlineExceeded},
+		{"handshake timeout", context.Background(), fmt.Errorf("ssh: handshake failed: %w", timeout), ErrConnectTimeout, os.ErrDeadlineExceeded},
+		{"name resolution timeout", context.Background(), &net.DNSError{Err: "i/o timeout", Name: "sw9", IsTimeout: true}, ErrConnectTimeout, nil},
+		// Unchanged
+		{"authentication", context.Background(), authErr, ErrAuthFailed, nil},
+		{"host key", context.Background(), &HostKeyChangedError{Host: "10.0.0.1:22"}, ErrHostKey, nil},
+		{"forwarding prohibited", context.Background(), &ssh.OpenChannelError{Reason: ssh.Prohibited}, nil, nil},
+		{"canceled", canceled, dialError(syscall.ECONNREFUSED), nil, syscall.ECONNREFUSED},
+		{"canceled during the handshake", canceled, fmt.Errorf("ssh: handshake failed: %w", context.Canceled), context.Canceled, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := classifyDialError(test.ctx, test.err)
+			for _, kind := range []error{ErrUnreachable, ErrConnectTimeout, ErrAuthFailed, ErrHostKey, context.Canceled} {
+				if errors.Is(err, kind) != (kind == test.kind) {
+					t.Errorf("errors.Is(%v, %v) is %t", err, kind, kind != test.kind)
+				}
+			}
+			if test.kind != ErrUnreachable && test.kind != ErrConnectTimeout && err != test.err {
+				t.Errorf("error changed to %v", err)
+			}
+			if test.original != nil && !errors.Is(err, test.original) {
+				t.Errorf("%v lost from the chain of %v", test.original, err)
+			}
+			// Classifying twice does not wrap again
+			if again := classifyDialError(test.ctx, err); again != err {
+				t.Errorf("classified again: %v", again)
+			}
+		})
+	}
+	if err := classifyDialError(context.Background(), nil); err != nil {
+		t.Errorf("nil classified as %v", err)
+	}
+}
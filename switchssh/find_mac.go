@@ -0,0 +1,299 @@
+package switchssh
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Interfaces aggregating links: port channels, LAGs and trunks never lead to an end device
+var aggregateInterfaceRegexp = regexp.MustCompile(`(?i)^(po|port-channel|eth-trunk|bagg|bridge-aggregation|lag|trk|ae)\s*\d`)
+
+// Interfaces of the switch itself, where its own MAC addresses are
+var internalInterfaceRegexp = regexp.MustCompile(`(?i)^(cpu|sup-eth|switch|router|vlanif|vlan-interface|0$)`)
+
+/**
+ * Normalizes a searched MAC address or OUI prefix to lowercase hex digits without separators.
+ *
+ * @param value MAC address (any separators) or its first three bytes (00:50:56, 0050.56, 005056)
+ * @return      12 hex digits for a MAC address, 6 for an OUI prefix, an error for other values
+ */
+func ParseMACQuery(value string) (string, error) {
+	digits := strings.NewReplacer(".", "", ":", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(value)))
+	if len(digits) != 12 && len(digits) != 6 {
+		return "", fmt.Errorf("%q is neither a MAC address nor an OUI prefix", value)
+	}
+	for _, c := range digits {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return "", fmt.Errorf("%q is neither a MAC address nor an OUI prefix", value)
+		}
+	}
+	return digits, nil
+}
+
+// Interface types by the names and abbreviations vendors use for them
+var interfaceTypeAliases = map[string]string{
+	"fastethernet":              "fa",
+	"fe":                        "fa",
+	"gigabitethernet":           "gi",
+	"gig":                       "gi",
+	"ge":                        "gi",
+	"twogigabitethernet":        "tw",
+	"fivegigabitethernet":       "fi",
+	"tengigabitethernet":        "te",
+	"tengige":                   "te",
+	"xgigabitethernet":          "te",
+	"xge":                       "te",
+	"10ge":                      "te",
+	"twentyfivegige":            "twe",
+	"twentyfivegigabitethernet": "twe",
+	"25ge":                      "twe",
+	"fortygigabitethernet":      "fo",
+	"fortygige":                 "fo",
+	"40ge":                      "fo",
+	"hundredgige":               "hu",
+	"hundredgigabitethernet":    "hu",
+	"100ge":                     "hu",
+	"ethernet":                  "eth",
+	"et":                        "eth",
+	"port-channel":              "po",
+}
+
+/**
+ * Returns a key identifying an interface regardless of how the vendor abbreviates it: the type, with its known
+ * names and abbreviations merged, and the numbers. Gi1/0/1, GigabitEthernet1/0/1 and GE1/0/1 are the same,
+ * Te1/0/1, Tw1/0/1 and Twe1/0/1 are not.
+ *
+ * @param name Interface name
+ * @return     Key of the interface
+ */
+func InterfaceKey(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	// Huawei names the types of fast ports by their speed: 10GE1/0/1, 100GE1/0/1
+	letters := strings.IndexFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+	if letters < 0 {
+		return name
+	}
+	numbers := strings.IndexAny(name[letters:], "0123456789")
+	if numbers <= 0 {
+		return name
+	}
+	numbers += letters
+	kind := strings.TrimSpace(name[:numbers])
+	if alias, ok := interfaceTypeAliases[kind]; ok {
+		kind = alias
+	}
+	return kind + strings.ReplaceAll(name[numbers:], " ", "")
+}
+
+// Formats of the output of the lldp-neighbors getter, for the lldp-format field of devices.json
+const (
+	LLDPFormatCiscoIOS   = "cisco-ios"
+	LLDPFormatCiscoSBOS  = "cisco-sbos"
+	LLDPFormatCiscoNXOS  = "cisco-nxos"
+	LLDPFormatArubaOS    = "arubaos"
+	LLDPFormatArubaCX    = "aruba-cx"
+	LLDPFormatHuaweiVRP  = "huawei-vrp"
+	LLDPFormatH3CComware = "h3c-comware"
+)
+
+// all LLDP formats, in the order they are documented
+var LLDPFormats = []string{LLDPFormatCiscoIOS, LLDPFormatCiscoSBOS, LLDPFormatCiscoNXOS, LLDPFormatArubaOS, LLDPFormatArubaCX, LLDPFormatHuaweiVRP, LLDPFormatH3CComware}
+
+// Local interface of each neighbor in the output of each format, the port of the neighbor is never matched
+var lldpLocalPortPatterns = map[string]*regexp.Regexp{
+	// show lldp neighbors detail: Local Intf: Gi1/0/1
+	LLDPFormatCiscoIOS: regexp.MustCompile(`(?m)^\s*Local Intf:\s*(\S+)`),
+	// show lldp neighbors: the local port is the first column of the table
+	LLDPFormatCiscoSBOS: regexp.MustCompile(`(?m)^([A-Za-z][^\s:,]*\d)\s`),
+	// show lldp neighbors detail: Local Port id: Eth1/1
+	LLDPFormatCiscoNXOS: regexp.MustCompile(`(?m)^\s*Local Port id:\s*(\S+)`),
+	// show lldp neighbor: the local interface is the first column of the table
+	LLDPFormatArubaOS: regexp.MustCompile(`(?m)^([A-Za-z][^\s:,]*\d)\s`),
+	// show lldp neighbor-info detail: Port : 1/1/1
+	LLDPFormatArubaCX: regexp.MustCompile(`(?m)^\s*Port\s*:\s*(\S+)`),
+	// display lldp neighbor: GigabitEthernet0/0/1 has 1 neighbor(s):
+	LLDPFormatHuaweiVRP: regexp.MustCompile(`(?m)^\s*(\S+) has \d+ neighbor`),
+	// display lldp neighbor-information: LLDP neighbor-information of port 1[GigabitEthernet1/0/1]:
+	LLDPFormatH3CComware: regexp.MustCompile(`(?m)^\s*LLDP neighbor-information of port \d+\[([^\]]+)\]`),
+}
+
+/**
+ * Returns the interfaces of the list that have LLDP neighbors, they lead to other network devices.
+ * Only the local interface of each neighbor is read from the output, compared with the interfaces by InterfaceKey.
+ *
+ * @param format     Format of the output (see LLDPFormats)
+ * @param output     Output of the lldp-neighbors getter
+ * @param interfaces Interface names, as in the MAC table
+ * @return           Set of the interface names (as given) that have LLDP neighbors, an error if the format is unknown
+ */
+func LLDPInterfaces(format string, output string, interfaces []string) (map[string]bool, error) {
+	pattern, ok := lldpLocalPortPatterns[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown LLDP format %q", format)
+	}
+	local := make(map[string]bool)
+	for _, match := range pattern.FindAllStringSubmatch(output, -1) {
+		local[InterfaceKey(match[1])] = true
+	}
+	found := make(map[string]bool)
+	for _, name := range interfaces {
+		if local[InterfaceKey(name)] {
+			found[name] = true
+		}
+	}
+	return found, nil
+}
+
+/**
+ * Implemented by drivers that can read the local interfaces from the output of their lldp-neighbors getter.
+ */
+type LLDPParser interface {
+	LLDPInterfaces(output string, interfaces []string) (map[string]bool, error)
+}
+
+func (this *CommandDriver) LLDPInterfaces(output string, interfaces []string) (map[string]bool, error) {
+	if this.LLDPFormat == "" {
+		return nil, fmt.Errorf("LLDP neighbors of %s: %w", this.OSName, ErrNotSupported)
+	}
+	return LLDPInterfaces(this.LLDPFormat, output, interfaces)
+}
+
+/**
+ * Returns the interfaces of the list that have LLDP neighbors, reading the output of the lldp-neighbors getter
+ * with the driver of the OS.
+ *
+ * @param osName     OS name from devices.json
+ * @param output     Output of the lldp-neighbors getter
+ * @param interfaces Interface names, as in the MAC table
+ * @return           Set of the interface names (as given) that have LLDP neighbors,
+ *                   ErrNotSupported if the driver of the OS cannot read LLDP neighbors
+ */
+func (this *Client) LLDPInterfacesOf(osName string, output string, interfaces []string) (map[string]bool, error) {
+	driver, _ := this.Driver(osName)
+	parser, ok := driver.(LLDPParser)
+	if !ok {
+		return nil, fmt.Errorf("LLDP neighbors of %s: %w", osName, ErrNotSupported)
+	}
+	return parser.LLDPInterfaces(output, interfaces)
+}
+
+/**
+ * MAC table of a device, with what is known about its uplinks.
+ *
+ * @attr Host      Host name of the device
+ * @attr OS        OS of the device
+ * @attr Entries   Parsed MAC table
+ * @attr LLDPPorts Interfaces with LLDP neighbors (see LLDPInterfacesOf), can be nil
+ */
+type DeviceMacTable struct {
+	Host      string
+	OS        string
+	Entries   []MacEntry
+	LLDPPorts map[string]bool
+}
+
+/**
+ * Port on which a searched MAC address was seen.
+ *
+ * @attr Query     Searched MAC address or OUI prefix, as given
+ * @attr MAC       MAC address found
+ * @attr Host      Device the MAC address was seen on
+ * @attr Interface Interface of the device
+ * @attr VLAN      VLAN of the entry
+ * @attr PortMACs  Number of MAC addresses learned on the interface
+ * @attr Uplink    Why the interface leads to other network devices, empty for edge ports
+ */
+type MacLocation struct {
+	Query     string `json:"query"`
+	MAC       string `json:"mac"`
+	Host      string `json:"host"`
+	Interface string `json:"interface"`
+	VLAN      int    `json:"vlan"`
+	PortMACs  int    `json:"port_macs"`
+	Uplink    string `json:"uplink,omitempty"`
+}
+
+/**
+ * Finds the searched MAC addresses in the MAC tables of the devices and ranks where each of them is connected.
+ * Ports are uplinks when they aggregate links, have LLDP neighbors or more than maxEdgeMACs MAC addresses;
+ * edge ports come first, ports with fewer MAC addresses before ports with more.
+ * The switch's own MAC addresses (CPU, VLAN interfaces) are not reported.
+ *
+ * @param tables      MAC tables of the devices
+ * @param queries     Searched MAC addresses or OUI prefixes (see ParseMACQuery)
+ * @param maxEdgeMACs Number of MAC addresses above which a port is considered an uplink
+ * @return            Sightings of each MAC address found, grouped by MAC address in the order of the queries,
+ *                    the most likely location first; an error if a query is invalid
+ */
+func LocateMACs(tables []DeviceMacTable, queries []string, maxEdgeMACs int) ([][]MacLocation, error) {
+	prefixes := make([]string, len(queries))
+	for i, query := range queries {
+		prefix, err := ParseMACQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		prefixes[i] = prefix
+	}
+	type sighting struct {
+		query int
+		mac   string
+	}
+	found := make(map[sighting][]MacLocation)
+	order := []sighting{}
+	for _, table := range tables {
+		portMACs := make(map[string]int)
+		for _, entry := range table.Entries {
+			portMACs[entry.Interface]++
+		}
+		for _, entry := range table.Entries {
+			if internalInterfaceRegexp.MatchString(entry.Interface) {
+				continue
+			}
+			digits := strings.ReplaceAll(entry.MAC, ":", "")
+			for i, prefix := range prefixes {
+				if !strings.HasPrefix(digits, prefix) {
+					continue
+				}
+				location := MacLocation{
+					Query:     queries[i],
+					MAC:       entry.MAC,
+					Host:      table.Host,
+					Interface: entry.Interface,
+					VLAN:      entry.VLAN,
+					PortMACs:  portMACs[entry.Interface],
+				}
+				switch {
+				case aggregateInterfaceRegexp.MatchString(entry.Interface):
+					location.Uplink = "aggregated link"
+				case table.LLDPPorts[entry.Interface]:
+					location.Uplink = "LLDP neighbor"
+				case location.PortMACs > maxEdgeMACs:
+					location.Uplink = fmt.Sprintf("%d MAC addresses", location.PortMACs)
+				}
+				key := sighting{i, entry.MAC}
+				if _, ok := found[key]; !ok {
+					order = append(order, key)
+				}
+				found[key] = append(found[key], location)
+				break
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].query < order[j].query
+	})
+	result := make([][]MacLocation, 0, len(order))
+	for _, key := range order {
+		locations := found[key]
+		sort.SliceStable(locations, func(i, j int) bool {
+			if (locations[i].Uplink == "") != (locations[j].Uplink == "") {
+				return locations[i].Uplink == ""
+			}
+			return locations[i].PortMACs < locations[j].PortMACs
+		})
+		result = append(result, locations)
+	}
+	return result, nil
+}
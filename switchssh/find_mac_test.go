@@ -0,0 +1,250 @@
+package switchssh
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Captured output of the lldp-neighbors getter of each format, the remote ports are local interfaces too
+var lldpSamples = []struct {
+	name   string
+	format string
+	output string
+	local  []string
+}{
+	{
+		name:   "Catalyst 9300",
+		format: LLDPFormatCiscoIOS,
+		output: `------------------------------------------------
+Local Intf: Gi1/0/48
+Chassis id: 0011.2233.4455
+Port id: Gi1/0/24
+Port Description: GigabitEthernet1/0/24
+System Name: core-sw1
+
+Time remaining: 98 seconds
+System Capabilities: B,R
+Enabled Capabilities: B,R
+------------------------------------------------
+Local Intf: Te1/1/1
+Chassis id: 0011.2233.4466
+Port id: Twe1/0/1
+System Name: dist-sw1
+
+Total entries displayed: 2
+`,
+		local: []string{"Gi1/0/48", "Te1/1/1"},
+	},
+	{
+		name:   "SG350",
+		format: LLDPFormatCiscoSBOS,
+		output: `
+System capability supported: Bridge, Router
+System capability enabled: Bridge, Router
+
+  Port        Device ID          Port ID         System Name    Capabilities  TTL
+--------- ----------------- ----------------- ----------------- ------------ -----
+gi1/0/49  00:11:22:33:44:55      gi1/0/24          core-sw1         B, R       91
+te1/0/1   00:11:22:33:44:66      gi1/0/1           dist-sw1         B          105
+`,
+		local: []string{"gi1/0/49", "te1/0/1"},
+	},
+	{
+		name:   "Nexus 9000",
+		format: LLDPFormatCiscoNXOS,
+		output: `Capability codes:
+  (R) Router, (B) Bridge, (T) Telephone, (C) DOCSIS Cable Device
+Device ID            Local Intf      Hold-time  Capability  Port ID
+
+Chassis id: 0011.2233.4455
+Port id: Ethernet1/24
+Local Port id: Eth1/49
+Port Description: Ethernet1/24
+System Name: spine1
+Time remaining: 101 seconds
+
+Total entries displayed: 1
+`,
+		local: []string{"Ethernet1/49"},
+	},
+	{
+		name:   "ArubaOS controller",
+		format: LLDPFormatArubaOS,
+		output: `
+Capability codes: (R)Router, (B)Bridge, (A)Access Point, (P)Phone, (O)Other
+LLDP Neighbor Information
+-------------------------
+Interface  Neighbor  Chassis ID         Port ID  Capability  Port Description
+---------  --------  ----------         -------  ----------  ----------------
+GE0/0/0    core-sw1  00:11:22:33:44:55  GE0/0/1  B:R         GigabitEthernet1/0/1
+
+Number of neighbors: 1
+`,
+		local: []string{"GE0/0/0"},
+	},
+	{
+		name:   "Aruba CX 6300",
+		format: LLDPFormatArubaCX,
+		output: `
+Port                           : 1/1/49
+Neighbor Entries               : 1
+Neighbor Chassis-Name          : core-sw1
+Neighbor Chassis-ID            : 00:11:22:33:44:55
+Neighbor Port-ID               : 1/1/1
+TTL                            : 120
+`,
+		local: []string{"1/1/49"},
+	},
+	{
+		name:   "Huawei S5700",
+		format: LLDPFormatHuaweiVRP,
+		output: `GigabitEthernet0/0/24 has 1 neighbor(s):
+
+Neighbor index :1
+Chassis type   :macAddress
+Chassis ID     :0011-2233-4455
+Port ID type   :interfaceName
+Port ID        :GigabitEthernet0/0/1
+Port description    :to-access
+System name         :core-sw1
+XGigabitEthernet0/0/1 has 0 neighbor(s)
+`,
+		local: []string{"GE0/0/24", "XGE0/0/1"},
+	},
+	{
+		name:   "H3C Comware 7",
+		format: LLDPFormatH3CComware,
+		output: `LLDP neighbor-information of port 24[GigabitEthernet1/0/24]:
+LLDP agent nearest-bridge:
+ LLDP neighbor index : 1
+ Chassis type        : MAC address
+ Chassis ID          : 0011-2233-4455
+ Port ID type        : Interface name
+ Port ID             : GigabitEthernet1/0/1
+ System name         : core-sw1
+`,
+		local: []string{"GigabitEthernet1/0/24"},
+	},
+}
+
+func TestLLDPInterfaces(t *testing.T) {
+	covered := map[string]bool{}
+	for _, sample := range lldpSamples {
+		covered[sample.format] = true
+		t.Run(sample.name, func(t *testing.T) {
+			// Interfaces named anywhere in the outputs, only the local ones have neighbors
+			interfaces := []string{"Gi1/0/1", "GigabitEthernet1/0/24", "Gi1/0/48", "Twe1/0/1", "Te1/1/1", "gi1/0/49", "te1/0/1",
+				"Ethernet1/24", "Ethernet1/49", "GE0/0/0", "GE0/0/1", "1/1/1", "1/1/49", "GE0/0/24", "XGE0/0/1"}
+			found, err := LLDPInterfaces(sample.format, sample.output, interfaces)
+			if err != nil {
+				t.Fatal(err)
+			}
+			local := []string{}
+			for name := range found {
+				local = append(local, name)
+			}
+			sort.Strings(local)
+			expected := append([]string{}, sample.local...)
+			sort.Strings(expected)
+			if !reflect.DeepEqual(local, expected) {
+				t.Errorf("interfaces with neighbors %v, expected %v", local, expected)
+			}
+		})
+	}
+	for _, format := range LLDPFormats {
+		if !covered[format] {
+			t.Errorf("no sample of the %s format", format)
+		}
+	}
+	if _, err := LLDPInterfaces("unknown", "", nil); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestLLDPInterfacesOf(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+	if err := client.LoadOSData("../devices.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := client.LLDPInterfacesOf("Cisco IOS", "Local Intf: Gi1/0/2\nPort id: Gi1/0/3\n", []string{"Gi1/0/2", "Gi1/0/3"})
+	if err != nil || !reflect.DeepEqual(found, map[string]bool{"Gi1/0/2": true}) {
+		t.Errorf("found %v, %v", found, err)
+	}
+	if _, err := client.LLDPInterfacesOf("FortiOS", "", nil); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestInterfaceKey(t *testing.T) {
+	same := [][]string{
+		{"Gi1/0/1", "GigabitEthernet1/0/1", "GE1/0/1", "gi 1/0/1"},
+		{"Te1/0/1", "TenGigabitEthernet1/0/1", "XGE1/0/1", "10GE1/0/1"},
+		{"Twe1/0/1", "TwentyFiveGigE1/0/1", "25GE1/0/1"},
+		{"Fo1/0/1", "FortyGigabitEthernet1/0/1", "40GE1/0/1"},
+		{"Fa0/1", "FastEthernet0/1"},
+		{"Eth1/1", "Ethernet1/1"},
+		{"Po10", "Port-channel10"},
+	}
+	for _, names := range same {
+		for _, name := range names[1:] {
+			if InterfaceKey(name) != InterfaceKey(names[0]) {
+				t.Errorf("%s and %s differ: %q, %q", names[0], name, InterfaceKey(names[0]), InterfaceKey(name))
+			}
+		}
+	}
+	for i := range same {
+		for j := i + 1; j < len(same); j++ {
+			if InterfaceKey(same[i][0]) == InterfaceKey(same[j][0]) {
+				t.Errorf("%s and %s are the same: %q", same[i][0], same[j][0], InterfaceKey(same[i][0]))
+			}
+		}
+	}
+	for _, pair := range [][2]string{{"Te1/0/1", "Tw1/0/1"}, {"Tw1/0/1", "Twe1/0/1"}, {"Fa1/0/1", "Fo1/0/1"}, {"1/1/1", "1/1/10"}} {
+		if InterfaceKey(pair[0]) == InterfaceKey(pair[1]) {
+			t.Errorf("%s and %s are the same: %q", pair[0], pair[1], InterfaceKey(pair[0]))
+		}
+	}
+}
+
+func TestLocateMACs(t *testing.T) {
+	tables := []DeviceMacTable{
+		{
+			Host: "core",
+			Entries: []MacEntry{
+				{MAC: "00:50:56:00:00:01", VLAN: 10, Interface: "Gi1/0/48"},
+				{MAC: "00:50:56:00:00:02", VLAN: 10, Interface: "Gi1/0/48"},
+				{MAC: "00:50:56:00:00:01", VLAN: 0, Interface: "CPU"},
+			},
+			LLDPPorts: map[string]bool{"Gi1/0/48": true},
+		},
+		{
+			Host: "access",
+			Entries: []MacEntry{
+				{MAC: "00:50:56:00:00:01", VLAN: 10, Interface: "Gi1/0/5"},
+				{MAC: "00:50:56:00:00:02", VLAN: 10, Interface: "Po1"},
+			},
+		},
+	}
+	found, err := LocateMACs(tables, []string{"0050.5600.0001", "00:50:56"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("found %v", found)
+	}
+	first := found[0]
+	if len(first) != 2 || first[0].Host != "access" || first[0].Uplink != "" || first[1].Uplink != "LLDP neighbor" {
+		t.Errorf("locations of 00:50:56:00:00:01: %+v", first)
+	}
+	second := found[1]
+	if len(second) != 2 || second[0].MAC != "00:50:56:00:00:02" || second[0].Uplink != "aggregated link" || second[1].Uplink != "LLDP neighbor" {
+		t.Errorf("locations of 00:50:56:00:00:02: %+v", second)
+	}
+	if _, err := LocateMACs(tables, []string{"zz"}, 10); err == nil {
+		t.Error("invalid query accepted")
+	}
+}
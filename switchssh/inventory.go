@@ -0,0 +1,407 @@
+package switchssh
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Inventory file formats
+const (
+	InventoryYAML = "yaml"
+	InventoryJSON = "json"
+	InventoryCSV  = "csv"
+)
+
+/**
+ * Inventory of devices with group-level defaults and named credentials.
+ *
+ * @attr Defaults    Settings applied to every host
+ * @attr Groups      Settings applied to the hosts of each group
+ * @attr Credentials Credentials referenced by name from the settings (plaintext, prefer the Store)
+ * @attr Hosts       Devices
+ * @attr Store       Credential store resolving the names not found in Credentials (can be nil)
+ */
+type Inventory struct {
+	Defaults    InventorySettings            `yaml:"defaults" json:"defaults"`
+	Groups      map[string]InventorySettings `yaml:"groups" json:"groups"`
+	Credentials map[string]Credentials       `yaml:"credentials" json:"credentials"`
+	Hosts       []InventoryHost              `yaml:"hosts" json:"hosts"`
+	Store       *CredentialStore             `yaml:"-" json:"-"`
+}
+
+/**
+ * Connection settings of a host, a group or the inventory defaults.
+ * Empty values are inherited: host over its groups (later groups over earlier ones) over the defaults.
+ *
+ * @attr Port            SSH (or telnet) port
+ * @attr Transport       ssh, telnet, auto or snmp
+ * @attr Credentials     Names of the credentials to log in with, tried in order until the device accepts one
+ * @attr OS              Known OS name from devices.json, skips the detection
+ * @attr Jump            Comma separated chain of jump hosts (see ParseJumpHosts)
+ * @attr JumpCredentials Name of the credentials for the jump hosts (default: the device credentials)
+ * @attr Vars            Arbitrary variables, merged key by key
+ */
+type InventorySettings struct {
+	Port            int               `yaml:"port" json:"port,omitempty"`
+	Transport       string            `yaml:"transport" json:"transport,omitempty"`
+	Credentials     ProfileList       `yaml:"credentials" json:"credentials,omitempty"`
+	OS              string            `yaml:"os" json:"os,omitempty"`
+	Jump            string            `yaml:"jump" json:"jump,omitempty"`
+	JumpCredentials string            `yaml:"jump-credentials" json:"jump-credentials,omitempty"`
+	Vars            map[string]string `yaml:"vars" json:"vars,omitempty"`
+}
+
+/**
+ * Device of the inventory.
+ *
+ * @attr Hostname Name of the device, used in reports and output file names
+ * @attr Address  IP or DNS name to connect to (default: the hostname)
+ * @attr Groups   Groups the device belongs to
+ */
+type InventoryHost struct {
+	Hostname          string   `yaml:"hostname" json:"hostname"`
+	Address           string   `yaml:"address" json:"address,omitempty"`
+	Groups            []string `yaml:"groups" json:"groups,omitempty"`
+	InventorySettings `yaml:",inline"`
+}
+
+/**
+ * Loads an inventory file, the format is chosen by the extension (.yaml, .yml, .json or .csv).
+ *
+ * @param filename Inventory file
+ * @return         Inventory and errors
+ */
+func LoadInventory(filename string) (*Inventory, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	if format == "yml" {
+		format = InventoryYAML
+	}
+	inventory, err := ParseInventory(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return inventory, nil
+}
+
+/**
+ * Parses and validates an inventory.
+ *
+ * @param data   Content of the inventory
+ * @param format InventoryYAML, InventoryJSON or InventoryCSV
+ * @return       Inventory and errors
+ */
+func ParseInventory(data []byte, format string) (*Inventory, error) {
+	inventory := new(Inventory)
+	var err error
+	switch format {
+	case InventoryYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(inventory)
+		if err == io.EOF {
+			err = nil
+		}
+	case InventoryJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(inventory)
+	case InventoryCSV:
+		inventory.Hosts, err = parseInventoryCSV(data)
+	default:
+		return nil, fmt.Errorf("unknown inventory format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := inventory.validate(); err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+/**
+ * Parses a CSV inventory. The first row names the columns: hostname, address, port, transport, credentials,
+ * os, groups (separated by spaces or ';'), jump and jump-credentials, other columns become variables.
+ */
+func parseInventoryCSV(data []byte) ([]InventoryHost, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	header := rows[0]
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	hosts := make([]InventoryHost, 0, len(rows)-1)
+	for line, row := range rows[1:] {
+		host := InventoryHost{}
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			switch header[i] {
+			case "hostname":
+				host.Hostname = value
+			case "address":
+				host.Address = value
+			case "port":
+				port, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid port %q", line+2, value)
+				}
+				host.Port = port
+			case "transport":
+				host.Transport = value
+			case "credentials":
+				host.Credentials = ParseProfileList(value)
+			case "os":
+				host.OS = value
+			case "groups":
+				host.Groups = strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ' ' })
+			case "jump":
+				host.Jump = value
+			case "jump-credentials":
+				host.JumpCredentials = value
+			default:
+				if host.Vars == nil {
+					host.Vars = make(map[string]string)
+				}
+				host.Vars[header[i]] = value
+			}
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+/**
+ * Checks the references between hosts and groups, hosts without hostname are named by their address.
+ * Credentials are checked when building the targets, as they may come from the credential store.
+ */
+func (this *Inventory) validate() error {
+	seen := make(map[string]bool)
+	for i := range this.Hosts {
+		host := &this.Hosts[i]
+		if host.Hostname == "" {
+			host.Hostname = host.Address
+		}
+		if host.Hostname == "" {
+			return fmt.Errorf("host #%d has neither hostname nor address", i+1)
+		}
+		if seen[host.Hostname] {
+			return fmt.Errorf("duplicate host %s", host.Hostname)
+		}
+		seen[host.Hostname] = true
+		for _, group := range host.Groups {
+			if _, ok := this.Groups[group]; !ok {
+				return fmt.Errorf("host %s: unknown group %s", host.Hostname, group)
+			}
+		}
+	}
+	check := func(where string, settings InventorySettings) error {
+		switch settings.Transport {
+		case "", TransportSSH, TransportTelnet, TransportAuto, TransportSNMP:
+		default:
+			return fmt.Errorf("%s: unknown transport %s", where, settings.Transport)
+		}
+		return nil
+	}
+	if err := check("defaults", this.Defaults); err != nil {
+		return err
+	}
+	for name, group := range this.Groups {
+		if err := check("group "+name, group); err != nil {
+			return err
+		}
+	}
+	for _, host := range this.Hosts {
+		if err := check("host "+host.Hostname, host.InventorySettings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * Returns the hosts belonging to any of the groups and matching any of the patterns.
+ * Patterns are globs (see path.Match) matched against the hostname and the address.
+ *
+ * @param groups   Group names (empty selects all hosts)
+ * @param patterns Glob patterns (empty selects all hosts)
+ * @return         Selected hosts in inventory order and errors for invalid patterns
+ */
+func (this *Inventory) Filter(groups []string, patterns []string) ([]InventoryHost, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+		}
+	}
+	hosts := make([]InventoryHost, 0)
+	for _, host := range this.Hosts {
+		if host.inGroups(groups) && host.matches(patterns) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
+
+func (this InventoryHost) inGroups(groups []string) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	for _, want := range groups {
+		for _, group := range this.Groups {
+			if group == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (this InventoryHost) matches(patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, this.Hostname); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, this.Address); ok && this.Address != "" {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Returns the settings of the host merged with the settings of its groups and the defaults.
+ *
+ * @param host Host of the inventory
+ * @return     Effective settings
+ */
+func (this *Inventory) Settings(host InventoryHost) InventorySettings {
+	settings := InventorySettings{Vars: make(map[string]string)}
+	settings.merge(this.Defaults)
+	for _, group := range host.Groups {
+		settings.merge(this.Groups[group])
+	}
+	settings.merge(host.InventorySettings)
+	return settings
+}
+
+func (this *InventorySettings) merge(other InventorySettings) {
+	if other.Port != 0 {
+		this.Port = other.Port
+	}
+	if other.Transport != "" {
+		this.Transport = other.Transport
+	}
+	if len(other.Credentials) > 0 {
+		this.Credentials = other.Credentials
+	}
+	if other.OS != "" {
+		this.OS = other.OS
+	}
+	if other.Jump != "" {
+		this.Jump = other.Jump
+	}
+	if other.JumpCredentials != "" {
+		this.JumpCredentials = other.JumpCredentials
+	}
+	for key, value := range other.Vars {
+		this.Vars[key] = value
+	}
+}
+
+/**
+ * Builds the target of a host. Settings not given by the inventory are taken from defaults,
+ * the port defaults to 22.
+ *
+ * @param host     Host of the inventory
+ * @param defaults Credentials, transport and jump hosts used when the inventory does not set them
+ * @return         Target and errors
+ */
+func (this *Inventory) Target(host InventoryHost, defaults Target) (Target, error) {
+	settings := this.Settings(host)
+	target := defaults
+	address := host.Address
+	if address == "" {
+		address = host.Hostname
+	}
+	port := settings.Port
+	if port == 0 {
+		port = 22
+	}
+	target.Address = net.JoinHostPort(address, strconv.Itoa(port))
+	if settings.Transport != "" {
+		target.Transport = settings.Transport
+	}
+	if len(settings.Credentials) > 0 {
+		creds := make([]Credentials, 0, len(settings.Credentials))
+		for _, name := range settings.Credentials {
+			cred, err := this.lookupCredentials(name)
+			if err != nil {
+				return target, fmt.Errorf("host %s: %w", host.Hostname, err)
+			}
+			creds = append(creds, cred)
+		}
+		target.Credentials = creds[0]
+		target.Fallback = creds[1:]
+	}
+	target.OS = settings.OS
+	if settings.Jump != "" {
+		jumpCred := target.Credentials
+		if settings.JumpCredentials != "" {
+			var err error
+			jumpCred, err = this.lookupCredentials(settings.JumpCredentials)
+			if err != nil {
+				return target, fmt.Errorf("host %s: %w", host.Hostname, err)
+			}
+		}
+		hops, err := ParseJumpHosts(settings.Jump, jumpCred)
+		if err != nil {
+			return target, fmt.Errorf("host %s: %w", host.Hostname, err)
+		}
+		target.JumpHosts = hops
+	}
+	return target, nil
+}
+
+/**
+ * Returns the named credentials from the inventory or, if not defined there, from the credential store.
+ */
+func (this *Inventory) lookupCredentials(name string) (Credentials, error) {
+	if cred, ok := this.Credentials[name]; ok {
+		cred.Profile = name
+		return cred, nil
+	}
+	if this.Store != nil {
+		if cred, ok := this.Store.Get(name); ok {
+			return cred, nil
+		}
+	}
+	return Credentials{}, fmt.Errorf("unknown credentials %s", name)
+}
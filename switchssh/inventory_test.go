@@ -0,0 +1,231 @@
+package switchssh
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const yamlInventory = `
+defaults:
+  credentials: ops
+  vars: {site: hq}
+groups:
+  core:
+    port: 2222
+    os: Cisco IOS
+    jump: bastion.example.com
+    jump-credentials: jump
+    vars: {role: core}
+  huawei:
+    os: Huawei VRP
+    credentials: [netops, ops]
+    vars: {role: access}
+credentials:
+  ops: {user: ops, password: ops-pass}
+  netops: {user: netops, password: netops-pass}
+  jump: {user: jumper, key: /keys/jump}
+hosts:
+  - hostname: core1
+    address: 10.0.0.1
+    groups: [core]
+  - hostname: access1
+    address: 10.0.1.1
+    groups: [core, huawei]
+  - hostname: sw3.example.com
+    credentials: netops
+    transport: telnet
+    vars: {site: branch}
+`
+
+// Same inventory as yamlInventory
+const jsonInventory = `{
+  "defaults": {"credentials": "ops", "vars": {"site": "hq"}},
+  "groups": {
+    "core": {"port": 2222, "os": "Cisco IOS", "jump": "bastion.example.com", "jump-credentials": "jump", "vars": {"role": "core"}},
+    "huawei": {"os": "Huawei VRP", "credentials": ["netops", "ops"], "vars": {"role": "access"}}
+  },
+  "credentials": {
+    "ops": {"user": "ops", "password": "ops-pass"},
+    "netops": {"user": "netops", "password": "netops-pass"},
+    "jump": {"user": "jumper", "key": "/keys/jump"}
+  },
+  "hosts": [
+    {"hostname": "core1", "address": "10.0.0.1", "groups": ["core"]},
+    {"hostname": "access1", "address": "10.0.1.1", "groups": ["core", "huawei"]},
+    {"hostname": "sw3.example.com", "credentials": "netops", "transport": "telnet", "vars": {"site": "branch"}}
+  ]
+}`
+
+const csvInventory = `hostname, address, port, credentials, os, jump, rack
+# lab switches
+lab1, 192.0.2.1, , ops;spare, Cisco IOS, admin:pw@10.9.9.9:2200, A1
+lab2, 192.0.2.2, 830, , , , B2
+`
+
+var defaultTarget = Target{Transport: TransportSSH, Credentials: Credentials{User: "cli", Password: "cli-pass"}}
+
+// compares the targets as printed, so nil and empty lists are equal
+func checkTarget(t *testing.T, host string, target, expected Target) {
+	t.Helper()
+	if got, want := fmt.Sprintf("%+v", target), fmt.Sprintf("%+v", expected); got != want {
+		t.Errorf("target of %s\n got: %s\nwant: %s", host, got, want)
+	}
+}
+
+func TestInventoryTargets(t *testing.T) {
+	ops := Credentials{User: "ops", Password: "ops-pass", Profile: "ops"}
+	netops := Credentials{User: "netops", Password: "netops-pass", Profile: "netops"}
+	bastion := []JumpHost{{Address: "bastion.example.com:22", Credentials: Credentials{User: "jumper", KeyFile: "/keys/jump", Profile: "jump"}}}
+	expected := []struct {
+		hostname string
+		vars     map[string]string
+		target   Target
+	}{
+		{"core1", map[string]string{"site": "hq", "role": "core"},
+			Target{Address: "10.0.0.1:2222", Credentials: ops, JumpHosts: bastion, Transport: TransportSSH, OS: "Cisco IOS"}},
+		// The later group wins
+		{"access1", map[string]string{"site": "hq", "role": "access"},
+			Target{Address: "10.0.1.1:2222", Credentials: netops, Fallback: []Credentials{ops}, JumpHosts: bastion, Transport: TransportSSH, OS: "Huawei VRP"}},
+		// The hostname is the address, with the default port
+		{"sw3.example.com", map[string]string{"site": "branch"},
+			Target{Address: "sw3.example.com:22", Credentials: netops, Transport: TransportTelnet}},
+	}
+	for _, format := range []struct {
+		name string
+		data string
+	}{
+		{InventoryYAML, yamlInventory},
+		{InventoryJSON, jsonInventory},
+	} {
+		t.Run(format.name, func(t *testing.T) {
+			inventory, err := ParseInventory([]byte(format.data), format.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(inventory.Hosts) != len(expected) {
+				t.Fatalf("%d hosts", len(inventory.Hosts))
+			}
+			for i, host := range inventory.Hosts {
+				if host.Hostname != expected[i].hostname {
+					t.Errorf("host %d is %s, expected %s", i, host.Hostname, expected[i].hostname)
+					continue
+				}
+				if vars := inventory.Settings(host).Vars; !reflect.DeepEqual(vars, expected[i].vars) {
+					t.Errorf("variables of %s %v, expected %v", host.Hostname, vars, expected[i].vars)
+				}
+				target, err := inventory.Target(host, defaultTarget)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkTarget(t, host.Hostname, target, expected[i].target)
+			}
+		})
+	}
+}
+
+func TestInventoryCSV(t *testing.T) {
+	inventory, err := ParseInventory([]byte(csvInventory), InventoryCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inventory.Store = NewCredentialStore()
+	inventory.Store.Set("ops", Credentials{User: "ops", Password: "ops-pass"})
+	inventory.Store.Set("spare", Credentials{User: "spare", Password: "spare-pass"})
+	ops := Credentials{User: "ops", Password: "ops-pass", Profile: "ops"}
+	expected := []struct {
+		hostname string
+		vars     map[string]string
+		target   Target
+	}{
+		// The user and password given in the jump chain replace the ones of the credentials
+		{"lab1", map[string]string{"rack": "A1"}, Target{Address: "192.0.2.1:22", Credentials: ops,
+			Fallback:  []Credentials{{User: "spare", Password: "spare-pass", Profile: "spare"}},
+			JumpHosts: []JumpHost{{Address: "10.9.9.9:2200", Credentials: Credentials{User: "admin", Password: "pw", Profile: "ops"}}},
+			Transport: TransportSSH, OS: "Cisco IOS"}},
+		// Without credentials in the inventory the default ones are used
+		{"lab2", map[string]string{"rack": "B2"}, Target{Address: "192.0.2.2:830", Credentials: defaultTarget.Credentials, Transport: TransportSSH}},
+	}
+	if len(inventory.Hosts) != len(expected) {
+		t.Fatalf("hosts %+v", inventory.Hosts)
+	}
+	for i, host := range inventory.Hosts {
+		if host.Hostname != expected[i].hostname {
+			t.Errorf("host %d is %s, expected %s", i, host.Hostname, expected[i].hostname)
+			continue
+		}
+		if !reflect.DeepEqual(host.Vars, expected[i].vars) {
+			t.Errorf("variables of %s %v, expected %v", host.Hostname, host.Vars, expected[i].vars)
+		}
+		target, err := inventory.Target(host, defaultTarget)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTarget(t, host.Hostname, target, expected[i].target)
+	}
+
+	inventory.Store.Delete("spare")
+	if _, err := inventory.Target(inventory.Hosts[0], defaultTarget); err == nil || !strings.Contains(err.Error(), "unknown credentials spare") {
+		t.Errorf("expected an unknown credentials error, got %v", err)
+	}
+}
+
+func TestInventoryFilter(t *testing.T) {
+	inventory, err := ParseInventory([]byte(yamlInventory), InventoryYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		groups   []string
+		patterns []string
+		expected []string
+	}{
+		{nil, nil, []string{"core1", "access1", "sw3.example.com"}},
+		{[]string{"core"}, nil, []string{"core1", "access1"}},
+		{[]string{"huawei"}, nil, []string{"access1"}},
+		{nil, []string{"sw*"}, []string{"sw3.example.com"}},
+		// Patterns match the address too
+		{nil, []string{"10.0.1.*"}, []string{"access1"}},
+		{nil, []string{"core?", "*.example.com"}, []string{"core1", "sw3.example.com"}},
+		{[]string{"core"}, []string{"access*"}, []string{"access1"}},
+		{[]string{"huawei"}, []string{"core1"}, []string{}},
+	} {
+		hosts, err := inventory.Filter(test.groups, test.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, host := range hosts {
+			names = append(names, host.Hostname)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("groups %v patterns %v: %v, expected %v", test.groups, test.patterns, names, test.expected)
+		}
+	}
+	if _, err := inventory.Filter(nil, []string{"sw[1"}); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestInventoryInvalid(t *testing.T) {
+	for _, test := range []struct {
+		format string
+		data   string
+		err    string
+	}{
+		{InventoryYAML, "hosts:\n  - hostname: sw1\n    prot: 22\n", "field prot not found"},
+		{InventoryJSON, `{"hosts": [{"hostname": "sw1", "prot": 22}]}`, `unknown field "prot"`},
+		{InventoryYAML, "hosts:\n  - hostname: sw1\n    groups: [core]\n", "host sw1: unknown group core"},
+		{InventoryYAML, "hosts:\n  - hostname: 10.0.0.1\n  - address: 10.0.0.1\n", "duplicate host 10.0.0.1"},
+		{InventoryYAML, "hosts:\n  - port: 22\n", "host #1 has neither hostname nor address"},
+		{InventoryYAML, "groups:\n  old: {transport: rsh}\n", "group old: unknown transport rsh"},
+		{InventoryCSV, "hostname,port\nsw1,22\nsw2,ssh\n", `line 3: invalid port "ssh"`},
+		{InventoryCSV, "hostname,groups\nsw1,core\n", "host sw1: unknown group core"},
+		{"xml", "<hosts/>", `unknown inventory format "xml"`},
+	} {
+		if _, err := ParseInventory([]byte(test.data), test.format); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s %q: expected %q, got %v", test.format, test.data, test.err, err)
+		}
+	}
+}
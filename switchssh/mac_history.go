@@ -0,0 +1,397 @@
+package switchssh
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Format of the timestamps in the database, local time as written by gather_data.py
+const macHistoryTimeLayout = "2006-01-02 15:04:05"
+
+// Format of the times of the runs, with microseconds so runs within the same second stay apart;
+// it sorts as text with the timestamps written without them, which parse with macHistoryTimeLayout too
+const macRunTimeLayout = "2006-01-02 15:04:05.000000"
+
+// Table of gather_data.py, so databases it filled keep working, the runs reading each switch and the observations of each run
+const macHistorySchema = `
+CREATE TABLE IF NOT EXISTS network_inventory (
+	switch_name TEXT,
+	switch_ip TEXT,
+	vendor TEXT,
+	mac_address TEXT,
+	port_name TEXT,
+	vlan TEXT,
+	created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+	updated_at TEXT DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(switch_name, mac_address, port_name, vlan)
+);
+CREATE TABLE IF NOT EXISTS mac_observations (
+	switch_name TEXT,
+	switch_ip TEXT,
+	vendor TEXT,
+	mac_address TEXT,
+	port_name TEXT,
+	vlan TEXT,
+	seen_at TEXT,
+	UNIQUE(switch_name, mac_address, port_name, vlan, seen_at)
+);
+CREATE TABLE IF NOT EXISTS mac_runs (
+	switch_name TEXT,
+	seen_at TEXT,
+	UNIQUE(switch_name, seen_at)
+);
+CREATE INDEX IF NOT EXISTS mac_observations_mac ON mac_observations(mac_address);
+CREATE INDEX IF NOT EXISTS mac_observations_run ON mac_observations(switch_name, seen_at)`
+
+/**
+ * SQLite database of the MAC addresses seen on each switch port over time. Every run reading a switch is recorded
+ * (mac_runs), even when its MAC table is empty, and adds one observation per MAC address, port and VLAN
+ * (mac_observations); the network_inventory table of gather_data.py
+ * is kept up to date as well, one row per switch, MAC address, port and VLAN with the time it was first and
+ * last seen there.
+ *
+ * @attr db Database connection
+ */
+type MacHistory struct {
+	db *sql.DB
+}
+
+/**
+ * Stay of a MAC address on a switch port: the consecutive runs reading the switch that saw it there.
+ *
+ * @attr Switch    Host name of the switch
+ * @attr Address   Address the switch was read from
+ * @attr OS        OS of the switch
+ * @attr MAC       MAC address in canonical form
+ * @attr Interface Port the MAC address was learned on
+ * @attr VLAN      VLAN of the entry
+ * @attr FirstSeen First run that saw the MAC address on the port, since it was last missing from it
+ * @attr LastSeen  Last run that saw the MAC address on the port before it went missing
+ */
+type MacSighting struct {
+	Switch    string    `json:"switch"`
+	Address   string    `json:"address"`
+	OS        string    `json:"os"`
+	MAC       string    `json:"mac"`
+	Interface string    `json:"interface"`
+	VLAN      int       `json:"vlan"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+/**
+ * Opens the history database, creating it if it does not exist.
+ * Databases written by gather_data.py can be opened as well.
+ *
+ * @param filename SQLite database file
+ * @return         History and errors
+ */
+func OpenMacHistory(filename string) (*MacHistory, error) {
+	db, err := sql.Open("sqlite3", filename+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(macHistorySchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &MacHistory{db: db}, nil
+}
+
+/**
+ * Closes the database.
+ */
+func (this *MacHistory) Close() error {
+	return this.db.Close()
+}
+
+/**
+ * Records the MAC table read from a switch: the run, an observation of each entry at the time of the run,
+ * and in network_inventory new MAC address, port and VLAN combinations are added, the last seen time
+ * of known ones is updated. Recording the same switch twice at the same time records one run.
+ *
+ * @param host    Host name of the switch
+ * @param address Address the switch was read from
+ * @param osName  OS of the switch
+ * @param entries MAC table of the switch
+ * @param seen    Time the table was read
+ * @return        Errors, in which case nothing is recorded
+ */
+func (this *MacHistory) Record(host string, address string, osName string, entries []MacEntry, seen time.Time) error {
+	tx, err := this.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`
+		INSERT INTO network_inventory (switch_name, switch_ip, vendor, mac_address, port_name, vlan, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(switch_name, mac_address, port_name, vlan)
+		DO UPDATE SET switch_ip = excluded.switch_ip, vendor = excluded.vendor, updated_at = excluded.updated_at`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	observe, err := tx.Prepare(`
+		INSERT OR IGNORE INTO mac_observations (switch_name, switch_ip, vendor, mac_address, port_name, vlan, seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer observe.Close()
+	now := seen.Local().Format(macHistoryTimeLayout)
+	run := seen.Local().Format(macRunTimeLayout)
+	if _, err := tx.Exec("INSERT OR IGNORE INTO mac_runs (switch_name, seen_at) VALUES (?, ?)", host, run); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := stmt.Exec(host, address, osName, entry.MAC, entry.Interface, strconv.Itoa(entry.VLAN), now, now); err != nil {
+			return err
+		}
+		if _, err := observe.Exec(host, address, osName, entry.MAC, entry.Interface, strconv.Itoa(entry.VLAN), run); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+/**
+ * Returns the sightings matching the filter, oldest first. The observations of each switch, MAC address, port
+ * and VLAN are merged into stays: runs of the switch that saw it there, without a run in between that did not.
+ * Rows of network_inventory without any observation (written by gather_data.py, or before the observations
+ * were recorded) are one sighting from the first to the last time seen, as in gather_data.py
+ * (which wrote MAC addresses in uppercase).
+ *
+ * @param where Condition on the rows, of both tables (can be empty)
+ * @param since Only sightings last seen at or after this time (zero: no limit)
+ * @param until Only sightings first seen at or before this time (zero: no limit)
+ * @param args  Arguments of the condition
+ */
+func (this *MacHistory) sightings(where string, since time.Time, until time.Time, args ...interface{}) ([]MacSighting, error) {
+	result, err := this.observedSightings(where, args...)
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := this.inventorySightings(where, args...)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, legacy...)
+	matching := []MacSighting{}
+	for _, sighting := range result {
+		if !since.IsZero() && sighting.LastSeen.Before(since) || !until.IsZero() && sighting.FirstSeen.After(until) {
+			continue
+		}
+		matching = append(matching, sighting)
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		if !matching[i].FirstSeen.Equal(matching[j].FirstSeen) {
+			return matching[i].FirstSeen.Before(matching[j].FirstSeen)
+		}
+		if matching[i].Switch != matching[j].Switch {
+			return matching[i].Switch < matching[j].Switch
+		}
+		return matching[i].Interface < matching[j].Interface
+	})
+	return matching, nil
+}
+
+/**
+ * Returns the stays of the MAC addresses on the switch ports, from the observations matching the filter.
+ */
+func (this *MacHistory) observedSightings(where string, args ...interface{}) ([]MacSighting, error) {
+	// Runs reading each switch, a stay ends at the first run that did not see the MAC address on the port.
+	// Runs recorded before mac_runs existed are known by their observations only.
+	runs, err := this.db.Query("SELECT switch_name, seen_at FROM mac_runs UNION SELECT switch_name, seen_at FROM mac_observations ORDER BY seen_at")
+	if err != nil {
+		return nil, err
+	}
+	defer runs.Close()
+	runIndex := make(map[string]map[string]int)
+	for runs.Next() {
+		var host, seen string
+		if err := runs.Scan(&host, &seen); err != nil {
+			return nil, err
+		}
+		if runIndex[host] == nil {
+			runIndex[host] = make(map[string]int)
+		}
+		runIndex[host][seen] = len(runIndex[host])
+	}
+	if err := runs.Err(); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT switch_name, switch_ip, vendor, mac_address, port_name, vlan, seen_at FROM mac_observations"
+	if where != "" {
+		query += " WHERE " + where
+	}
+	query += " ORDER BY seen_at"
+	rows, err := this.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type stay struct {
+		index   int
+		lastRun int
+	}
+	open := make(map[[4]string]*stay)
+	result := []MacSighting{}
+	for rows.Next() {
+		var host, mac, port, vlan, seen string
+		var address, osName sql.NullString
+		if err := rows.Scan(&host, &address, &osName, &mac, &port, &vlan, &seen); err != nil {
+			return nil, err
+		}
+		seenTime, _ := time.ParseInLocation(macHistoryTimeLayout, seen, time.Local)
+		run := runIndex[host][seen]
+		key := [4]string{host, mac, port, vlan}
+		if current, ok := open[key]; ok && current.lastRun+1 >= run {
+			sighting := &result[current.index]
+			sighting.Address, sighting.OS, sighting.LastSeen = address.String, osName.String, seenTime
+			current.lastRun = run
+			continue
+		}
+		sighting := MacSighting{
+			Switch:    host,
+			Address:   address.String,
+			OS:        osName.String,
+			MAC:       mac,
+			Interface: port,
+			FirstSeen: seenTime,
+			LastSeen:  seenTime,
+		}
+		sighting.VLAN, _ = strconv.Atoi(vlan)
+		open[key] = &stay{index: len(result), lastRun: run}
+		result = append(result, sighting)
+	}
+	return result, rows.Err()
+}
+
+/**
+ * Returns the rows of network_inventory matching the filter that have no observation, merged per switch,
+ * MAC address, port and VLAN.
+ */
+func (this *MacHistory) inventorySightings(where string, args ...interface{}) ([]MacSighting, error) {
+	query := `
+		SELECT switch_name, max(switch_ip), max(vendor), lower(mac_address), port_name, vlan, min(created_at), max(updated_at)
+		FROM network_inventory
+		WHERE NOT EXISTS (
+			SELECT 1 FROM mac_observations observed
+			WHERE observed.switch_name = network_inventory.switch_name AND observed.mac_address = lower(network_inventory.mac_address)
+				AND observed.port_name = network_inventory.port_name AND observed.vlan = network_inventory.vlan)`
+	if where != "" {
+		query += " AND (" + where + ")"
+	}
+	query += " GROUP BY switch_name, lower(mac_address), port_name, vlan"
+	rows, err := this.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []MacSighting{}
+	for rows.Next() {
+		var sighting MacSighting
+		var address, osName, vlan, firstSeen, lastSeen sql.NullString
+		if err := rows.Scan(&sighting.Switch, &address, &osName, &sighting.MAC, &sighting.Interface, &vlan, &firstSeen, &lastSeen); err != nil {
+			return nil, err
+		}
+		sighting.Address, sighting.OS = address.String, osName.String
+		if mac, ok := NormalizeMAC(sighting.MAC); ok {
+			sighting.MAC = mac
+		}
+		// gather_data.py wrote "Unknown VLAN" for ports without one
+		sighting.VLAN, _ = strconv.Atoi(vlan.String)
+		sighting.FirstSeen, _ = time.ParseInLocation(macHistoryTimeLayout, firstSeen.String, time.Local)
+		sighting.LastSeen, _ = time.ParseInLocation(macHistoryTimeLayout, lastSeen.String, time.Local)
+		result = append(result, sighting)
+	}
+	return result, rows.Err()
+}
+
+/**
+ * Returns where and when a MAC address, or the MAC addresses of an OUI prefix, were seen:
+ * each stay on a switch port with its first and last time, oldest first.
+ *
+ * @param query MAC address or OUI prefix (see ParseMACQuery)
+ * @param since Only sightings last seen at or after this time (zero: no limit)
+ * @param until Only sightings first seen at or before this time (zero: no limit)
+ * @return      Sightings and errors
+ */
+func (this *MacHistory) Sightings(query string, since time.Time, until time.Time) ([]MacSighting, error) {
+	prefix, err := ParseMACQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return this.sightings("replace(replace(replace(lower(mac_address), ':', ''), '.', ''), '-', '') LIKE ?", since, until, prefix+"%")
+}
+
+/**
+ * Returns the MAC addresses that moved between ports of a switch: seen on more than one port of the same switch.
+ * The same MAC address on ports of different switches is not a move, it is seen on the uplinks towards it.
+ *
+ * @param since Only sightings last seen at or after this time (zero: no limit)
+ * @return      Sightings of each moved MAC address on its switch (oldest first), the latest moves first, and errors
+ */
+func (this *MacHistory) Moves(since time.Time) ([][]MacSighting, error) {
+	all, err := this.sightings("", since, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	type key struct {
+		host string
+		mac  string
+	}
+	groups := make(map[key][]MacSighting)
+	order := []key{}
+	for _, sighting := range all {
+		k := key{sighting.Switch, sighting.MAC}
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], sighting)
+	}
+	moves := [][]MacSighting{}
+	for _, k := range order {
+		ports := make(map[string]bool)
+		for _, sighting := range groups[k] {
+			ports[InterfaceKey(sighting.Interface)] = true
+		}
+		if len(ports) > 1 {
+			moves = append(moves, groups[k])
+		}
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		return moves[i][len(moves[i])-1].FirstSeen.After(moves[j][len(moves[j])-1].FirstSeen)
+	})
+	return moves, nil
+}
+
+/**
+ * Returns the MAC addresses seen on a port of a switch, oldest first.
+ * The port is compared by InterfaceKey, so Gi1/0/1 finds GigabitEthernet1/0/1.
+ *
+ * @param host  Host name of the switch
+ * @param port  Interface name
+ * @param since Only sightings last seen at or after this time (zero: no limit)
+ * @param until Only sightings first seen at or before this time (zero: no limit)
+ * @return      Sightings and errors
+ */
+func (this *MacHistory) PortHistory(host string, port string, since time.Time, until time.Time) ([]MacSighting, error) {
+	all, err := this.sightings("switch_name = ?", since, until, host)
+	if err != nil {
+		return nil, err
+	}
+	result := []MacSighting{}
+	for _, sighting := range all {
+		if InterfaceKey(sighting.Interface) == InterfaceKey(port) {
+			result = append(result, sighting)
+		}
+	}
+	return result, nil
+}
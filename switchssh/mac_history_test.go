@@ -0,0 +1,179 @@
+package switchssh
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestHistory(t *testing.T) *MacHistory {
+	history, err := OpenMacHistory(filepath.Join(t.TempDir(), "mac_history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { history.Close() })
+	return history
+}
+
+func TestMacHistoryStays(t *testing.T) {
+	history := openTestHistory(t)
+	now := time.Now().Truncate(time.Second)
+	monthAgo := now.AddDate(0, -1, 0)
+	lastTuesday := now.AddDate(0, 0, -7)
+	laptop := MacEntry{MAC: "00:50:56:00:00:01", VLAN: 10, Type: MacDynamic}
+	printer := MacEntry{MAC: "00:50:56:00:00:02", VLAN: 10, Interface: "Gi1/0/9", Type: MacDynamic}
+	twoWeeksAgo := now.AddDate(0, 0, -14)
+	// The laptop is on port A a month ago, on port B last Tuesday and on port A again today;
+	// two weeks ago the switch was read with an empty MAC table
+	for _, run := range []struct {
+		seen time.Time
+		port string
+	}{
+		{monthAgo, "Gi1/0/1"},
+		{monthAgo.AddDate(0, 0, 1), "Gi1/0/1"},
+		{twoWeeksAgo, ""},
+		{lastTuesday, "Gi1/0/2"},
+		{now, "Gi1/0/1"},
+	} {
+		entries := []MacEntry{}
+		if run.port != "" {
+			entry := laptop
+			entry.Interface = run.port
+			entries = append(entries, entry, printer)
+		}
+		if err := history.Record("sw1", "10.0.0.1", "Cisco IOS", entries, run.seen); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := history.Sightings("0050.5600.0001", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		port        string
+		first, last time.Time
+	}{
+		{"Gi1/0/1", monthAgo, monthAgo.AddDate(0, 0, 1)},
+		{"Gi1/0/2", lastTuesday, lastTuesday},
+		{"Gi1/0/1", now, now},
+	}
+	if len(all) != len(expected) {
+		t.Fatalf("sightings %+v", all)
+	}
+	for i, sighting := range all {
+		if sighting.Interface != expected[i].port || !sighting.FirstSeen.Equal(expected[i].first) || !sighting.LastSeen.Equal(expected[i].last) {
+			t.Errorf("sighting %d: %s from %s to %s, expected %s from %s to %s", i, sighting.Interface, sighting.FirstSeen, sighting.LastSeen,
+				expected[i].port, expected[i].first, expected[i].last)
+		}
+	}
+
+	dayStart := lastTuesday.Add(-time.Hour)
+	dayEnd := lastTuesday.Add(time.Hour)
+	that, err := history.Sightings("0050.5600.0001", dayStart, dayEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(that) != 1 || that[0].Interface != "Gi1/0/2" {
+		t.Errorf("sightings of last Tuesday %+v, expected Gi1/0/2 only", that)
+	}
+	port, err := history.PortHistory("sw1", "GigabitEthernet1/0/1", dayStart, dayEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(port) != 0 {
+		t.Errorf("port A last Tuesday %+v, expected nothing", port)
+	}
+
+	// The printer stayed on its port, but was missing from the empty table
+	printers, err := history.PortHistory("sw1", "Gi1/0/9", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(printers) != 2 || !printers[0].FirstSeen.Equal(monthAgo) || !printers[0].LastSeen.Equal(monthAgo.AddDate(0, 0, 1)) ||
+		!printers[1].FirstSeen.Equal(lastTuesday) || !printers[1].LastSeen.Equal(now) {
+		t.Errorf("printer sightings %+v", printers)
+	}
+
+	moves, err := history.Moves(dayStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 1 || len(moves[0]) != 2 || moves[0][0].Interface != "Gi1/0/2" || moves[0][1].Interface != "Gi1/0/1" {
+		t.Errorf("moves since last Tuesday %+v", moves)
+	}
+}
+
+func TestMacHistoryRunsWithinASecond(t *testing.T) {
+	history := openTestHistory(t)
+	start := time.Now().Truncate(time.Second)
+	laptop := MacEntry{MAC: "00:50:56:00:00:01", VLAN: 10, Interface: "Gi1/0/1", Type: MacDynamic}
+	// Three runs within a second, the laptop is missing from the second one
+	for i, entries := range [][]MacEntry{{laptop}, {}, {laptop}} {
+		if err := history.Record("sw1", "10.0.0.1", "Cisco IOS", entries, start.Add(time.Duration(i)*300*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Observations of a database written before the runs were recorded, with one run missing the laptop
+	for _, observation := range []struct {
+		mac  string
+		seen string
+	}{
+		{laptop.MAC, "2026-01-05 10:00:00"},
+		{"00:50:56:00:00:02", "2026-01-05 11:00:00"},
+		{laptop.MAC, "2026-01-05 12:00:00"},
+	} {
+		if _, err := history.db.Exec(`INSERT INTO mac_observations (switch_name, switch_ip, vendor, mac_address, port_name, vlan, seen_at)
+			VALUES ('sw2', '10.0.0.2', 'Cisco IOS', ?, 'Gi1/0/1', '10', ?)`, observation.mac, observation.seen); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := history.Sightings(laptop.MAC, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2026, 1, 5, 10, 0, 0, 0, time.Local)
+	expected := []struct {
+		host        string
+		first, last time.Time
+	}{
+		{"sw2", old, old},
+		{"sw2", old.Add(2 * time.Hour), old.Add(2 * time.Hour)},
+		{"sw1", start, start},
+		{"sw1", start.Add(600 * time.Millisecond), start.Add(600 * time.Millisecond)},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("sightings %+v", found)
+	}
+	for i, sighting := range found {
+		if sighting.Switch != expected[i].host || !sighting.FirstSeen.Equal(expected[i].first) || !sighting.LastSeen.Equal(expected[i].last) {
+			t.Errorf("sighting %d: %s from %s to %s, expected %s from %s to %s", i, sighting.Switch, sighting.FirstSeen, sighting.LastSeen,
+				expected[i].host, expected[i].first, expected[i].last)
+		}
+	}
+}
+
+func TestMacHistoryGatherData(t *testing.T) {
+	history := openTestHistory(t)
+	// Row of gather_data.py, without observations
+	if _, err := history.db.Exec(`INSERT INTO network_inventory (switch_name, switch_ip, vendor, mac_address, port_name, vlan, created_at, updated_at)
+		VALUES ('sw2', '10.0.0.2', 'HUAWEI', '00:50:56:AA:00:01', 'GE0/0/1', 'Unknown VLAN', '2026-01-05 10:00:00', '2026-02-05 10:00:00')`); err != nil {
+		t.Fatal(err)
+	}
+	found, err := history.Sightings("00:50:56", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].MAC != "00:50:56:aa:00:01" || found[0].VLAN != 0 || found[0].FirstSeen.Format(macHistoryTimeLayout) != "2026-01-05 10:00:00" ||
+		found[0].LastSeen.Format(macHistoryTimeLayout) != "2026-02-05 10:00:00" {
+		t.Errorf("sightings %+v", found)
+	}
+	later, err := history.Sightings("00:50:56", time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(later) != 0 {
+		t.Errorf("sightings since March %+v", later)
+	}
+}
@@ -0,0 +1,261 @@
+package switchssh
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Types of MAC table entries
+const (
+	MacDynamic = "dynamic"
+	MacStatic  = "static"
+)
+
+/**
+ * Entry of the MAC address table of a device, the same for all vendors.
+ *
+ * @attr MAC       MAC address in canonical form (00:11:22:aa:bb:cc)
+ * @attr VLAN      VLAN number, 0 if the entry belongs to none (e.g. "All" entries of the CPU)
+ * @attr Interface Interface the MAC address was learned on, as named by the device
+ * @attr Type      MacDynamic or MacStatic
+ * @attr Age       Seconds since the MAC address was last seen, nil if the device does not report it
+ */
+type MacEntry struct {
+	MAC       string `json:"mac"`
+	VLAN      int    `json:"vlan"`
+	Interface string `json:"interface"`
+	Type      string `json:"type"`
+	Age       *int   `json:"age,omitempty"`
+}
+
+/**
+ * Implemented by drivers that can parse the output of their mac-table getter.
+ */
+type MacTableParser interface {
+	ParseMacTable(output string) ([]MacEntry, error)
+}
+
+// Formats of MAC address tables, for the mac-format field of devices.json
+const (
+	MacFormatCiscoIOS   = "cisco-ios"
+	MacFormatCiscoSBOS  = "cisco-sbos"
+	MacFormatCiscoNXOS  = "cisco-nxos"
+	MacFormatArubaOS    = "arubaos"
+	MacFormatArubaCX    = "aruba-cx"
+	MacFormatHuaweiVRP  = "huawei-vrp"
+	MacFormatH3CComware = "h3c-comware"
+)
+
+// all MAC table formats, in the order they are documented
+var MacFormats = []string{MacFormatCiscoIOS, MacFormatCiscoSBOS, MacFormatCiscoNXOS, MacFormatArubaOS, MacFormatArubaCX, MacFormatHuaweiVRP, MacFormatH3CComware}
+
+// Columns of MAC table rows
+const (
+	macColumnMAC  = "mac"
+	macColumnVLAN = "vlan"
+	macColumnPort = "port"
+	macColumnType = "type"
+	macColumnAge  = "age"
+	// a column that is not part of MacEntry
+	macColumnSkip = ""
+)
+
+// Whitespace separated columns of the rows of each format, rows are matched against the layouts
+// of their format by the number of columns
+var macTableLayouts = map[string][][]string{
+	// Vlan Mac Address Type Ports
+	// and the Catalyst 6500 layout: vlan mac address type learn age ports
+	MacFormatCiscoIOS: {
+		{macColumnVLAN, macColumnMAC, macColumnType, macColumnPort},
+		{macColumnVLAN, macColumnMAC, macColumnType, macColumnSkip, macColumnAge, macColumnPort},
+	},
+	// Vlan Mac Address Port Type
+	MacFormatCiscoSBOS: {
+		{macColumnVLAN, macColumnMAC, macColumnPort, macColumnType},
+	},
+	// VLAN MAC Address Type age Secure NTFY Ports
+	MacFormatCiscoNXOS: {
+		{macColumnVLAN, macColumnMAC, macColumnType, macColumnAge, macColumnSkip, macColumnSkip, macColumnPort},
+	},
+	// Destination Address Address Type VLAN Destination Port
+	MacFormatArubaOS: {
+		{macColumnMAC, macColumnType, macColumnVLAN, macColumnPort},
+	},
+	// MAC Address VLAN Type Port
+	MacFormatArubaCX: {
+		{macColumnMAC, macColumnVLAN, macColumnType, macColumnPort},
+	},
+	// MAC Address VLAN/VSI/BD Learned-From Type
+	// and the layout of older versions: MAC Address VLAN/VSI/SI PEVLAN CEVLAN Port Type LSP/LSR-ID
+	MacFormatHuaweiVRP: {
+		{macColumnMAC, macColumnVLAN, macColumnPort, macColumnType},
+		{macColumnMAC, macColumnVLAN, macColumnSkip, macColumnSkip, macColumnPort, macColumnType, macColumnSkip},
+	},
+	// MAC Address VLAN ID State Port/NickName Aging, the state is Learned or two words: Config static
+	MacFormatH3CComware: {
+		{macColumnMAC, macColumnVLAN, macColumnType, macColumnPort, macColumnSkip},
+		{macColumnMAC, macColumnVLAN, macColumnSkip, macColumnType, macColumnPort, macColumnSkip},
+	},
+}
+
+// words of the type column meaning the entry does not age out
+var staticMacTypes = []string{"static", "config", "self", "permanent", "system", "secure", "sticky", "interface"}
+
+/**
+ * Returns the MAC address in canonical form: six lowercase hex bytes separated by colons.
+ * Accepts the dotted (0011.2233.4455), dashed (0011-2233-4455, 001122-334455, 00-11-22-33-44-55)
+ * and colon separated forms.
+ *
+ * @param mac MAC address as printed by a device
+ * @return    Canonical MAC address and false if the input is not a MAC address
+ */
+func NormalizeMAC(mac string) (string, bool) {
+	digits := strings.NewReplacer(".", "", ":", "", "-", "").Replace(strings.ToLower(mac))
+	if len(digits) != 12 {
+		return "", false
+	}
+	for _, c := range digits {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return "", false
+		}
+	}
+	parts := make([]string, 6)
+	for i := range parts {
+		parts[i] = digits[i*2 : i*2+2]
+	}
+	return strings.Join(parts, ":"), true
+}
+
+/**
+ * Parses the MAC address table printed by a device. Headers, legends, separators and counters are skipped,
+ * rows are recognized by the MAC address in the column where the format expects it.
+ *
+ * @param format Format of the table (see MacFormats)
+ * @param output Output of the mac-table getter
+ * @return       Entries in the order of the output, an error if the format is unknown
+ */
+func ParseMacTable(format string, output string) ([]MacEntry, error) {
+	layouts, ok := macTableLayouts[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown MAC table format %q", format)
+	}
+	entries := []MacEntry{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		// NX-OS and the Catalyst 6500 mark entries with a single character (*, +, G, ...) before the VLAN
+		if len(fields) > 0 && len(fields[0]) == 1 && (fields[0][0] < '0' || fields[0][0] > '9') {
+			fields = fields[1:]
+		}
+		if entry, ok := parseMacFields(layouts, fields); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// matches the fields of a row against the layouts. Rows with more fields than a layout ending with the port
+// match it too, the port is then named by several words (vPC Peer-Link, vlan 10).
+func parseMacFields(layouts [][]string, fields []string) (MacEntry, bool) {
+	for _, layout := range layouts {
+		if entry, ok := parseMacRow(layout, fields); ok {
+			return entry, true
+		}
+	}
+	for _, layout := range layouts {
+		last := len(layout) - 1
+		if layout[last] != macColumnPort || len(fields) <= len(layout) {
+			continue
+		}
+		joined := append(append([]string{}, fields[:last]...), strings.Join(fields[last:], " "))
+		if entry, ok := parseMacRow(layout, joined); ok {
+			return entry, true
+		}
+	}
+	return MacEntry{}, false
+}
+
+// maps the fields of a row to the columns of the layout, false if the row does not match it
+func parseMacRow(layout []string, fields []string) (MacEntry, bool) {
+	entry := MacEntry{Type: MacDynamic}
+	if len(fields) != len(layout) {
+		return entry, false
+	}
+	for i, column := range layout {
+		value := fields[i]
+		switch column {
+		case macColumnMAC:
+			mac, ok := NormalizeMAC(value)
+			if !ok {
+				return entry, false
+			}
+			entry.MAC = mac
+		case macColumnVLAN:
+			// Huawei prints VLAN/VSI/BD as 10/-/-, entries of no VLAN as All, - or N/A
+			vlan, _ := strconv.Atoi(strings.SplitN(value, "/", 2)[0])
+			entry.VLAN = vlan
+		case macColumnPort:
+			entry.Interface = value
+		case macColumnType:
+			value = strings.ToLower(value)
+			for _, static := range staticMacTypes {
+				if strings.Contains(value, static) {
+					entry.Type = MacStatic
+				}
+			}
+		case macColumnAge:
+			if age, err := strconv.Atoi(value); err == nil {
+				entry.Age = &age
+			}
+		}
+	}
+	return entry, true
+}
+
+func (this *CommandDriver) ParseMacTable(output string) ([]MacEntry, error) {
+	if this.MacFormat == "" {
+		return nil, fmt.Errorf("MAC table of %s: %w", this.OSName, ErrNotSupported)
+	}
+	return ParseMacTable(this.MacFormat, output)
+}
+
+/**
+ * Reads the MAC address table of the target with the mac-table getter of its OS and parses it,
+ * or over SNMP for targets of the snmp transport (see SNMPMacTableContext).
+ *
+ * @param ctx      Context of the execution
+ * @param target   Switch address, credentials and jump hosts
+ * @return         Normalized entries, ErrNotSupported if the OS has no mac-table getter or no known table format,
+ *                 execution errors
+ */
+func (this *Client) MacTableContext(ctx context.Context, target Target) ([]MacEntry, error) {
+	if target.Transport == TransportSNMP {
+		return this.SNMPMacTableContext(ctx, target)
+	}
+	output, err := this.GetContext(ctx, target, GetterMacTable)
+	if err != nil {
+		return nil, err
+	}
+	brand, err := this.GetSSHBrandContext(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return this.ParseMacTableOf(brand, output)
+}
+
+/**
+ * Parses the output of the mac-table getter with the driver of the OS.
+ *
+ * @param osName OS name from devices.json
+ * @param output Output of the mac-table getter
+ * @return       Normalized entries, ErrNotSupported if the driver of the OS cannot parse MAC tables
+ */
+func (this *Client) ParseMacTableOf(osName string, output string) ([]MacEntry, error) {
+	driver, _ := this.Driver(osName)
+	parser, ok := driver.(MacTableParser)
+	if !ok {
+		return nil, fmt.Errorf("MAC table of %s: %w", osName, ErrNotSupported)
+	}
+	return parser.ParseMacTable(output)
+}
@@ -0,0 +1,252 @@
+package switchssh
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func age(seconds int) *int {
+	return &seconds
+}
+
+// Captured output of the mac-table getter of each format, with the entries expected from it
+var macTableSamples = []struct {
+	name     string
+	format   string
+	output   string
+	expected []MacEntry
+}{
+	{
+		name:   "Catalyst 2960 with CPU entries",
+		format: MacFormatCiscoIOS,
+		output: `          Mac Address Table
+-------------------------------------------
+
+Vlan    Mac Address       Type        Ports
+----    -----------       --------    -----
+ All    0100.0ccc.cccc    STATIC      CPU
+ All    0180.c200.0000    STATIC      CPU
+   1    0011.2233.4455    DYNAMIC     Gi1/0/1
+  10    aabb.cc00.0101    DYNAMIC     Gi1/0/24
+  20    aabb.cc00.0202    STATIC      Gi1/0/5
+Total Mac Addresses for this criterion: 5
+`,
+		expected: []MacEntry{
+			{MAC: "01:00:0c:cc:cc:cc", VLAN: 0, Interface: "CPU", Type: MacStatic},
+			{MAC: "01:80:c2:00:00:00", VLAN: 0, Interface: "CPU", Type: MacStatic},
+			{MAC: "00:11:22:33:44:55", VLAN: 1, Interface: "Gi1/0/1", Type: MacDynamic},
+			{MAC: "aa:bb:cc:00:01:01", VLAN: 10, Interface: "Gi1/0/24", Type: MacDynamic},
+			{MAC: "aa:bb:cc:00:02:02", VLAN: 20, Interface: "Gi1/0/5", Type: MacStatic},
+		},
+	},
+	{
+		name:   "Catalyst 6500 with entry markers and age",
+		format: MacFormatCiscoIOS,
+		output: `Legend: * - primary entry
+        age - seconds since last seen
+        n/a - not available
+
+  vlan   mac address     type    learn     age              ports
+------+----------------+--------+-----+----------+--------------------------
+*  100  0050.5600.0001   dynamic  Yes          5   Gi1/1
+*   10  0050.5600.0002    static  No           -   Router
+`,
+		expected: []MacEntry{
+			{MAC: "00:50:56:00:00:01", VLAN: 100, Interface: "Gi1/1", Type: MacDynamic, Age: age(5)},
+			{MAC: "00:50:56:00:00:02", VLAN: 10, Interface: "Router", Type: MacStatic},
+		},
+	},
+	{
+		name:   "SG350",
+		format: MacFormatCiscoSBOS,
+		output: `Aging time is 300 sec
+
+    Vlan          Mac Address         Port       Type
+-------- --------------------- ---------- ----------
+   1       00:11:22:33:44:55     gi1/0/1    dynamic
+   1       e0:5f:b9:aa:bb:cc        0         self
+  10       00:50:56:aa:00:01     gi1/0/10   dynamic
+`,
+		expected: []MacEntry{
+			{MAC: "00:11:22:33:44:55", VLAN: 1, Interface: "gi1/0/1", Type: MacDynamic},
+			{MAC: "e0:5f:b9:aa:bb:cc", VLAN: 1, Interface: "0", Type: MacStatic},
+			{MAC: "00:50:56:aa:00:01", VLAN: 10, Interface: "gi1/0/10", Type: MacDynamic},
+		},
+	},
+	{
+		name:   "Nexus 9000 with primary, gateway and vPC entries",
+		format: MacFormatCiscoNXOS,
+		output: `Legend:
+        * - primary entry, G - Gateway MAC, (R) - Routed MAC, O - Overlay MAC
+        age - seconds since last seen,+ - primary entry using vPC Peer-Link,
+        (T) - True, (F) - False, C - ControlPlane MAC, ~ - vsan
+   VLAN     MAC Address      Type      age     Secure NTFY Ports
+---------+-----------------+--------+---------+------+----+------------------
+*   10     0050.56a0.1111   dynamic  0         F      F    Eth1/1
+*   20     0050.56a0.2222   dynamic  120       F      F    Po10
++   30     0050.56a0.3333   dynamic  NA        F      F    vPC Peer-Link
+G    -     002a.6a8b.0c41   static   -         F      F    sup-eth1(R)
+`,
+		expected: []MacEntry{
+			{MAC: "00:50:56:a0:11:11", VLAN: 10, Interface: "Eth1/1", Type: MacDynamic, Age: age(0)},
+			{MAC: "00:50:56:a0:22:22", VLAN: 20, Interface: "Po10", Type: MacDynamic, Age: age(120)},
+			{MAC: "00:50:56:a0:33:33", VLAN: 30, Interface: "vPC Peer-Link", Type: MacDynamic},
+			{MAC: "00:2a:6a:8b:0c:41", VLAN: 0, Interface: "sup-eth1(R)", Type: MacStatic},
+		},
+	},
+	{
+		name:   "ArubaOS controller",
+		format: MacFormatArubaOS,
+		output: `
+MAC Address Table
+-----------------
+Destination Address  Address Type  VLAN  Destination Port
+-------------------  ------------  ----  ----------------
+00:0b:86:61:2e:a0    Interface     1     vlan 1
+00:1a:1e:01:23:45    Learnt        1     GE0/0/0
+00:1a:1e:01:23:46    Learnt        10    GE0/0/1
+`,
+		expected: []MacEntry{
+			{MAC: "00:0b:86:61:2e:a0", VLAN: 1, Interface: "vlan 1", Type: MacStatic},
+			{MAC: "00:1a:1e:01:23:45", VLAN: 1, Interface: "GE0/0/0", Type: MacDynamic},
+			{MAC: "00:1a:1e:01:23:46", VLAN: 10, Interface: "GE0/0/1", Type: MacDynamic},
+		},
+	},
+	{
+		name:   "Aruba CX 6300",
+		format: MacFormatArubaCX,
+		output: `
+MAC age-time            : 300 seconds
+Number of MAC addresses : 3
+
+MAC Address          VLAN     Type                      Port
+--------------------------------------------------------------
+00:50:56:aa:00:01    1        dynamic                   1/1/1
+00:50:56:aa:00:02    10       dynamic                   1/1/48
+08:00:09:aa:bb:cc    20       static                    lag1
+`,
+		expected: []MacEntry{
+			{MAC: "00:50:56:aa:00:01", VLAN: 1, Interface: "1/1/1", Type: MacDynamic},
+			{MAC: "00:50:56:aa:00:02", VLAN: 10, Interface: "1/1/48", Type: MacDynamic},
+			{MAC: "08:00:09:aa:bb:cc", VLAN: 20, Interface: "lag1", Type: MacStatic},
+		},
+	},
+	{
+		name:   "Huawei S5700 V200",
+		format: MacFormatHuaweiVRP,
+		output: `-------------------------------------------------------------------------------
+MAC Address    VLAN/VSI/BD   Learned-From        Type
+-------------------------------------------------------------------------------
+0011-2233-4455 10/-/-        GE0/0/1             dynamic
+5489-98ab-cdef 20/-/-        Eth-Trunk1          dynamic
+00e0-fc12-3456 1/-/-         GE0/0/24            static
+-------------------------------------------------------------------------------
+Total items displayed = 3
+`,
+		expected: []MacEntry{
+			{MAC: "00:11:22:33:44:55", VLAN: 10, Interface: "GE0/0/1", Type: MacDynamic},
+			{MAC: "54:89:98:ab:cd:ef", VLAN: 20, Interface: "Eth-Trunk1", Type: MacDynamic},
+			{MAC: "00:e0:fc:12:34:56", VLAN: 1, Interface: "GE0/0/24", Type: MacStatic},
+		},
+	},
+	{
+		name:   "Huawei V100",
+		format: MacFormatHuaweiVRP,
+		output: `MAC Address    VLAN/       PEVLAN CEVLAN Port            Type      LSP/LSR-ID
+               VSI/SI                                              MAC-Tunnel
+-------------------------------------------------------------------------------
+0011-2233-4455 10          -      -      GE0/0/1         dynamic   0/-
+-------------------------------------------------------------------------------
+Total matching items on slot 0 displayed = 1
+`,
+		expected: []MacEntry{
+			{MAC: "00:11:22:33:44:55", VLAN: 10, Interface: "GE0/0/1", Type: MacDynamic},
+		},
+	},
+	{
+		name:   "H3C Comware 7 with Config static entries",
+		format: MacFormatH3CComware,
+		output: `MAC Address      VLAN ID    State            Port/Nickname            Aging
+0011-2233-4455   1          Learned          GE1/0/1                  Y
+0011-2233-4466   10         Config static    GE1/0/2                  N
+`,
+		expected: []MacEntry{
+			{MAC: "00:11:22:33:44:55", VLAN: 1, Interface: "GE1/0/1", Type: MacDynamic},
+			{MAC: "00:11:22:33:44:66", VLAN: 10, Interface: "GE1/0/2", Type: MacStatic},
+		},
+	},
+	{
+		name:   "H3C Comware 5",
+		format: MacFormatH3CComware,
+		output: `MAC ADDR          VLAN ID  STATE             PORT INDEX               AGING TIME(s)
+0011-2233-4455    1        LEARNED           GigabitEthernet1/0/1     AGING
+0011-2233-4466    10       Config static     GigabitEthernet1/0/2     NOAGED
+
+  ---  2 mac address(es) found  ---
+`,
+		expected: []MacEntry{
+			{MAC: "00:11:22:33:44:55", VLAN: 1, Interface: "GigabitEthernet1/0/1", Type: MacDynamic},
+			{MAC: "00:11:22:33:44:66", VLAN: 10, Interface: "GigabitEthernet1/0/2", Type: MacStatic},
+		},
+	},
+}
+
+func TestParseMacTable(t *testing.T) {
+	for _, sample := range macTableSamples {
+		t.Run(sample.name, func(t *testing.T) {
+			entries, err := ParseMacTable(sample.format, sample.output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, sample.expected) {
+				t.Errorf("parsed:\n%s\nexpected:\n%s", formatEntries(entries), formatEntries(sample.expected))
+			}
+		})
+	}
+}
+
+func TestParseMacTableFormatsCovered(t *testing.T) {
+	covered := map[string]bool{}
+	for _, sample := range macTableSamples {
+		covered[sample.format] = true
+	}
+	for _, format := range MacFormats {
+		if !covered[format] {
+			t.Errorf("no sample of the %s format", format)
+		}
+	}
+	if _, err := ParseMacTable("unknown", ""); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestNormalizeMAC(t *testing.T) {
+	for input, expected := range map[string]string{
+		"0011.2233.4455":    "00:11:22:33:44:55",
+		"0011-2233-4455":    "00:11:22:33:44:55",
+		"001122-334455":     "00:11:22:33:44:55",
+		"00-11-22-33-44-55": "00:11:22:33:44:55",
+		"00:11:22:AA:BB:CC": "00:11:22:aa:bb:cc",
+		"0011.2233.445":     "",
+		"0011.2233.44zz":    "",
+		"Gi1/0/1":           "",
+	} {
+		mac, ok := NormalizeMAC(input)
+		if mac != expected || ok != (expected != "") {
+			t.Errorf("NormalizeMAC(%q) = %q, %t, expected %q", input, mac, ok, expected)
+		}
+	}
+}
+
+func formatEntries(entries []MacEntry) string {
+	text := ""
+	for _, entry := range entries {
+		entryAge := "-"
+		if entry.Age != nil {
+			entryAge = fmt.Sprint(*entry.Age)
+		}
+		text += fmt.Sprintf("  %s vlan %d %q %s age %s\n", entry.MAC, entry.VLAN, entry.Interface, entry.Type, entryAge)
+	}
+	return text
+}
@@ -0,0 +1,176 @@
+package switchssh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+)
+
+// OS entry of devices.json: detection signatures and the declarative driver of the OS
+type OS struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Models      []string          `json:"models"`
+	Versions    []string          `json:"versions"`
+	Signatures  []Signature       `json:"signatures"`
+	Probes      CommandList       `json:"probes"`
+	Pager       string            `json:"pager"`
+	MacAddrComm string            `json:"mac-addr-list"` // DEPRECATED: mac-table getter of earlier files
+	Prompt      string            `json:"prompt"`
+	Enable      *EnableSequence   `json:"enable"`
+	Errors      []string          `json:"errors"`
+	ConfigEnter CommandList       `json:"config-enter"`
+	ConfigExit  CommandList       `json:"config-exit"`
+	Save        CommandList       `json:"save"`
+	Logout      string            `json:"logout"`
+	Getters     map[string]string `json:"getters"`
+	MacFormat   string            `json:"mac-format"`
+	LLDPFormat  string            `json:"lldp-format"`
+}
+
+// Names of the getters an OS can declare in devices.json
+const (
+	GetterVersion       = "version"
+	GetterInterfaces    = "interfaces"
+	GetterVlans         = "vlans"
+	GetterMacTable      = "mac-table"
+	GetterLLDPNeighbors = "lldp-neighbors"
+	GetterRunningConfig = "running-config"
+)
+
+// all getter names, in the order they are documented
+var GetterNames = []string{GetterVersion, GetterInterfaces, GetterVlans, GetterMacTable, GetterLLDPNeighbors, GetterRunningConfig}
+
+// commands given in devices.json as a single string or a list
+type CommandList []string
+
+func (this *CommandList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*this = list
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		// Reported by the decoder with the field name, as for other type mismatches
+		return &json.UnmarshalTypeError{Value: jsonKind(data), Type: reflect.TypeOf(list)}
+	}
+	*this = nil
+	if value != "" {
+		*this = CommandList{value}
+	}
+	return nil
+}
+
+// names the kind of the JSON value for error messages
+func jsonKind(data []byte) string {
+	switch data[0] {
+	case '{':
+		return "object"
+	case 't', 'f':
+		return "bool"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+// loads the OS signatures and drivers (devices.json), rejecting entries that do not match the schema
+func (this *Client) LoadOSData(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	osData, err := ParseOSData(data)
+	if err == nil {
+		err = this.SetOSData(osData)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+/**
+ * Replaces the OS signatures used for detection and the drivers declared with them.
+ * The entries are validated (see ValidateOSData) and their signatures compiled once,
+ * invalid data is rejected and the previous data kept.
+ *
+ * @param osData OS entries
+ * @return       Validation errors naming the entries and the patterns
+ */
+func (this *Client) SetOSData(osData []OS) error {
+	if err := ValidateOSData(osData); err != nil {
+		return err
+	}
+	signatures := make([]compiledOS, len(osData))
+	for i, osEntry := range osData {
+		compiled, err := compileSignatures(osEntry)
+		if err != nil {
+			return err
+		}
+		signatures[i] = compiled
+	}
+	this.osLocker.Lock()
+	defer this.osLocker.Unlock()
+	this.osData = osData
+	this.osSignatures = signatures
+	this.driverCache = nil
+	return nil
+}
+
+// returns the OS signatures used for detection
+func (this *Client) OSData() []OS {
+	this.osLocker.RLock()
+	defer this.osLocker.RUnlock()
+	return this.osData
+}
+
+// returns the OS entries with their compiled signatures
+func (this *Client) signatures() []compiledOS {
+	this.osLocker.RLock()
+	defer this.osLocker.RUnlock()
+	return this.osSignatures
+}
+
+func (this *Client) ReturnOsInfo(input string) (OS, error) {
+	for _, osEntry := range this.OSData() {
+		if osEntry.Name == input {
+			return osEntry, nil
+		}
+	}
+	return OS{}, errors.New("no os of that name found")
+}
+
+// finds the first OS with an output signature (model, version, ...) matching the input
+func (this *Client) FindOSByModelOrVersion(input string) *OS {
+	for _, osEntry := range this.signatures() {
+		for _, group := range osEntry.groups {
+			if group.field != SignalOutput {
+				continue
+			}
+			for _, pattern := range group.patterns {
+				if pattern.MatchString(input) {
+					return &osEntry.OS
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Function to verify both model and version at the same time,
+// returns the OS detected from them as output signals (see DetectOS) or nil
+func (this *Client) VerifyModelAndVersion(modelInput, versionInput string) *OS {
+	detected := this.detectedOS(this.DetectOS(DetectionSignals{Output: modelInput + "\n" + versionInput}))
+	if detected == nil {
+		return nil
+	}
+	osEntry, err := this.ReturnOsInfo(detected.Name)
+	if err != nil {
+		return nil
+	}
+	return &osEntry
+}
@@ -0,0 +1,255 @@
+package switchssh
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// parses devices.json, reporting syntax errors with their line and column and unknown fields with their entry,
+// then validates the entries (see ValidateOSData)
+func ParseOSData(data []byte) ([]OS, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line, column := jsonPosition(data, syntaxErr.Offset)
+			return nil, fmt.Errorf("line %d column %d: %s", line, column, syntaxErr)
+		}
+		return nil, fmt.Errorf("must be a list of OS entries: %s", err)
+	}
+	osData := make([]OS, len(entries))
+	problems := []string{}
+	for i, entry := range entries {
+		decoder := json.NewDecoder(bytes.NewReader(entry))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&osData[i]); err != nil {
+			var named struct {
+				Name string `json:"name"`
+			}
+			json.Unmarshal(entry, &named)
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				field := typeErr.Field
+				if field == "" {
+					field = badCommandListField(entry)
+				}
+				err = fmt.Errorf("%s must be %s, not %s", field, typeErr.Type, typeErr.Value)
+			}
+			problems = append(problems, fmt.Sprintf("%s: %s", entryName(i, named.Name), strings.TrimPrefix(err.Error(), "json: ")))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid OS data:\n  %s", strings.Join(problems, "\n  "))
+	}
+	if err := ValidateOSData(osData); err != nil {
+		return nil, err
+	}
+	return osData, nil
+}
+
+// returns the command list field of the entry that is neither a string nor a list,
+// the decoder does not name the field for errors of UnmarshalJSON methods
+func badCommandListField(entry []byte) string {
+	var fields map[string]json.RawMessage
+	json.Unmarshal(entry, &fields)
+	for _, name := range []string{"probes", "config-enter", "config-exit", "save"} {
+		var cmds CommandList
+		if value, ok := fields[name]; ok && cmds.UnmarshalJSON(value) != nil {
+			return name
+		}
+	}
+	return "value"
+}
+
+// names the entry in error messages
+func entryName(index int, name string) string {
+	if name == "" {
+		return fmt.Sprintf("entry %d", index+1)
+	}
+	return fmt.Sprintf("entry %d (%s)", index+1, name)
+}
+
+// returns the line and column of the byte offset
+func jsonPosition(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// checks the OS entries: names must be present and unique, regexes must compile, signatures and getters must have
+// known names, commands must not be empty, mac-addr-list must not contradict the mac-table getter.
+// All problems are returned together, one per line.
+func ValidateOSData(osData []OS) error {
+	problems := []string{}
+	names := map[string]int{}
+	for i, osEntry := range osData {
+		where := entryName(i, osEntry.Name)
+		report := func(format string, a ...interface{}) {
+			problems = append(problems, where+": "+fmt.Sprintf(format, a...))
+		}
+		checkRegex := func(field string, pattern string) {
+			if _, err := regexp.Compile(pattern); err != nil {
+				report("%s: invalid regex %q: %s", field, pattern, err)
+			}
+		}
+		checkCommands := func(field string, cmds []string) {
+			for _, cmd := range cmds {
+				if strings.TrimSpace(cmd) == "" {
+					report("%s: empty command", field)
+				}
+			}
+		}
+
+		if osEntry.Name == "" {
+			report("name is missing")
+		} else if first, ok := names[osEntry.Name]; ok {
+			report("name already used by entry %d", first+1)
+		} else {
+			names[osEntry.Name] = i
+		}
+		if len(osEntry.Models) == 0 && len(osEntry.Versions) == 0 && len(osEntry.Signatures) == 0 {
+			report("no models, versions or signatures, the OS can never be detected")
+		}
+		for _, pattern := range osEntry.Models {
+			checkRegex("models", pattern)
+		}
+		for _, pattern := range osEntry.Versions {
+			checkRegex("versions", pattern)
+		}
+		for n, signature := range osEntry.Signatures {
+			field := fmt.Sprintf("signatures[%d]", n)
+			if signature.Field != "" && !isSignalName(signature.Field) {
+				report("%s: unknown field %q (known: %s)", field, signature.Field, strings.Join(SignalNames, ", "))
+			}
+			if _, ok := signatureScores[signature.Weight]; signature.Weight != "" && !ok {
+				report("%s: unknown weight %q (known: %s, %s, %s)", field, signature.Weight, WeightRequired, WeightStrong, WeightWeak)
+			}
+			if signature.Pattern == "" {
+				report("%s: pattern is missing", field)
+			} else {
+				checkRegex(field, signature.Pattern)
+			}
+		}
+		if osEntry.Prompt != "" {
+			checkRegex("prompt", osEntry.Prompt)
+		}
+		for _, pattern := range osEntry.Errors {
+			checkRegex("errors", pattern)
+		}
+		if enable := osEntry.Enable; enable != nil {
+			if enable.Command == "" {
+				report("enable: command is missing")
+			}
+			for _, field := range [][2]string{
+				{"enable: password-prompt", enable.PasswordPrompt},
+				{"enable: success-prompt", enable.SuccessPrompt},
+				{"enable: success-output", enable.SuccessOutput},
+			} {
+				if field[1] != "" {
+					checkRegex(field[0], field[1])
+				}
+			}
+		}
+		checkCommands("probes", osEntry.Probes)
+		checkCommands("config-enter", osEntry.ConfigEnter)
+		checkCommands("config-exit", osEntry.ConfigExit)
+		checkCommands("save", osEntry.Save)
+		if len(osEntry.ConfigExit) > 0 && len(osEntry.ConfigEnter) == 0 {
+			report("config-exit without config-enter")
+		}
+		if _, ok := macTableLayouts[osEntry.MacFormat]; osEntry.MacFormat != "" && !ok {
+			report("mac-format: unknown format %q (known: %s)", osEntry.MacFormat, strings.Join(MacFormats, ", "))
+		}
+		if _, ok := lldpLocalPortPatterns[osEntry.LLDPFormat]; osEntry.LLDPFormat != "" && !ok {
+			report("lldp-format: unknown format %q (known: %s)", osEntry.LLDPFormat, strings.Join(LLDPFormats, ", "))
+		}
+		getters := make([]string, 0, len(osEntry.Getters))
+		for name := range osEntry.Getters {
+			getters = append(getters, name)
+		}
+		sort.Strings(getters)
+		for _, name := range getters {
+			cmd := osEntry.Getters[name]
+			if !isGetterName(name) {
+				report("getters: unknown getter %q (known: %s)", name, strings.Join(GetterNames, ", "))
+			} else if strings.TrimSpace(cmd) == "" {
+				report("getters: %s: empty command", name)
+			}
+		}
+		if cmd, ok := osEntry.Getters[GetterMacTable]; ok && osEntry.MacAddrComm != "" && osEntry.MacAddrComm != cmd {
+			report("mac-addr-list %q conflicts with getters: mac-table %q, mac-addr-list is replaced by the getter", osEntry.MacAddrComm, cmd)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid OS data:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func isSignalName(name string) bool {
+	for _, known := range SignalNames {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+func isGetterName(name string) bool {
+	for _, known := range GetterNames {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Looks for entries of the loaded OS data that are valid but can not work as intended:
+ * entries that can never reach Client.MinConfidence, entries with the signatures of an earlier entry
+ * (equal scores keep the order of devices.json, so they are never detected) and repeated patterns.
+ *
+ * @return Warnings naming the entries, empty if none
+ */
+func (this *Client) LintOSData() []string {
+	warnings := []string{}
+	signatures := this.signatures()
+	seen := map[string]int{}
+	for i, osEntry := range signatures {
+		where := entryName(i, osEntry.Name)
+		if maxScore := osEntry.maxScore(); float64(maxScore)/fullConfidenceScore < this.MinConfidence {
+			warnings = append(warnings, fmt.Sprintf("%s: unreachable, all signatures together score %d, below the confidence of %.0f%%",
+				where, maxScore, this.MinConfidence*100))
+		}
+		keys := []string{}
+		patterns := map[string]bool{}
+		for _, group := range osEntry.groups {
+			for _, pattern := range group.patterns {
+				key := group.field + " " + pattern.String()
+				if patterns[key] {
+					warnings = append(warnings, fmt.Sprintf("%s: %s pattern %q repeated", where, group.field, pattern.String()))
+				}
+				patterns[key] = true
+				keys = append(keys, group.weight+" "+key)
+			}
+		}
+		sort.Strings(keys)
+		key := strings.Join(keys, "\n")
+		if first, ok := seen[key]; ok && key != "" {
+			warnings = append(warnings, fmt.Sprintf("%s: unreachable, same signatures as %s which is checked first",
+				where, entryName(first, signatures[first].Name)))
+		} else {
+			seen[key] = i
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,116 @@
+package switchssh
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOSDataErrors(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		data     string
+		problems []string
+	}{
+		{"syntax", "[\n  {\"name\": \"Cisco IOS\",}\n]", []string{"line 2 column 25: invalid character '}'"}},
+		{"not a list", `{"name": "Cisco IOS"}`, []string{"must be a list of OS entries"}},
+		{"unknown field", `[{"name": "Cisco IOS", "signatures": [{"pattern": "IOS"}], "promt": "#$"}]`,
+			[]string{`entry 1 (Cisco IOS): unknown field "promt"`}},
+		{"wrong type", `[{"name": "Cisco IOS", "signatures": [{"pattern": "IOS"}], "probes": 1}]`,
+			[]string{"entry 1 (Cisco IOS): probes must be"}},
+		{"invalid regexes", `[
+			{"name": "Cisco IOS", "signatures": [{"pattern": "IOS"}, {"field": "prompt", "pattern": "(#$"}], "errors": ["% Invalid", "[bad"]},
+			{"name": "Huawei VRP", "versions": ["VRP (R"]}]`,
+			[]string{`entry 1 (Cisco IOS): signatures[1]: invalid regex "(#$"`, `entry 1 (Cisco IOS): errors: invalid regex "[bad"`,
+				`entry 2 (Huawei VRP): versions: invalid regex "VRP (R"`}},
+		{"duplicate name", `[{"name": "Cisco IOS", "models": ["C2960"]}, {"name": "Cisco IOS XE", "models": ["C9300"]}, {"name": "Cisco IOS", "models": ["C3750"]}]`,
+			[]string{"entry 3 (Cisco IOS): name already used by entry 1"}},
+		{"unknown names", `[{"signatures": [{"field": "motd", "pattern": "IOS", "weight": "medium"}], "getters": {"arp": "show arp"}}]`,
+			[]string{"entry 1: name is missing", `entry 1: signatures[0]: unknown field "motd"`, `entry 1: signatures[0]: unknown weight "medium"`,
+				`entry 1: getters: unknown getter "arp"`}},
+		{"never detected", `[{"name": "Cisco IOS", "probes": ["show version", " "]}]`,
+			[]string{"entry 1 (Cisco IOS): no models, versions or signatures", "entry 1 (Cisco IOS): probes: empty command"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseOSData([]byte(test.data))
+			if err == nil {
+				t.Fatal("invalid OS data accepted")
+			}
+			// All problems are reported together, one per line
+			for _, problem := range test.problems {
+				if !strings.Contains(err.Error(), problem) {
+					t.Errorf("%q not reported in:\n%s", problem, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileSignaturesInvalidRegex(t *testing.T) {
+	for _, test := range []struct {
+		osEntry OS
+		err     string
+	}{
+		{OS{Name: "Cisco IOS", Models: []string{"C2960", "WS-(C3750"}}, `Cisco IOS: models: invalid regex "WS-(C3750"`},
+		{OS{Name: "Cisco IOS", Versions: []string{"12\\.2("}}, `Cisco IOS: versions: invalid regex "12\\.2("`},
+		{OS{Name: "Huawei VRP", Signatures: []Signature{{Pattern: "VRP"}, {Field: SignalPrompt, Pattern: "<[a-z"}}},
+			`Huawei VRP: signatures[1]: invalid regex "<[a-z"`},
+	} {
+		if _, err := compileSignatures(test.osEntry); err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("expected %q, got %v", test.err, err)
+		}
+	}
+	client := newTestClient(t)
+	defer client.Close()
+	if err := client.SetOSData([]OS{{Name: "Huawei VRP", Signatures: []Signature{{Pattern: "VRP("}}}}); err == nil {
+		t.Error("invalid OS data set")
+	}
+}
+
+func TestLintOSData(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+	osData := []OS{
+		{Name: "Cisco IOS", Signatures: []Signature{
+			{Field: SignalSSHVersion, Pattern: "^SSH-2\\.0-Cisco", Weight: WeightStrong},
+			{Pattern: "Cisco IOS Software", Weight: WeightStrong},
+		}},
+		// Same signatures in another order
+		{Name: "Cisco IOS copy", Signatures: []Signature{
+			{Pattern: "Cisco IOS Software", Weight: WeightStrong},
+			{Field: SignalSSHVersion, Pattern: "^SSH-2\\.0-Cisco", Weight: WeightStrong},
+		}},
+		// Same patterns, but another weight
+		{Name: "Cisco IOS XE", Signatures: []Signature{
+			{Field: SignalSSHVersion, Pattern: "^SSH-2\\.0-Cisco", Weight: WeightStrong},
+			{Pattern: "Cisco IOS Software", Weight: WeightRequired},
+		}},
+		{Name: "Generic", Signatures: []Signature{{Pattern: "Version \\d+"}, {Field: SignalPrompt, Pattern: "#$"}}},
+		{Name: "Huawei VRP", Signatures: []Signature{
+			{Pattern: "Huawei Versatile Routing Platform", Weight: WeightStrong},
+			{Pattern: "Huawei Versatile Routing Platform"},
+		}},
+	}
+	if err := client.SetOSData(osData); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"entry 2 (Cisco IOS copy): unreachable, same signatures as entry 1 (Cisco IOS) which is checked first",
+		"entry 4 (Generic): unreachable, all signatures together score 2, below the confidence of 50%",
+		`entry 5 (Huawei VRP): output pattern "Huawei Versatile Routing Platform" repeated`,
+	}
+	if warnings := client.LintOSData(); !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("warnings\n%s\nexpected\n%s", strings.Join(warnings, "\n"), strings.Join(expected, "\n"))
+	}
+
+	client.MinConfidence = 0.3
+	if warnings := client.LintOSData(); len(warnings) != 2 {
+		t.Errorf("warnings with a lower confidence %q", warnings)
+	}
+	if err := client.LoadOSData("../devices.json"); err != nil {
+		t.Fatal(err)
+	}
+	if warnings := client.LintOSData(); len(warnings) != 0 {
+		t.Errorf("warnings of devices.json %q", warnings)
+	}
+}
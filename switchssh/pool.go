@@ -0,0 +1,157 @@
+package switchssh
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+/**
+ * Settings of RunPool.
+ *
+ * @attr Workers      Maximum number of devices processed at the same time (values below 1 mean 1)
+ * @attr HostTimeout  Deadline for processing a single device, 0 means no deadline
+ * @attr SubnetDelay  Minimum delay between starting devices of the same subnet, 0 disables the rate limit
+ * @attr SubnetPrefix Prefix length grouping IPv4 devices into subnets for the rate limit (default 24, IPv6 uses 64)
+ */
+type PoolOptions struct {
+	Workers      int
+	HostTimeout  time.Duration
+	SubnetDelay  time.Duration
+	SubnetPrefix int
+}
+
+/**
+ * Processes the targets with a bounded number of workers.
+ * The job is called once per target with its index, so results can be stored by index and read
+ * in the order of the targets regardless of the completion order.
+ * Jobs for the same target are serialized by the session locks of the client.
+ * Targets not started yet are skipped when the context is cancelled.
+ *
+ * @param ctx     Context of the whole run
+ * @param targets Devices to process
+ * @param options Number of workers, per-device deadline and subnet rate limit
+ * @param job     Function processing a single device, its context carries the per-device deadline
+ * @return        The context error if the run was cancelled before all targets were started
+ */
+func (this *Client) RunPool(ctx context.Context, targets []Target, options PoolOptions, job func(ctx context.Context, index int, target Target)) error {
+	workers := options.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	limiter := newSubnetLimiter(options.SubnetDelay, options.SubnetPrefix)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				target := targets[index]
+				if err := limiter.wait(ctx, target.Address); err != nil {
+					continue
+				}
+				this.runPoolJob(ctx, options.HostTimeout, index, target, job)
+			}
+		}()
+	}
+	var err error
+dispatch:
+	for index := range targets {
+		select {
+		case indexes <- index:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	return err
+}
+
+func (this *Client) runPoolJob(ctx context.Context, timeout time.Duration, index int, target Target, job func(ctx context.Context, index int, target Target)) {
+	defer func() {
+		if err := recover(); err != nil {
+			this.LogError("RunPool job for %s err:%s", target.Address, err)
+		}
+	}()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	job(ctx, index, target)
+}
+
+/**
+ * Spaces out the start of devices in the same subnet.
+ *
+ * @attr delay  Minimum delay between two starts in the same subnet, 0 disables the limiter
+ * @attr prefix IPv4 prefix length of a subnet
+ * @attr next   Earliest start time of the next device, per subnet
+ * @attr locker Lock of next
+ */
+type subnetLimiter struct {
+	delay  time.Duration
+	prefix int
+	next   map[string]time.Time
+	locker sync.Mutex
+}
+
+func newSubnetLimiter(delay time.Duration, prefix int) *subnetLimiter {
+	if prefix <= 0 || prefix > 32 {
+		prefix = 24
+	}
+	return &subnetLimiter{delay: delay, prefix: prefix, next: make(map[string]time.Time)}
+}
+
+/**
+ * Waits until a device of the subnet of the address may be started.
+ *
+ * @param ctx     Context of the run
+ * @param address Device IP and port
+ * @return        The context error when cancelled while waiting
+ */
+func (this *subnetLimiter) wait(ctx context.Context, address string) error {
+	if this.delay <= 0 {
+		return ctx.Err()
+	}
+	key := this.subnet(address)
+	this.locker.Lock()
+	now := time.Now()
+	start := this.next[key]
+	if start.Before(now) {
+		start = now
+	}
+	this.next[key] = start.Add(this.delay)
+	this.locker.Unlock()
+
+	timer := time.NewTimer(start.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/**
+ * Returns the subnet of the address, host names are their own subnet.
+ */
+func (this *subnetLimiter) subnet(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(this.prefix, 32)), Mask: net.CIDRMask(this.prefix, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
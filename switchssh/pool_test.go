@@ -0,0 +1,166 @@
+package switchssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// records how many jobs run at once, overall and per subnet, and when each job started
+type poolRecorder struct {
+	locker    sync.Mutex
+	running   int
+	maxAll    int
+	perSubnet map[string]int
+	maxSubnet map[string]int
+	starts    map[string][]time.Time
+}
+
+func newPoolRecorder() *poolRecorder {
+	return &poolRecorder{perSubnet: map[string]int{}, maxSubnet: map[string]int{}, starts: map[string][]time.Time{}}
+}
+
+func (this *poolRecorder) run(subnet string, duration time.Duration) {
+	this.locker.Lock()
+	this.running++
+	this.perSubnet[subnet]++
+	this.maxAll = max(this.maxAll, this.running)
+	this.maxSubnet[subnet] = max(this.maxSubnet[subnet], this.perSubnet[subnet])
+	this.starts[subnet] = append(this.starts[subnet], time.Now())
+	this.locker.Unlock()
+	time.Sleep(duration)
+	this.locker.Lock()
+	this.running--
+	this.perSubnet[subnet]--
+	this.locker.Unlock()
+}
+
+func poolTargets(subnets []string, perSubnet int) []Target {
+	targets := []Target{}
+	for i := 0; i < perSubnet; i++ {
+		for _, subnet := range subnets {
+			targets = append(targets, Target{Address: fmt.Sprintf("%s.%d:22", subnet, i+1)})
+		}
+	}
+	return targets
+}
+
+func TestRunPoolOrderAndWorkers(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+	targets := poolTargets([]string{"10.0.1", "10.0.2", "10.0.3"}, 4)
+	recorder := newPoolRecorder()
+	results := make([]string, len(targets))
+	err := client.RunPool(context.Background(), targets, PoolOptions{Workers: 3}, func(ctx context.Context, index int, target Target) {
+		// Later targets finish first
+		recorder.run("all", time.Duration(len(targets)-index)*2*time.Millisecond)
+		results[index] = target.Address
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, target := range targets {
+		if results[i] != target.Address {
+			t.Errorf("result %d is %q, expected %q", i, results[i], target.Address)
+		}
+	}
+	if recorder.maxAll != 3 {
+		t.Errorf("%d jobs ran at once, expected 3", recorder.maxAll)
+	}
+}
+
+func TestRunPoolSubnetLimit(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+	subnets := []string{"10.0.1", "10.0.2"}
+	targets := poolTargets(subnets, 4)
+	delay := 40 * time.Millisecond
+	recorder := newPoolRecorder()
+	limiter := newSubnetLimiter(delay, 24)
+	err := client.RunPool(context.Background(), targets, PoolOptions{Workers: 8, SubnetDelay: delay}, func(ctx context.Context, index int, target Target) {
+		recorder.run(limiter.subnet(target.Address), 10*time.Millisecond)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder.maxAll < 2 {
+		t.Errorf("%d jobs ran at once, the subnets should run in parallel", recorder.maxAll)
+	}
+	for _, subnet := range []string{"10.0.1.0/24", "10.0.2.0/24"} {
+		if recorder.maxSubnet[subnet] != 1 {
+			t.Errorf("%d jobs of %s ran at once, expected 1", recorder.maxSubnet[subnet], subnet)
+		}
+		starts := recorder.starts[subnet]
+		if len(starts) != 4 {
+			t.Fatalf("%d jobs of %s started", len(starts), subnet)
+		}
+		for i := 1; i < len(starts); i++ {
+			// The timers may fire a little early on a loaded machine
+			if gap := starts[i].Sub(starts[i-1]); gap < delay-5*time.Millisecond {
+				t.Errorf("jobs of %s started %s apart, expected at least %s", subnet, gap, delay)
+			}
+		}
+	}
+}
+
+func TestRunPoolCancel(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+	targets := poolTargets([]string{"10.0.1"}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := 0
+	err := client.RunPool(ctx, targets, PoolOptions{Workers: 1}, func(ctx context.Context, index int, target Target) {
+		started++
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if started != 1 {
+		t.Errorf("%d jobs started after the cancellation, expected none", started-1)
+	}
+}
+
+func TestRunPoolHostTimeoutAndPanic(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+	targets := poolTargets([]string{"10.0.1"}, 2)
+	timedOut := make([]bool, len(targets))
+	err := client.RunPool(context.Background(), targets, PoolOptions{Workers: 1, HostTimeout: 20 * time.Millisecond}, func(ctx context.Context, index int, target Target) {
+		<-ctx.Done()
+		timedOut[index] = errors.Is(ctx.Err(), context.DeadlineExceeded)
+		if index == 0 {
+			panic("job failed")
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !timedOut[0] || !timedOut[1] {
+		t.Errorf("per-host deadline not applied: %v", timedOut)
+	}
+}
+
+func TestSubnetLimiterSubnet(t *testing.T) {
+	limiter := newSubnetLimiter(time.Second, 0)
+	wide := newSubnetLimiter(time.Second, 16)
+	for _, test := range []struct {
+		limiter  *subnetLimiter
+		address  string
+		expected string
+	}{
+		{limiter, "10.0.1.7:22", "10.0.1.0/24"},
+		{limiter, "10.0.1.200", "10.0.1.0/24"},
+		{wide, "10.0.1.7:22", "10.0.0.0/16"},
+		{limiter, "[2001:db8::1]:22", "2001:db8::/64"},
+		{limiter, "sw1.example.com:22", "sw1.example.com"},
+	} {
+		if subnet := test.limiter.subnet(test.address); subnet != test.expected {
+			t.Errorf("subnet of %s: %s, expected %s", test.address, subnet, test.expected)
+		}
+	}
+}
@@ -0,0 +1,580 @@
+package switchssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// SNMP transport: data is read from the MIBs of the device, commands cannot be run.
+const TransportSNMP = "snmp"
+
+// SNMPv2-MIB objects read for the detection
+const (
+	oidSysDescr    = "1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = "1.3.6.1.2.1.1.2.0"
+)
+
+// Columns of the tables walked for the MAC address table
+const (
+	oidIfDescr              = "1.3.6.1.2.1.2.2.1.2"
+	oidIfName               = "1.3.6.1.2.1.31.1.1.1.1"
+	oidDot1dBasePortIfIndex = "1.3.6.1.2.1.17.1.4.1.2"
+	oidDot1dTpFdbPort       = "1.3.6.1.2.1.17.4.3.1.2"
+	oidDot1dTpFdbStatus     = "1.3.6.1.2.1.17.4.3.1.3"
+	oidDot1qTpFdbPort       = "1.3.6.1.2.1.17.7.1.2.2.1.2"
+	oidDot1qTpFdbStatus     = "1.3.6.1.2.1.17.7.1.2.2.1.3"
+	oidDot1qVlanFdbId       = "1.3.6.1.2.1.17.7.1.4.2.1.3"
+	oidDot1qPvid            = "1.3.6.1.2.1.17.7.1.4.5.1.1"
+	// CISCO-VTP-MIB vtpVlanState and CISCO-VLAN-MEMBERSHIP-MIB vmVlan
+	oidCiscoVtpVlanState = "1.3.6.1.4.1.9.9.46.1.3.1.1.2"
+	oidCiscoVmVlan       = "1.3.6.1.4.1.9.9.68.1.2.2.1.2"
+)
+
+// retries of SNMP requests, and rows requested at once by GETBULK
+const (
+	snmpRetries        = 2
+	snmpMaxRepetitions = 20
+)
+
+// dot1dTpFdbStatus and dot1qTpFdbStatus values
+const (
+	fdbStatusInvalid = 2
+	fdbStatusLearned = 3
+)
+
+var snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"":       gosnmp.NoAuth,
+	"md5":    gosnmp.MD5,
+	"sha":    gosnmp.SHA,
+	"sha224": gosnmp.SHA224,
+	"sha256": gosnmp.SHA256,
+	"sha384": gosnmp.SHA384,
+	"sha512": gosnmp.SHA512,
+}
+
+var snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"":        gosnmp.NoPriv,
+	"des":     gosnmp.DES,
+	"aes":     gosnmp.AES,
+	"aes192":  gosnmp.AES192,
+	"aes256":  gosnmp.AES256,
+	"aes192c": gosnmp.AES192C,
+	"aes256c": gosnmp.AES256C,
+}
+
+/**
+ * SNMP credentials of a device: a community for SNMPv2c, or a user for SNMPv3.
+ *
+ * @attr Community    SNMPv2c community, used when User is empty
+ * @attr User         SNMPv3 user name
+ * @attr AuthProtocol SNMPv3 authentication protocol: md5, sha, sha224, sha256, sha384, sha512 (empty: no authentication)
+ * @attr AuthPassword SNMPv3 authentication passphrase
+ * @attr PrivProtocol SNMPv3 privacy protocol: des, aes, aes192, aes256, aes192c, aes256c (empty: no privacy)
+ * @attr PrivPassword SNMPv3 privacy passphrase
+ */
+type SNMPCredentials struct {
+	Community    string `yaml:"community" json:"community,omitempty"`
+	User         string `yaml:"user" json:"user,omitempty"`
+	AuthProtocol string `yaml:"auth-protocol" json:"auth-protocol,omitempty"`
+	AuthPassword string `yaml:"auth-password" json:"auth-password,omitempty"`
+	PrivProtocol string `yaml:"priv-protocol" json:"priv-protocol,omitempty"`
+	PrivPassword string `yaml:"priv-password" json:"priv-password,omitempty"`
+}
+
+/**
+ * Checks the protocols of the credentials.
+ */
+func (this SNMPCredentials) validate() error {
+	if this.User == "" {
+		if this.Community == "" {
+			return errors.New("SNMP credentials need a community or a user")
+		}
+		return nil
+	}
+	if _, ok := snmpAuthProtocols[strings.ToLower(this.AuthProtocol)]; !ok {
+		return fmt.Errorf("unknown SNMP authentication protocol %s", this.AuthProtocol)
+	}
+	if _, ok := snmpPrivProtocols[strings.ToLower(this.PrivProtocol)]; !ok {
+		return fmt.Errorf("unknown SNMP privacy protocol %s", this.PrivProtocol)
+	}
+	if this.PrivProtocol != "" && this.AuthProtocol == "" {
+		return errors.New("SNMP privacy needs an authentication protocol")
+	}
+	return nil
+}
+
+/**
+ * Opens an SNMP session to the host of the target, on Client.SNMPPort.
+ *
+ * @param ctx    Context of the requests
+ * @param target Target with SNMP credentials
+ * @param vlan   VLAN whose bridge tables to read (Cisco community string indexing), 0 for the default context
+ * @return       Connected session and errors
+ */
+func (this *Client) snmpConnect(ctx context.Context, target Target, vlan int) (*gosnmp.GoSNMP, error) {
+	cred := target.Credentials.SNMP
+	if cred == nil {
+		return nil, fmt.Errorf("%s: no SNMP credentials", target.Address)
+	}
+	if err := cred.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", target.Address, err)
+	}
+	if len(target.JumpHosts) > 0 {
+		return nil, fmt.Errorf("%s: SNMP through jump hosts: %w", target.Address, ErrNotSupported)
+	}
+	host, _, err := net.SplitHostPort(target.Address)
+	if err != nil {
+		host = target.Address
+	}
+	conn := &gosnmp.GoSNMP{
+		Target:         host,
+		Port:           uint16(this.SNMPPort),
+		Transport:      "udp",
+		Context:        ctx,
+		Timeout:        this.SNMPTimeout,
+		Retries:        snmpRetries,
+		MaxOids:        gosnmp.MaxOids,
+		MaxRepetitions: snmpMaxRepetitions,
+	}
+	if cred.User == "" {
+		conn.Version = gosnmp.Version2c
+		conn.Community = cred.Community
+		if vlan != 0 {
+			conn.Community = fmt.Sprintf("%s@%d", cred.Community, vlan)
+		}
+	} else {
+		conn.Version = gosnmp.Version3
+		conn.SecurityModel = gosnmp.UserSecurityModel
+		conn.MsgFlags = gosnmp.NoAuthNoPriv
+		if cred.AuthProtocol != "" {
+			conn.MsgFlags = gosnmp.AuthNoPriv
+		}
+		if cred.PrivProtocol != "" {
+			conn.MsgFlags = gosnmp.AuthPriv
+		}
+		conn.SecurityParameters = &gosnmp.UsmSecurityParameters{
+			UserName:                 cred.User,
+			AuthenticationProtocol:   snmpAuthProtocols[strings.ToLower(cred.AuthProtocol)],
+			AuthenticationPassphrase: cred.AuthPassword,
+			PrivacyProtocol:          snmpPrivProtocols[strings.ToLower(cred.PrivProtocol)],
+			PrivacyPassphrase:        cred.PrivPassword,
+		}
+		if vlan != 0 {
+			conn.ContextName = fmt.Sprintf("vlan-%d", vlan)
+		}
+	}
+	if err := conn.Connect(); err != nil {
+		return nil, classifyDialError(ctx, fmt.Errorf("%s: %w", target.Address, err))
+	}
+	conn.Conn = &snmpConn{Conn: conn.Conn}
+	return conn, nil
+}
+
+/**
+ * Socket of an SNMP session keeping the error of the last read: gosnmp replaces the timeout error of
+ * the last retry by a message, the timeout is recognized by the net.Error of the read.
+ *
+ * @attr readErr Error of the last read, nil after a datagram was received
+ */
+type snmpConn struct {
+	net.Conn
+	readErr error
+}
+
+func (this *snmpConn) Read(b []byte) (int, error) {
+	n, err := this.Conn.Read(b)
+	this.readErr = err
+	return n, err
+}
+
+// value of a walked table column, by the index following the column OID
+type snmpValue struct {
+	index string
+	pdu   gosnmp.SnmpPDU
+}
+
+/**
+ * Adds the host and the failed request to an SNMP error. No answer at all is reported as ErrConnectTimeout,
+ * since SNMPv2c agents do not answer unknown communities.
+ */
+func snmpError(conn *gosnmp.GoSNMP, request string, err error) error {
+	if conn.Context.Err() != nil {
+		return conn.Context.Err()
+	}
+	readErr := err
+	if socket, ok := conn.Conn.(*snmpConn); ok && socket.readErr != nil {
+		readErr = socket.readErr
+	}
+	var netErr net.Error
+	if errors.As(readErr, &netErr) && netErr.Timeout() {
+		err = withKind(ErrConnectTimeout, err)
+	}
+	return fmt.Errorf("%s: %s: %w", conn.Target, request, err)
+}
+
+/**
+ * Walks a table column. Missing tables are not an error: the result is empty.
+ */
+func snmpWalk(conn *gosnmp.GoSNMP, oid string) ([]snmpValue, error) {
+	pdus, err := conn.BulkWalkAll(oid)
+	if err != nil {
+		return nil, snmpError(conn, "walking "+oid, err)
+	}
+	values := make([]snmpValue, 0, len(pdus))
+	for _, pdu := range pdus {
+		switch pdu.Type {
+		case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView:
+			continue
+		}
+		index := strings.TrimPrefix(strings.TrimPrefix(pdu.Name, "."), oid+".")
+		values = append(values, snmpValue{index, pdu})
+	}
+	return values, nil
+}
+
+// walks a table column of integers indexed by a single integer
+func snmpWalkInts(conn *gosnmp.GoSNMP, oid string) (map[int]int, error) {
+	values, err := snmpWalk(conn, oid)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]int, len(values))
+	for _, value := range values {
+		if index, err := strconv.Atoi(value.index); err == nil {
+			result[index] = int(gosnmp.ToBigInt(value.pdu.Value).Int64())
+		}
+	}
+	return result, nil
+}
+
+// returns the MAC address encoded in the last six components of a table index
+func snmpIndexMAC(index string) (string, bool) {
+	parts := strings.Split(index, ".")
+	if len(parts) < 6 {
+		return "", false
+	}
+	digits := ""
+	for _, part := range parts[len(parts)-6:] {
+		b, err := strconv.Atoi(part)
+		if err != nil || b < 0 || b > 255 {
+			return "", false
+		}
+		digits += fmt.Sprintf("%02x", b)
+	}
+	return NormalizeMAC(digits)
+}
+
+// names of the interfaces by ifIndex: ifName, or ifDescr for interfaces without one
+func snmpInterfaceNames(conn *gosnmp.GoSNMP) (map[int]string, error) {
+	names := make(map[int]string)
+	for _, oid := range []string{oidIfName, oidIfDescr} {
+		values, err := snmpWalk(conn, oid)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			index, err := strconv.Atoi(value.index)
+			if err != nil || names[index] != "" {
+				continue
+			}
+			if name, ok := value.pdu.Value.([]byte); ok && len(name) > 0 {
+				names[index] = string(name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// bridge tables of a device, or of one VLAN for Cisco community string indexing
+type snmpBridge struct {
+	names     map[int]string
+	portIndex map[int]int
+	status    map[string]int
+	fdbPorts  []snmpValue
+	portVLAN  func(port int) int
+	fdbVLAN   func(index string) int
+}
+
+// returns the name of the interface of a bridge port
+func (this snmpBridge) interfaceName(port int) string {
+	if port == 0 {
+		return "CPU"
+	}
+	ifIndex, ok := this.portIndex[port]
+	if !ok {
+		return fmt.Sprintf("bridge-port-%d", port)
+	}
+	if name, ok := this.names[ifIndex]; ok {
+		return name
+	}
+	return fmt.Sprintf("ifIndex-%d", ifIndex)
+}
+
+// converts the walked forwarding table to MAC table entries
+func (this snmpBridge) entries() []MacEntry {
+	entries := []MacEntry{}
+	for _, value := range this.fdbPorts {
+		mac, ok := snmpIndexMAC(value.index)
+		if !ok {
+			continue
+		}
+		status := this.status[value.index]
+		if status == fdbStatusInvalid {
+			continue
+		}
+		port := int(gosnmp.ToBigInt(value.pdu.Value).Int64())
+		entry := MacEntry{MAC: mac, Interface: this.interfaceName(port), Type: MacStatic}
+		// agents without the status column report learned entries only
+		if status == fdbStatusLearned || status == 0 {
+			entry.Type = MacDynamic
+		}
+		if this.fdbVLAN != nil {
+			entry.VLAN = this.fdbVLAN(value.index)
+		} else {
+			entry.VLAN = this.portVLAN(port)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// walks the status column of the forwarding table, by the index of the entries
+func snmpWalkStatus(conn *gosnmp.GoSNMP, oid string) (map[string]int, error) {
+	values, err := snmpWalk(conn, oid)
+	if err != nil {
+		return nil, err
+	}
+	status := make(map[string]int, len(values))
+	for _, value := range values {
+		status[value.index] = int(gosnmp.ToBigInt(value.pdu.Value).Int64())
+	}
+	return status, nil
+}
+
+/**
+ * Reads the forwarding table of a Q-BRIDGE-MIB device: dot1qTpFdbPort is indexed by the filtering database,
+ * mapped to its VLAN by dot1qVlanFdbId (devices without it use the VLAN number as the database number).
+ */
+func snmpQBridge(conn *gosnmp.GoSNMP, bridge *snmpBridge) error {
+	var err error
+	if bridge.status, err = snmpWalkStatus(conn, oidDot1qTpFdbStatus); err != nil {
+		return err
+	}
+	fdbIds, err := snmpWalk(conn, oidDot1qVlanFdbId)
+	if err != nil {
+		return err
+	}
+	fdbVLANs := make(map[int]int)
+	for _, value := range fdbIds {
+		// index: dot1qVlanTimeMark.dot1qVlanIndex
+		parts := strings.Split(value.index, ".")
+		vlan, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil {
+			continue
+		}
+		fdbId := int(gosnmp.ToBigInt(value.pdu.Value).Int64())
+		if _, ok := fdbVLANs[fdbId]; !ok {
+			fdbVLANs[fdbId] = vlan
+		}
+	}
+	bridge.fdbVLAN = func(index string) int {
+		fdbId, _ := strconv.Atoi(strings.SplitN(index, ".", 2)[0])
+		if vlan, ok := fdbVLANs[fdbId]; ok {
+			return vlan
+		}
+		return fdbId
+	}
+	return nil
+}
+
+/**
+ * Reads the BRIDGE-MIB forwarding table of the default context. The VLAN of an entry is the
+ * port VLAN of its bridge port (dot1qPvid), or the access VLAN of its interface on Cisco devices (vmVlan).
+ */
+func snmpBridgeVLANs(conn *gosnmp.GoSNMP, bridge *snmpBridge) error {
+	var err error
+	if bridge.status, err = snmpWalkStatus(conn, oidDot1dTpFdbStatus); err != nil {
+		return err
+	}
+	pvids, err := snmpWalkInts(conn, oidDot1qPvid)
+	if err != nil {
+		return err
+	}
+	accessVLANs, err := snmpWalkInts(conn, oidCiscoVmVlan)
+	if err != nil {
+		return err
+	}
+	bridge.portVLAN = func(port int) int {
+		if vlan, ok := pvids[port]; ok {
+			return vlan
+		}
+		return accessVLANs[bridge.portIndex[port]]
+	}
+	return nil
+}
+
+/**
+ * Reads the system description and the system object identifier of the target over SNMP.
+ *
+ * @param ctx      Context of the requests
+ * @param target   Switch address and SNMP credentials (Credentials.SNMP)
+ * @return         sysDescr, sysObjectID (dotted, without the leading dot; empty if the agent has none) and errors
+ */
+func (this *Client) SNMPSystemContext(ctx context.Context, target Target) (string, string, error) {
+	conn, err := this.snmpConnect(ctx, target, 0)
+	if err != nil {
+		return "", "", err
+	}
+	defer conn.Conn.Close()
+
+	result, err := conn.Get([]string{oidSysDescr, oidSysObjectID})
+	if err != nil {
+		return "", "", snmpError(conn, "reading sysDescr and sysObjectID", err)
+	}
+	descr, objectID := "", ""
+	for _, pdu := range result.Variables {
+		switch value := pdu.Value.(type) {
+		case []byte:
+			descr = string(value)
+		case string:
+			if pdu.Type == gosnmp.ObjectIdentifier {
+				objectID = strings.TrimPrefix(value, ".")
+			}
+		}
+	}
+	return descr, objectID, nil
+}
+
+/**
+ * Detects the OS of the target over SNMP, without logging in: the sysDescr is scored by the output signatures
+ * (it holds the first lines of show version on most devices) and the sysObjectID by the sysobjectid signatures.
+ *
+ * @param ctx      Context of the requests
+ * @param target   Switch address and SNMP credentials (Credentials.SNMP)
+ * @return         OS candidates, best first (see DetectOS), and errors
+ */
+func (this *Client) SNMPDetectContext(ctx context.Context, target Target) ([]Candidate, error) {
+	descr, objectID, err := this.SNMPSystemContext(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return this.DetectOS(DetectionSignals{Output: descr, SysObjectID: objectID}), nil
+}
+
+/**
+ * Returns the OS of an SNMP target: the OS set by the target, or the detected one.
+ * Undetected devices are saved with the unknown models, as over SSH.
+ */
+func (this *Client) snmpBrandContext(ctx context.Context, target Target) (string, error) {
+	if target.OS != "" {
+		return target.OS, nil
+	}
+	descr, objectID, err := this.SNMPSystemContext(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	candidates := this.DetectOS(DetectionSignals{Output: descr, SysObjectID: objectID})
+	this.LogDebug("SNMP %s candidates: %s", target.Address, FormatCandidates(candidates))
+	detected := this.detectedOS(candidates)
+	if detected == nil {
+		this.saveUnknownModel(fmt.Sprintf("----------------BEGIN---------------\nsysObjectID: %s\n%s\n--------------------------END---------------------\n", objectID, descr))
+		return "", nil
+	}
+	return detected.Name, nil
+}
+
+/**
+ * Reads the MAC address table of the target over SNMP (SNMPv2c, or SNMPv3 when the credentials have a user).
+ * Q-BRIDGE-MIB devices are read in one pass. Others are read from BRIDGE-MIB; on Cisco devices, which only
+ * show the table of one VLAN per context, every VLAN of CISCO-VTP-MIB is read through its own context
+ * (community@vlan, or the vlan-N context of SNMPv3).
+ *
+ * @param ctx      Context of the requests
+ * @param target   Switch address and SNMP credentials (Credentials.SNMP), the port is replaced by Client.SNMPPort
+ * @return         Entries in the same form as MacTableContext (the age is not known), and errors
+ */
+func (this *Client) SNMPMacTableContext(ctx context.Context, target Target) ([]MacEntry, error) {
+	conn, err := this.snmpConnect(ctx, target, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Conn.Close()
+
+	bridge := snmpBridge{}
+	if bridge.names, err = snmpInterfaceNames(conn); err != nil {
+		return nil, err
+	}
+	if bridge.portIndex, err = snmpWalkInts(conn, oidDot1dBasePortIfIndex); err != nil {
+		return nil, err
+	}
+	if bridge.fdbPorts, err = snmpWalk(conn, oidDot1qTpFdbPort); err != nil {
+		return nil, err
+	}
+	if len(bridge.fdbPorts) > 0 {
+		this.LogDebug("SNMP %s: Q-BRIDGE-MIB forwarding table", conn.Target)
+		if err := snmpQBridge(conn, &bridge); err != nil {
+			return nil, err
+		}
+		return bridge.entries(), nil
+	}
+
+	vlanStates, err := snmpWalk(conn, oidCiscoVtpVlanState)
+	if err != nil {
+		return nil, err
+	}
+	ciscoVLANs := []int{}
+	for _, value := range vlanStates {
+		// index: managementDomainIndex.vtpVlanIndex, operational VLANs only, without the FDDI and Token Ring ones
+		parts := strings.Split(value.index, ".")
+		vlan, err := strconv.Atoi(parts[len(parts)-1])
+		if err == nil && gosnmp.ToBigInt(value.pdu.Value).Int64() == 1 && (vlan < 1002 || vlan > 1005) {
+			ciscoVLANs = append(ciscoVLANs, vlan)
+		}
+	}
+	if len(ciscoVLANs) == 0 {
+		this.LogDebug("SNMP %s: BRIDGE-MIB forwarding table", conn.Target)
+		if bridge.fdbPorts, err = snmpWalk(conn, oidDot1dTpFdbPort); err != nil {
+			return nil, err
+		}
+		if err := snmpBridgeVLANs(conn, &bridge); err != nil {
+			return nil, err
+		}
+		return bridge.entries(), nil
+	}
+
+	sort.Ints(ciscoVLANs)
+	entries := []MacEntry{}
+	for _, vlan := range ciscoVLANs {
+		this.LogDebug("SNMP %s: BRIDGE-MIB forwarding table of VLAN %d", conn.Target, vlan)
+		vlanConn, err := this.snmpConnect(ctx, target, vlan)
+		if err != nil {
+			return nil, err
+		}
+		vlanBridge := snmpBridge{names: bridge.names, portVLAN: func(int) int { return vlan }}
+		vlanBridge.portIndex, err = snmpWalkInts(vlanConn, oidDot1dBasePortIfIndex)
+		if err == nil {
+			vlanBridge.fdbPorts, err = snmpWalk(vlanConn, oidDot1dTpFdbPort)
+		}
+		if err == nil {
+			vlanBridge.status, err = snmpWalkStatus(vlanConn, oidDot1dTpFdbStatus)
+		}
+		vlanConn.Conn.Close()
+		// VLANs without a bridge instance (e.g. no port in them) may not answer at all
+		if errors.Is(err, ErrConnectTimeout) {
+			this.LogDebug("SNMP %s: VLAN %d skipped: %s", conn.Target, vlan, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, vlanBridge.entries()...)
+	}
+	return entries, nil
+}
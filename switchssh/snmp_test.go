@@ -0,0 +1,333 @@
+package switchssh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// SNMPv2c agent standing in for a switch: the objects of each community, communities without objects are not answered
+type snmpStandIn struct {
+	conn        *net.UDPConn
+	communities map[string][]gosnmp.SnmpPDU
+}
+
+func newSNMPStandIn(t *testing.T, communities map[string][]gosnmp.SnmpPDU) *snmpStandIn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	for _, pdus := range communities {
+		sort.Slice(pdus, func(i, j int) bool { return compareOID(pdus[i].Name, pdus[j].Name) < 0 })
+	}
+	standIn := &snmpStandIn{conn: conn, communities: communities}
+	go standIn.serve()
+	return standIn
+}
+
+func (this *snmpStandIn) port() int {
+	return this.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// compares two dotted OIDs component by component
+func compareOID(a, b string) int {
+	partsA := strings.Split(strings.TrimPrefix(a, "."), ".")
+	partsB := strings.Split(strings.TrimPrefix(b, "."), ".")
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		x, _ := strconv.Atoi(partsA[i])
+		y, _ := strconv.Atoi(partsB[i])
+		if x != y {
+			return x - y
+		}
+	}
+	return len(partsA) - len(partsB)
+}
+
+// returns up to count objects following the OID
+func (this *snmpStandIn) next(pdus []gosnmp.SnmpPDU, oid string, count int) []gosnmp.SnmpPDU {
+	result := []gosnmp.SnmpPDU{}
+	for _, pdu := range pdus {
+		if len(result) == count {
+			break
+		}
+		if compareOID(pdu.Name, oid) > 0 {
+			result = append(result, pdu)
+		}
+	}
+	if len(result) < count {
+		result = append(result, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.EndOfMibView})
+	}
+	return result
+}
+
+func (this *snmpStandIn) serve() {
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c}
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := this.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		request, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil {
+			continue
+		}
+		pdus, ok := this.communities[request.Community]
+		if !ok {
+			continue
+		}
+		variables := []gosnmp.SnmpPDU{}
+		for _, variable := range request.Variables {
+			switch request.PDUType {
+			case gosnmp.GetRequest:
+				found := gosnmp.SnmpPDU{Name: variable.Name, Type: gosnmp.NoSuchObject}
+				for _, pdu := range pdus {
+					if compareOID(pdu.Name, variable.Name) == 0 {
+						found = pdu
+					}
+				}
+				variables = append(variables, found)
+			case gosnmp.GetNextRequest:
+				variables = append(variables, this.next(pdus, variable.Name, 1)...)
+			case gosnmp.GetBulkRequest:
+				variables = append(variables, this.next(pdus, variable.Name, int(request.MaxRepetitions))...)
+			}
+		}
+		response := &gosnmp.SnmpPacket{
+			Version:   gosnmp.Version2c,
+			Community: request.Community,
+			PDUType:   gosnmp.GetResponse,
+			RequestID: request.RequestID,
+			Variables: variables,
+		}
+		if out, err := response.MarshalMsg(); err == nil {
+			this.conn.WriteToUDP(out, addr)
+		}
+	}
+}
+
+func snmpInt(oid string, value int) gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: "." + oid, Type: gosnmp.Integer, Value: value}
+}
+
+func snmpString(oid string, value string) gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: "." + oid, Type: gosnmp.OctetString, Value: []byte(value)}
+}
+
+func snmpOID(oid string, value string) gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: "." + oid, Type: gosnmp.ObjectIdentifier, Value: "." + value}
+}
+
+// MAC addresses of the forwarding tables, as table index suffixes
+const (
+	snmpMAC1 = "0.80.86.0.0.1"
+	snmpMAC2 = "0.80.86.0.0.2"
+	snmpMAC3 = "0.80.86.0.0.3"
+)
+
+func TestSNMPMacTable(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		communities map[string][]gosnmp.SnmpPDU
+		expected    []MacEntry
+	}{
+		{
+			name: "Q-BRIDGE-MIB",
+			communities: map[string][]gosnmp.SnmpPDU{"public": {
+				snmpString(oidIfName+".1", "Gi1/0/1"),
+				snmpString(oidIfName+".2", "Gi1/0/2"),
+				snmpInt(oidDot1dBasePortIfIndex+".1", 1),
+				snmpInt(oidDot1dBasePortIfIndex+".2", 2),
+				// filtering database 5 is VLAN 10, database 20 has no dot1qVlanFdbId and stands for VLAN 20
+				snmpInt(oidDot1qTpFdbPort+".5."+snmpMAC1, 1),
+				snmpInt(oidDot1qTpFdbPort+".20."+snmpMAC2, 2),
+				snmpInt(oidDot1qTpFdbPort+".20."+snmpMAC3, 0),
+				snmpInt(oidDot1qTpFdbStatus+".5."+snmpMAC1, fdbStatusLearned),
+				snmpInt(oidDot1qTpFdbStatus+".20."+snmpMAC2, 5),
+				snmpInt(oidDot1qTpFdbStatus+".20."+snmpMAC3, 4),
+				snmpInt(oidDot1qVlanFdbId+".0.10", 5),
+			}},
+			expected: []MacEntry{
+				{MAC: "00:50:56:00:00:01", VLAN: 10, Interface: "Gi1/0/1", Type: MacDynamic},
+				{MAC: "00:50:56:00:00:02", VLAN: 20, Interface: "Gi1/0/2", Type: MacStatic},
+				{MAC: "00:50:56:00:00:03", VLAN: 20, Interface: "CPU", Type: MacStatic},
+			},
+		},
+		{
+			name: "BRIDGE-MIB",
+			communities: map[string][]gosnmp.SnmpPDU{"public": {
+				snmpString(oidIfDescr+".1", "GigabitEthernet0/1"),
+				snmpString(oidIfDescr+".3", "FastEthernet0/3"),
+				snmpString(oidIfName+".1", "Gi0/1"),
+				snmpInt(oidDot1dBasePortIfIndex+".1", 1),
+				snmpInt(oidDot1dBasePortIfIndex+".2", 2),
+				snmpInt(oidDot1dBasePortIfIndex+".3", 3),
+				snmpInt(oidDot1dTpFdbPort+"."+snmpMAC1, 1),
+				snmpInt(oidDot1dTpFdbPort+"."+snmpMAC2, 2),
+				snmpInt(oidDot1dTpFdbPort+"."+snmpMAC3, 3),
+				snmpInt(oidDot1dTpFdbStatus+"."+snmpMAC1, fdbStatusLearned),
+				snmpInt(oidDot1dTpFdbStatus+"."+snmpMAC2, fdbStatusInvalid),
+				snmpInt(oidDot1dTpFdbStatus+"."+snmpMAC3, fdbStatusLearned),
+				// port 1 has a port VLAN, the interface of port 3 an access VLAN
+				snmpInt(oidDot1qPvid+".1", 10),
+				snmpInt(oidCiscoVmVlan+".3", 30),
+			}},
+			expected: []MacEntry{
+				{MAC: "00:50:56:00:00:01", VLAN: 10, Interface: "Gi0/1", Type: MacDynamic},
+				{MAC: "00:50:56:00:00:03", VLAN: 30, Interface: "FastEthernet0/3", Type: MacDynamic},
+			},
+		},
+		{
+			name: "Cisco community string indexing",
+			communities: map[string][]gosnmp.SnmpPDU{
+				"public": {
+					snmpString(oidIfName+".1", "Gi1/0/1"),
+					snmpString(oidIfName+".2", "Gi1/0/2"),
+					// operational VLANs 1, 10 and 30; VLAN 20 is suspended, 1002 is the FDDI default
+					snmpInt(oidCiscoVtpVlanState+".1.1", 1),
+					snmpInt(oidCiscoVtpVlanState+".1.10", 1),
+					snmpInt(oidCiscoVtpVlanState+".1.20", 2),
+					snmpInt(oidCiscoVtpVlanState+".1.30", 1),
+					snmpInt(oidCiscoVtpVlanState+".1.1002", 1),
+				},
+				"public@1": {
+					snmpInt(oidDot1dBasePortIfIndex+".1", 1),
+					snmpInt(oidDot1dTpFdbPort+"."+snmpMAC1, 1),
+					snmpInt(oidDot1dTpFdbStatus+"."+snmpMAC1, fdbStatusLearned),
+				},
+				"public@10": {
+					snmpInt(oidDot1dBasePortIfIndex+".2", 2),
+					snmpInt(oidDot1dTpFdbPort+"."+snmpMAC2, 2),
+					snmpInt(oidDot1dTpFdbStatus+"."+snmpMAC2, 5),
+				},
+				// VLAN 30 has no bridge instance, public@30 is not answered
+			},
+			expected: []MacEntry{
+				{MAC: "00:50:56:00:00:01", VLAN: 1, Interface: "Gi1/0/1", Type: MacDynamic},
+				{MAC: "00:50:56:00:00:02", VLAN: 10, Interface: "Gi1/0/2", Type: MacStatic},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			standIn := newSNMPStandIn(t, test.communities)
+			client := newTestClient(t)
+			defer client.Close()
+			client.SNMPPort = standIn.port()
+			client.SNMPTimeout = 100 * time.Millisecond
+			target := Target{
+				Address:     "127.0.0.1",
+				Credentials: Credentials{SNMP: &SNMPCredentials{Community: "public"}},
+				Transport:   TransportSNMP,
+			}
+			entries, err := client.SNMPMacTableContext(context.Background(), target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Slice(entries, func(i, j int) bool { return entries[i].MAC < entries[j].MAC })
+			if !reflect.DeepEqual(entries, test.expected) {
+				t.Errorf("read:\n%s\nexpected:\n%s", formatEntries(entries), formatEntries(test.expected))
+			}
+		})
+	}
+}
+
+func TestSNMPTimeout(t *testing.T) {
+	standIn := newSNMPStandIn(t, map[string][]gosnmp.SnmpPDU{"public": {}})
+	client := newTestClient(t)
+	defer client.Close()
+	client.SNMPPort = standIn.port()
+	client.SNMPTimeout = 50 * time.Millisecond
+	target := Target{
+		Address:     "127.0.0.1",
+		Credentials: Credentials{SNMP: &SNMPCredentials{Community: "unknown"}},
+		Transport:   TransportSNMP,
+	}
+	_, err := client.SNMPMacTableContext(context.Background(), target)
+	if !errors.Is(err, ErrConnectTimeout) {
+		t.Errorf("expected ErrConnectTimeout, got %v", err)
+	}
+	if isAuthFailure(err) {
+		t.Errorf("timeout reported as an authentication failure: %v", err)
+	}
+}
+
+func TestSNMPDetect(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		system   []gosnmp.SnmpPDU
+		objectID string
+		detected string
+		matched  string
+	}{
+		// The sysObjectID alone identifies the vendor
+		{"Huawei by sysObjectID", []gosnmp.SnmpPDU{
+			snmpString(oidSysDescr, "Linux sw1 3.10.0"),
+			snmpOID(oidSysObjectID, "1.3.6.1.4.1.2011.2.23.96"),
+		}, "1.3.6.1.4.1.2011.2.23.96", "Huawei VRP", "strong sysobjectid: ^1\\.3\\.6\\.1\\.4\\.1\\.2011\\."},
+		{"Aruba CX by sysObjectID", []gosnmp.SnmpPDU{
+			snmpString(oidSysDescr, "Linux sw2 4.9.0"),
+			snmpOID(oidSysObjectID, "1.3.6.1.4.1.47196.4.1.1.1.6"),
+		}, "1.3.6.1.4.1.47196.4.1.1.1.6", "Aruba CX", "strong sysobjectid: ^1\\.3\\.6\\.1\\.4\\.1\\.47196\\.4\\."},
+		{"Cisco IOS by sysDescr and sysObjectID", []gosnmp.SnmpPDU{
+			snmpString(oidSysDescr, "Cisco IOS Software, C2960X Software (C2960X-UNIVERSALK9-M), Version 15.2(7)E3, RELEASE SOFTWARE (fc3)"),
+			snmpOID(oidSysObjectID, "1.3.6.1.4.1.9.1.1208"),
+		}, "1.3.6.1.4.1.9.1.1208", "Cisco IOS", "weak sysobjectid: ^1\\.3\\.6\\.1\\.4\\.1\\.9\\.1\\."},
+		// Agents without sysObjectID answer noSuchObject
+		{"no sysObjectID", []gosnmp.SnmpPDU{
+			snmpString(oidSysDescr, "Linux sw3 4.9.0"),
+		}, "", "", ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			standIn := newSNMPStandIn(t, map[string][]gosnmp.SnmpPDU{"public": test.system})
+			client := newTestClient(t)
+			defer client.Close()
+			if err := client.LoadOSData("../devices.json"); err != nil {
+				t.Fatal(err)
+			}
+			client.SNMPPort = standIn.port()
+			client.SNMPTimeout = 100 * time.Millisecond
+			target := Target{
+				Address:     "127.0.0.1",
+				Credentials: Credentials{SNMP: &SNMPCredentials{Community: "public"}},
+				Transport:   TransportSNMP,
+			}
+			_, objectID, err := client.SNMPSystemContext(context.Background(), target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if objectID != test.objectID {
+				t.Errorf("sysObjectID %q, expected %q", objectID, test.objectID)
+			}
+			candidates, err := client.SNMPDetectContext(context.Background(), target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			detected := client.detectedOS(candidates)
+			if test.detected == "" {
+				if detected != nil {
+					t.Errorf("detected %s (%s)", detected.Name, FormatCandidates(candidates))
+				}
+				return
+			}
+			if detected == nil || detected.Name != test.detected {
+				t.Fatalf("expected %s, candidates: %s", test.detected, FormatCandidates(candidates))
+			}
+			found := false
+			for _, matched := range detected.Matched {
+				found = found || matched == test.matched
+			}
+			if !found {
+				t.Errorf("sysObjectID signature not matched: %q", detected.Matched)
+			}
+		})
+	}
+}
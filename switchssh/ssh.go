@@ -0,0 +1,557 @@
+package switchssh
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+/**
+ * Output of a single command executed on the device.
+ *
+ * @attr Command   Executed command
+ * @attr Output    Output of the command, without the echoed command and the trailing prompt
+ * @attr StartTime Time the command was written to the device
+ * @attr EndTime   Time the prompt reappeared (or the deadline passed)
+ * @attr Failed    The device rejected the command (see CommandErrorPatterns and Driver.ErrorPatterns)
+ */
+type CommandResult struct {
+	Command   string    `json:"command"`
+	Output    string    `json:"output"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Failed    bool      `json:"failed"`
+}
+
+// Output lines by which devices report a rejected command.
+var CommandErrorPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?m)^\s*% ?Invalid input detected`),
+	regexp.MustCompile(`(?m)^\s*% ?(Incomplete|Ambiguous|Unknown|Invalid) command`),
+	regexp.MustCompile(`(?m)^\s*Error:`),
+	regexp.MustCompile(`(?m)Unrecognized command`),
+	regexp.MustCompile(`(?m)^\s*Invalid (input|command)`),
+	regexp.MustCompile(`(?m)^\s*Command fail`),
+}
+
+// DEPRECATED: brand names of earlier versions, mapped to the driver of the matching OS of devices.json.
+const (
+	HUAWEI          = "huawei"
+	H3C             = "h3c"
+	CISCO_SM        = "Version: 2.5" // cisco small business like SG350-28MP
+	CISCO_SM1       = "SW version"   // cisco small business like SG500-52
+	CISCO_SM2       = "Version: 3.3" // cisco small business like CBS350-48P-4G
+	CISCO           = "Cisco IOS"
+	CISCO_IOS_XE    = "Cisco IOS XE"
+	CISCO_IOS_XR    = "Cisco IOS XR"
+	CISCO_NX        = "NX-OS"
+	CISCO_AIROS     = "Cisco Wireless Controller"
+	CISCO_XE_SD     = "Cisco IOS XE SD-WAN"
+	CISCO_STAR_OS   = "StarOS"
+	CISCO_NX_ACI    = "ACI Software"
+	CISCO_CATOS     = "Cisco Catalyst"
+	CISCO_FXOS      = "FXOS"
+	CISCO_ASAOS     = "Cisco Adaptive Security Appliance Software"
+	CISCO_UCS       = "Cisco UCS Manager"
+	ARUBA           = "ArubaOS ("
+	ARUBA_INSTANT   = "InstantOS"
+	ARUBA_CX        = "ArubaOS-CX"
+	ARUBA_AOS_MC    = "Aruba Mobility Controller"
+	ARUBA_AIRWAVE   = "AirWave"
+	ARUBA_AOS_W     = "ArubaOS for Wireless"
+	ARUBA_CLEARPASS = "ClearPass"
+)
+
+/**
+ * Unified method for external calls, which completes the process of obtaining a session
+ * (if it does not exist, a connection and session will be created and stored in the cache),
+ * executing commands, and returning execution results.
+ *
+ * @param user     SSH connection username
+ * @param password Password
+ * @param ipPort   Switch IP and port
+ * @param cmds     Commands to execute (can be multiple)
+ * @return         Execution output and execution errors
+ * @author shenbowei
+ */
+func (this *Client) RunCommands(user, password, ipPort string, pager string, cmds ...string) (string, error) {
+	return this.RunCommandsWithTarget(Target{Address: ipPort, Credentials: Credentials{User: user, Password: password}}, pager, cmds...)
+}
+
+/**
+ * Same as RunCommands, but connects to the given target.
+ *
+ * @param target   Switch address, credentials and jump hosts
+ * @param pager    Command disabling pagination (can be empty)
+ * @param cmds     Commands to execute (can be multiple)
+ * @return         Execution output and execution errors
+ */
+func (this *Client) RunCommandsWithTarget(target Target, pager string, cmds ...string) (string, error) {
+	return this.RunCommandsContext(context.Background(), target, pager, cmds...)
+}
+
+/**
+ * Same as RunCommandsWithTarget, but returns as soon as the context is cancelled.
+ * A session interrupted by the cancellation is closed.
+ *
+ * @param ctx      Context of the commands
+ * @param target   Switch address, credentials and jump hosts
+ * @param pager    Command disabling pagination (can be empty)
+ * @param cmds     Commands to execute (can be multiple)
+ * @return         Execution output and execution errors (the context error when cancelled)
+ */
+func (this *Client) RunCommandsContext(ctx context.Context, target Target, pager string, cmds ...string) (string, error) {
+	sessionKey := target.key()
+	this.sessions.LockSession(sessionKey)
+	defer this.sessions.UnlockSession(sessionKey)
+	defer this.sessions.discardUnhealthy(sessionKey)
+
+	sshSession, err := this.sessions.GetSessionContext(ctx, target, "")
+	if err != nil {
+		this.LogError("GetSession error:%s", err)
+		return "", err
+	}
+	if err := this.disablePager(ctx, sshSession, pager); err != nil {
+		return "", err
+	}
+	result, err := this.runUntilPrompt(ctx, sshSession, cmds...)
+	return this.filterResult(result, cmds[0]), err
+}
+
+/**
+ * Same as RunCommandsWithTarget, but returns the output of every command separately.
+ *
+ * @param target   Switch address, credentials and jump hosts
+ * @param pager    Command disabling pagination (can be empty)
+ * @param cmds     Commands to execute (can be multiple)
+ * @return         One result per executed command and execution errors
+ */
+func (this *Client) RunCommandsWithResults(target Target, pager string, cmds ...string) ([]CommandResult, error) {
+	return this.RunCommandsWithResultsContext(context.Background(), target, pager, cmds...)
+}
+
+/**
+ * Same as RunCommandsWithResults, but returns as soon as the context is cancelled.
+ * A session interrupted by the cancellation is closed.
+ *
+ * @param ctx      Context of the commands
+ * @param target   Switch address, credentials and jump hosts
+ * @param pager    Command disabling pagination (can be empty)
+ * @param cmds     Commands to execute (can be multiple)
+ * @return         One result per executed command and execution errors (the context error when cancelled)
+ */
+func (this *Client) RunCommandsWithResultsContext(ctx context.Context, target Target, pager string, cmds ...string) ([]CommandResult, error) {
+	sessionKey := target.key()
+	this.sessions.LockSession(sessionKey)
+	defer this.sessions.UnlockSession(sessionKey)
+	defer this.sessions.discardUnhealthy(sessionKey)
+
+	sshSession, err := this.sessions.GetSessionContext(ctx, target, "")
+	if err != nil {
+		this.LogError("GetSession error:%s", err)
+		return nil, err
+	}
+	if err := this.disablePager(ctx, sshSession, pager); err != nil {
+		return nil, err
+	}
+	results := make([]CommandResult, 0, len(cmds))
+	for _, cmd := range cmds {
+		result, err := sshSession.ExecCommandContext(ctx, cmd, this.CommandTimeout)
+		results = append(results, result)
+		if err != nil {
+			this.LogError("Command '%s' error:%s", cmd, err)
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+/**
+ * Runs the named getter (see GetterNames) of the OS of the device.
+ *
+ * @param target   Switch address, credentials and jump hosts
+ * @param getter   Getter name, for example GetterMacTable
+ * @return         Output of the getter command and execution errors
+ */
+func (this *Client) Get(target Target, getter string) (string, error) {
+	return this.GetContext(context.Background(), target, getter)
+}
+
+/**
+ * Same as Get, but returns as soon as the context is cancelled.
+ *
+ * @param ctx      Context of the command
+ * @param target   Switch address, credentials and jump hosts
+ * @param getter   Getter name, for example GetterMacTable
+ * @return         Output of the getter command (without the echoed command and the prompt),
+ *                 ErrNotSupported if the OS has no such getter, ErrCommandRejected, execution errors
+ */
+func (this *Client) GetContext(ctx context.Context, target Target, getter string) (string, error) {
+	sessionKey := target.key()
+	this.sessions.LockSession(sessionKey)
+	defer this.sessions.UnlockSession(sessionKey)
+	defer this.sessions.discardUnhealthy(sessionKey)
+
+	sshSession, err := this.sessions.GetSessionContext(ctx, target, "")
+	if err != nil {
+		this.LogError("GetSession error:%s", err)
+		return "", err
+	}
+	cmd := ""
+	if sshSession.driver != nil {
+		cmd = sshSession.driver.Getter(getter)
+	}
+	if cmd == "" {
+		return "", fmt.Errorf("getter %s of %q: %w", getter, sshSession.brand, ErrNotSupported)
+	}
+	result, err := sshSession.ExecCommandContext(ctx, cmd, this.CommandTimeout)
+	if err == nil {
+		err = result.Err()
+	}
+	return result.Output, err
+}
+
+/**
+ * Enters configuration mode with the driver of the device, executes the commands and leaves configuration mode.
+ *
+ * @param target   Switch address, credentials and jump hosts
+ * @param cmds     Configuration commands
+ * @return         One result per executed command and execution errors
+ */
+func (this *Client) Configure(target Target, cmds ...string) ([]CommandResult, error) {
+	return this.ConfigureContext(context.Background(), target, cmds...)
+}
+
+/**
+ * Same as Configure, but returns as soon as the context is cancelled.
+ * Execution stops at the first command the device rejects (ErrCommandRejected).
+ *
+ * @param ctx      Context of the commands
+ * @param target   Switch address, credentials and jump hosts
+ * @param cmds     Configuration commands
+ * @return         One result per executed command, ErrNotSupported without a driver with configuration mode, execution errors
+ */
+func (this *Client) ConfigureContext(ctx context.Context, target Target, cmds ...string) ([]CommandResult, error) {
+	sessionKey := target.key()
+	this.sessions.LockSession(sessionKey)
+	defer this.sessions.UnlockSession(sessionKey)
+	defer this.sessions.discardUnhealthy(sessionKey)
+
+	sshSession, err := this.sessions.GetSessionContext(ctx, target, "")
+	if err != nil {
+		this.LogError("GetSession error:%s", err)
+		return nil, err
+	}
+	if sshSession.driver == nil {
+		return nil, fmt.Errorf("configuration mode of %q: %w", sshSession.brand, ErrNotSupported)
+	}
+	if err := sshSession.driver.EnterConfig(ctx, sshSession); err != nil {
+		return nil, err
+	}
+	results := make([]CommandResult, 0, len(cmds))
+	for _, cmd := range cmds {
+		var result CommandResult
+		result, err = sshSession.ExecCommandContext(ctx, cmd, this.CommandTimeout)
+		results = append(results, result)
+		if err == nil {
+			err = result.Err()
+		}
+		if err != nil {
+			this.LogError("Command '%s' error:%s", cmd, err)
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		return results, err
+	}
+	if exitErr := sshSession.driver.ExitConfig(ctx, sshSession); exitErr != nil && err == nil {
+		err = exitErr
+	}
+	return results, err
+}
+
+/**
+ * Saves the running configuration with the driver of the device.
+ *
+ * @param target   Switch address, credentials and jump hosts
+ * @return         ErrNotSupported without a driver able to save, execution errors
+ */
+func (this *Client) SaveConfig(target Target) error {
+	return this.SaveConfigContext(context.Background(), target)
+}
+
+/**
+ * Same as SaveConfig, but returns as soon as the context is cancelled.
+ */
+func (this *Client) SaveConfigContext(ctx context.Context, target Target) error {
+	sessionKey := target.key()
+	this.sessions.LockSession(sessionKey)
+	defer this.sessions.UnlockSession(sessionKey)
+	defer this.sessions.discardUnhealthy(sessionKey)
+
+	sshSession, err := this.sessions.GetSessionContext(ctx, target, "")
+	if err != nil {
+		this.LogError("GetSession error:%s", err)
+		return err
+	}
+	if sshSession.driver == nil {
+		return fmt.Errorf("saving the configuration of %q: %w", sshSession.brand, ErrNotSupported)
+	}
+	return sshSession.driver.SaveConfig(ctx, sshSession)
+}
+
+/**
+ * Unified method for external calls, which completes the process of obtaining a session
+ * (if it does not exist, a connection and session will be created and stored in the cache),
+ * executing commands, and returning execution results.
+ *
+ * @param user     SSH connection username
+ * @param password Password
+ * @param ipPort   Switch IP and port
+ * @param brand    Switch brand (can be empty)
+ * @param cmds     Commands to execute (can be multiple)
+ * @return         Execution output and execution errors
+ * @author shenbowei
+ */
+func (this *Client) RunCommandsWithBrand(user, password, ipPort, brand string, cmds ...string) (string, error) {
+	sessionKey := Target{Address: ipPort, Credentials: Credentials{User: user, Password: password}}.key()
+	this.sessions.LockSession(sessionKey)
+	defer this.sessions.UnlockSession(sessionKey)
+	defer this.sessions.discardUnhealthy(sessionKey)
+
+	sshSession, err := this.sessions.GetSession(user, password, ipPort, brand)
+	if err != nil {
+		this.LogError("GetSession error:%s", err)
+		return "", err
+	}
+	result, err := this.runUntilPrompt(context.Background(), sshSession, cmds...)
+	return this.filterResult(result, cmds[0]), err
+}
+
+/**
+ * Sends the command disabling pagination and waits for the prompt.
+ *
+ * @param ctx        Context of the command
+ * @param sshSession Opened session
+ * @param pager      Command disabling pagination (empty does nothing)
+ * @return           Execution errors
+ */
+func (this *Client) disablePager(ctx context.Context, sshSession *SSHSession, pager string) error {
+	if pager == "" {
+		return nil
+	}
+	if err := sshSession.WriteChannelContext(ctx, pager); err != nil {
+		return err
+	}
+	if _, err := sshSession.ReadChannelPromptContext(ctx, this.CommandTimeout); err != nil {
+		this.LogError("Disable pager error:%s", err)
+		return err
+	}
+	return nil
+}
+
+/**
+ * Executes the commands one by one, each returning as soon as the prompt reappears.
+ *
+ * @param ctx        Context of the commands
+ * @param sshSession Opened session
+ * @param cmds       Commands to execute (can be multiple)
+ * @return           Concatenated output and ErrOutputTruncated if a command did not finish within the command timeout
+ */
+func (this *Client) runUntilPrompt(ctx context.Context, sshSession *SSHSession, cmds ...string) (string, error) {
+	result := ""
+	for _, cmd := range cmds {
+		if err := sshSession.WriteChannelContext(ctx, cmd); err != nil {
+			return result, err
+		}
+		output, err := sshSession.ReadChannelPromptContext(ctx, this.CommandTimeout)
+		result += output
+		if err != nil {
+			this.LogError("Command '%s' error:%s", cmd, err)
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+/**
+ * Unified method for external calls to obtain the switch model.
+ *
+ * @param user     SSH connection username
+ * @param password Password
+ * @param ipPort   Switch IP and port
+ * @return         Device brand (huawei, h3c, cisco, "") and execution errors
+ * @author shenbowei
+ */
+func (this *Client) GetSSHBrand(user, password, ipPort string) (string, error) {
+	return this.GetSSHBrandWithTarget(Target{Address: ipPort, Credentials: Credentials{User: user, Password: password}})
+}
+
+/**
+ * Same as GetSSHBrand, but connects to the given target.
+ *
+ * @param target   Switch address, credentials and jump hosts
+ * @return         Device OS name from devices.json ("" if unknown) and execution errors
+ */
+func (this *Client) GetSSHBrandWithTarget(target Target) (string, error) {
+	return this.GetSSHBrandContext(context.Background(), target)
+}
+
+/**
+ * Same as GetSSHBrandWithTarget, but connecting and detecting are aborted when the context is cancelled.
+ * Targets of the snmp transport are detected over SNMP (see SNMPDetectContext).
+ *
+ * @param ctx      Context of the detection
+ * @param target   Switch address, credentials and jump hosts
+ * @return         Device OS name from devices.json ("" if unknown) and execution errors (the context error when cancelled)
+ */
+func (this *Client) GetSSHBrandContext(ctx context.Context, target Target) (string, error) {
+	if target.Transport == TransportSNMP {
+		return this.snmpBrandContext(ctx, target)
+	}
+	sessionKey := target.key()
+	this.sessions.LockSession(sessionKey)
+	defer this.sessions.UnlockSession(sessionKey)
+	defer this.sessions.discardUnhealthy(sessionKey)
+
+	sshSession, err := this.sessions.GetSessionContext(ctx, target, "")
+	if err != nil {
+		this.LogError("GetSession error:%s", err)
+		return "", err
+	}
+	return sshSession.GetSSHBrandContext(ctx)
+}
+
+/**
+ * Detects the OS of the target and returns all candidates with their confidence.
+ * Unlike GetSSHBrandContext the device is probed even if its OS is known in advance,
+ * the candidates of an earlier detection on the cached session are reused.
+ * Targets of the snmp transport are detected over SNMP (see SNMPDetectContext).
+ *
+ * @param ctx      Context of the detection
+ * @param target   Switch address, credentials and jump hosts
+ * @return         OS candidates, best first (see DetectOS), and execution errors
+ */
+func (this *Client) DetectContext(ctx context.Context, target Target) ([]Candidate, error) {
+	if target.Transport == TransportSNMP {
+		return this.SNMPDetectContext(ctx, target)
+	}
+	sessionKey := target.key()
+	this.sessions.LockSession(sessionKey)
+	defer this.sessions.UnlockSession(sessionKey)
+	defer this.sessions.discardUnhealthy(sessionKey)
+
+	sshSession, err := this.sessions.GetSessionContext(ctx, target, "")
+	if err != nil {
+		this.LogError("GetSession error:%s", err)
+		return nil, err
+	}
+	if candidates := sshSession.Candidates(); candidates != nil {
+		return candidates, nil
+	}
+	return sshSession.DetectContext(ctx)
+}
+
+/**
+ * Returns what the device shows before the login, which often names the vendor.
+ *
+ * @param ctx      Context of the connection
+ * @param target   Switch address, credentials and jump hosts
+ * @return         SSH server version string (empty for telnet), banner shown before the login and execution errors
+ */
+func (this *Client) ServerInfoContext(ctx context.Context, target Target) (string, string, error) {
+	sessionKey := target.key()
+	this.sessions.LockSession(sessionKey)
+	defer this.sessions.UnlockSession(sessionKey)
+	defer this.sessions.discardUnhealthy(sessionKey)
+
+	sshSession, err := this.sessions.GetSessionContext(ctx, target, "")
+	if err != nil {
+		this.LogError("GetSession error:%s", err)
+		return "", "", err
+	}
+	return sshSession.ServerVersion(), sshSession.Banner(), nil
+}
+
+/**
+ * Filters the execution results of the switch.
+ *
+ * @param result   Returned execution result (may contain unwanted data)
+ * @param firstCmd The first executed command
+ * @return         Filtered execution result
+ * @author shenbowei
+ */
+func (this *Client) filterResult(result, firstCmd string) string {
+	// Process the result and extract the part after the command
+	filteredResult := ""
+	resultArray := strings.Split(result, "\n")
+	findCmd := false
+	promptStr := ""
+	for _, resultItem := range resultArray {
+		resultItem = strings.Replace(resultItem, " \b", "", -1)
+		if findCmd && (promptStr == "" || strings.Replace(resultItem, promptStr, "", -1) != "") {
+			filteredResult += resultItem + "\n"
+			continue
+		}
+		if strings.Contains(resultItem, firstCmd) {
+			findCmd = true
+			promptStr = resultItem[0:strings.Index(resultItem, firstCmd)]
+			promptStr = strings.Replace(promptStr, "\r", "", -1)
+			promptStr = strings.TrimSpace(promptStr)
+			this.LogDebug("Find promptStr='%s'", promptStr)
+			// Add the command to the result
+			filteredResult += resultItem + "\n"
+		}
+	}
+	if !findCmd {
+		return result
+	}
+	return filteredResult
+}
+
+/**
+ * Removes the echoed command and the trailing prompt from the output of a single command.
+ *
+ * @param output Raw output read until the prompt
+ * @param cmd    The executed command
+ * @return       Output of the command only
+ */
+func cleanCommandOutput(output, cmd string) string {
+	output = ansiEscapeRegexp.ReplaceAllString(output, "")
+	output = strings.Replace(output, " \b", "", -1)
+	output = strings.Replace(output, "\r", "", -1)
+	lines := strings.Split(output, "\n")
+	// The echo is the first line containing the command
+	for i, line := range lines {
+		if cmd != "" && strings.Contains(line, cmd) {
+			lines = lines[i+1:]
+			break
+		}
+	}
+	// The last line is the prompt that ended the read
+	if len(lines) > 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+/**
+ * Checks the output for messages by which devices report a rejected command,
+ * using the error patterns of the session driver or CommandErrorPatterns.
+ *
+ * @param output Output of a single command
+ * @return       true if the device reported an error
+ */
+func (this *SSHSession) isCommandError(output string) bool {
+	patterns := CommandErrorPatterns
+	if this.driver != nil && this.driver.ErrorPatterns() != nil {
+		patterns = this.driver.ErrorPatterns()
+	}
+	for _, pattern := range patterns {
+		if pattern.MatchString(output) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package switchssh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+/**
+ * Credentials used to authenticate to a device.
+ * Methods are offered in the order: private key, ssh-agent, password, keyboard-interactive.
+ *
+ * @attr User                SSH connection username
+ * @attr Password            Password, also used to answer keyboard-interactive password prompts
+ * @attr KeyFile             Path to a private key file (can be empty)
+ * @attr KeyPassphrase       Passphrase of the private key (can be empty)
+ * @attr UseAgent            Offer the keys of the ssh-agent listening on SSH_AUTH_SOCK
+ * @attr KeyboardInteractive Offer keyboard-interactive authentication
+ * @attr EnableSecret        Secret for entering privileged mode (enable, super), can be empty
+ * @attr SNMP                SNMP credentials, for the snmp transport (can be nil)
+ * @attr Profile             Name of the credential profile the credentials come from (informational, can be empty)
+ */
+type Credentials struct {
+	User                string           `yaml:"user" json:"user"`
+	Password            string           `yaml:"password" json:"password,omitempty"`
+	KeyFile             string           `yaml:"key" json:"key,omitempty"`
+	KeyPassphrase       string           `yaml:"key-pass" json:"key-pass,omitempty"`
+	UseAgent            bool             `yaml:"agent" json:"agent,omitempty"`
+	KeyboardInteractive bool             `yaml:"kbd-interactive" json:"kbd-interactive,omitempty"`
+	EnableSecret        string           `yaml:"enable-secret" json:"enable-secret,omitempty"`
+	SNMP                *SNMPCredentials `yaml:"snmp" json:"snmp,omitempty"`
+	Profile             string           `yaml:"-" json:"-"`
+}
+
+/**
+ * Returns the part of the session cache key identifying the credentials.
+ * Secrets are hashed, so they do not appear in keys and logs.
+ */
+func (this Credentials) key() string {
+	secrets := sha256.Sum256([]byte(this.Password + "\x00" + this.KeyPassphrase + "\x00" + this.EnableSecret))
+	return fmt.Sprintf("%s_%s_%s_%t_%t", this.User, hex.EncodeToString(secrets[:8]), this.KeyFile, this.UseAgent, this.KeyboardInteractive)
+}
+
+/**
+ * Describes the credentials for logs, without secrets.
+ */
+func (this Credentials) describe() string {
+	if this.Profile != "" {
+		return fmt.Sprintf("%s (profile %s)", this.User, this.Profile)
+	}
+	return this.User
+}
+
+/**
+ * Checks whether the error means the device refused the credentials, as opposed to a connection problem.
+ */
+func isAuthFailure(err error) bool {
+	return errors.Is(err, ErrTelnetLogin) || errors.Is(err, ErrAuthFailed)
+}
+
+/**
+ * SSH handshake error of a server that refused the credentials, matching ErrAuthFailed
+ * while keeping the message of the handshake error.
+ *
+ * @attr err Handshake error
+ */
+type authRefusedError struct {
+	err error
+}
+
+func (this *authRefusedError) Error() string {
+	return this.err.Error()
+}
+
+func (this *authRefusedError) Unwrap() error {
+	return this.err
+}
+
+func (this *authRefusedError) Is(target error) bool {
+	return target == ErrAuthFailed
+}
+
+/**
+ * Builds the list of SSH authentication methods for the credentials.
+ *
+ * @return Authentication methods, the agent connection to close after login (can be nil) and errors
+ */
+func (this Credentials) authMethods() ([]ssh.AuthMethod, net.Conn, error) {
+	methods := make([]ssh.AuthMethod, 0)
+	if this.KeyFile != "" {
+		signer, err := loadPrivateKey(this.KeyFile, this.KeyPassphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	var agentConn net.Conn
+	if this.UseAgent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, nil, fmt.Errorf("ssh-agent requested but SSH_AUTH_SOCK is not set")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to connect to ssh-agent: %s", err)
+		}
+		agentConn = conn
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if this.Password != "" {
+		methods = append(methods, ssh.Password(this.Password))
+	}
+	if this.KeyboardInteractive {
+		methods = append(methods, ssh.KeyboardInteractive(this.answerChallenge))
+	}
+	if len(methods) == 0 {
+		return nil, agentConn, fmt.Errorf("no authentication method configured for user %s", this.User)
+	}
+	return methods, agentConn, nil
+}
+
+/**
+ * Answers keyboard-interactive questions, password prompts get the password, all others an empty answer.
+ */
+func (this Credentials) answerChallenge(name, instruction string, questions []string, echos []bool) ([]string, error) {
+	answers := make([]string, len(questions))
+	for i, question := range questions {
+		if strings.Contains(strings.ToLower(question), "password") {
+			answers[i] = this.Password
+		}
+	}
+	return answers, nil
+}
+
+/**
+ * Reads and parses a private key file, decrypting it with the passphrase when given.
+ *
+ * @param path       Private key file
+ * @param passphrase Passphrase (can be empty)
+ * @return           Signer and errors
+ */
+func loadPrivateKey(path, passphrase string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read private key: %s", err)
+	}
+	var signer ssh.Signer
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key %s: %s", path, err)
+	}
+	return signer, nil
+}
@@ -0,0 +1,105 @@
+package switchssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// starts an SSH server accepting the password and closing the connection after the handshake
+func newSSHStandIn(t *testing.T, password string) string {
+	return newSSHServerStandIn(t, password, nil)
+}
+
+// starts an SSH server accepting the password, serve handles the channels of each connection (nil closes it)
+func newSSHServerStandIn(t *testing.T, password string, serve func(channels <-chan ssh.NewChannel)) string {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, given []byte) (*ssh.Permissions, error) {
+			if string(given) == password {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+	}
+	config.AddHostKey(signer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serverConn, channels, requests, err := ssh.NewServerConn(conn, config)
+				if err != nil || serve == nil {
+					return
+				}
+				defer serverConn.Close()
+				go ssh.DiscardRequests(requests)
+				serve(channels)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestDialSSHAuthFailure(t *testing.T) {
+	address := newSSHStandIn(t, "secret")
+	client := newTestClient(t)
+	defer client.Close()
+	client.HostKeyPolicy = HostKeyInsecure
+	dial := (&net.Dialer{}).DialContext
+
+	_, err := client.dialSSH(context.Background(), dial, address, Credentials{User: "admin", Password: "wrong"}, nil)
+	if !errors.Is(err, ErrAuthFailed) || !isAuthFailure(err) {
+		t.Errorf("refused password not recognized as an authentication failure: %v", err)
+	}
+	sshClient, err := client.dialSSH(context.Background(), dial, address, Credentials{User: "admin", Password: "secret"}, nil)
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	sshClient.Close()
+}
+
+func TestDialSSHHandshakeFailureIsNotAuthFailure(t *testing.T) {
+	// Closes the connections right away, before the key exchange
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	client := newTestClient(t)
+	defer client.Close()
+	client.HostKeyPolicy = HostKeyInsecure
+	_, err = client.dialSSH(context.Background(), (&net.Dialer{}).DialContext, listener.Addr().String(), Credentials{User: "admin", Password: "secret"}, nil)
+	if err == nil || isAuthFailure(err) {
+		t.Errorf("closed connection reported as an authentication failure: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package switchssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key policies
+const (
+	// Only hosts whose key is already in the known_hosts file are accepted.
+	HostKeyStrict = "strict"
+	// Keys of unknown hosts are recorded on first connection, changed keys are refused afterwards.
+	HostKeyTOFU = "tofu"
+	// Every host key is accepted without verification.
+	HostKeyInsecure = "insecure"
+)
+
+/**
+ * Returned when the device presents a key different from the one recorded in the known_hosts file.
+ *
+ * @attr Host        Address of the device
+ * @attr Fingerprint SHA256 fingerprint of the presented key
+ * @attr Known       Locations (file:line) of the recorded keys
+ */
+type HostKeyChangedError struct {
+	Host        string
+	Fingerprint string
+	Known       []string
+}
+
+func (this *HostKeyChangedError) Error() string {
+	return fmt.Sprintf("host key for %s has changed (presented %s, recorded at %v), possible man-in-the-middle attack",
+		this.Host, this.Fingerprint, this.Known)
+}
+
+/**
+ * Returned by the strict policy when the device is not in the known_hosts file.
+ *
+ * @attr Host        Address of the device
+ * @attr Fingerprint SHA256 fingerprint of the presented key
+ * @attr File        known_hosts file the key was looked up in
+ */
+type HostKeyUnknownError struct {
+	Host        string
+	Fingerprint string
+	File        string
+}
+
+func (this *HostKeyUnknownError) Error() string {
+	return fmt.Sprintf("host key for %s (%s) is not in %s", this.Host, this.Fingerprint, this.File)
+}
+
+/**
+ * Verifies host keys against the known_hosts file, recording new keys when the policy is tofu.
+ *
+ * @attr locker   Serializes reading and appending to the known_hosts file
+ * @attr callback Callback built from the current content of the known_hosts file
+ * @attr client   Client holding the policy and the known_hosts file
+ */
+type hostKeyVerifier struct {
+	client   *Client
+	locker   sync.Mutex
+	callback ssh.HostKeyCallback
+}
+
+/**
+ * Returns the host key callback and the accepted host key algorithms for the current policy.
+ *
+ * @param ipPort Switch IP and port
+ * @return       Host key callback, host key algorithms (nil means the default list) and errors
+ */
+func (this *hostKeyVerifier) clientOptions(ipPort string) (ssh.HostKeyCallback, []string, error) {
+	switch this.client.HostKeyPolicy {
+	case HostKeyInsecure:
+		return ssh.InsecureIgnoreHostKey(), nil, nil
+	case HostKeyStrict, HostKeyTOFU:
+	default:
+		return nil, nil, fmt.Errorf("unknown host key policy %q", this.client.HostKeyPolicy)
+	}
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	if err := this.load(); err != nil {
+		return nil, nil, err
+	}
+	return this.verify, this.knownAlgorithms(ipPort), nil
+}
+
+/**
+ * Loads the known_hosts file, the tofu policy creates it when it does not exist.
+ * Must be called with the locker held.
+ */
+func (this *hostKeyVerifier) load() error {
+	if this.callback != nil {
+		return nil
+	}
+	if _, err := os.Stat(this.client.KnownHostsFile); os.IsNotExist(err) && this.client.HostKeyPolicy == HostKeyTOFU {
+		if err := appendFile(this.client.KnownHostsFile, ""); err != nil {
+			return err
+		}
+	}
+	callback, err := knownhosts.New(this.client.KnownHostsFile)
+	if err != nil {
+		return fmt.Errorf("unable to load known hosts: %s", err)
+	}
+	this.callback = callback
+	return nil
+}
+
+/**
+ * Host key callback applying the policy.
+ */
+func (this *hostKeyVerifier) verify(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	err := this.callback(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+	if len(keyErr.Want) > 0 {
+		known := make([]string, 0, len(keyErr.Want))
+		for _, want := range keyErr.Want {
+			known = append(known, fmt.Sprintf("%s:%d", want.Filename, want.Line))
+		}
+		this.client.LogError("Host key of %s has changed, refusing to connect", hostname)
+		return &HostKeyChangedError{Host: hostname, Fingerprint: fingerprint, Known: known}
+	}
+	if this.client.HostKeyPolicy != HostKeyTOFU {
+		return &HostKeyUnknownError{Host: hostname, Fingerprint: fingerprint, File: this.client.KnownHostsFile}
+	}
+	this.client.LogDebug("Recording new host key of %s: %s", hostname, fingerprint)
+	if err := appendFile(this.client.KnownHostsFile, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)+"\n"); err != nil {
+		return fmt.Errorf("unable to record host key: %s", err)
+	}
+	// Reload, so following connections to the same host verify against the recorded key
+	this.callback = nil
+	return this.load()
+}
+
+/**
+ * Returns the host key algorithms of the keys recorded for the host, so the device is asked for a key
+ * type that can be verified instead of one that would look like a changed key.
+ * Must be called with the locker held.
+ *
+ * @param ipPort Switch IP and port
+ * @return       Algorithms, nil if the host is unknown
+ */
+func (this *hostKeyVerifier) knownAlgorithms(ipPort string) []string {
+	// Checking a key that is never recorded returns the recorded keys in the error
+	err := this.callback(ipPort, &net.TCPAddr{IP: net.IPv4zero}, unknownHostKey{})
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+		return nil
+	}
+	algorithms := make([]string, 0)
+	for _, want := range keyErr.Want {
+		switch want.Key.Type() {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, want.Key.Type())
+		}
+	}
+	return algorithms
+}
+
+/**
+ * Public key that never matches a recorded key.
+ */
+type unknownHostKey struct{}
+
+func (unknownHostKey) Type() string                                 { return "unknown" }
+func (unknownHostKey) Marshal() []byte                              { return []byte{} }
+func (unknownHostKey) Verify(data []byte, sig *ssh.Signature) error { return errors.New("unknown key") }
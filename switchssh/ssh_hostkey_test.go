@@ -0,0 +1,125 @@
+package switchssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// verifies the key of the host as a connection to it would
+func verifyTestHostKey(client *Client, ipPort string, key ssh.PublicKey) error {
+	callback, _, err := client.hostKeys.clientOptions(ipPort)
+	if err != nil {
+		return err
+	}
+	addr, _ := net.ResolveTCPAddr("tcp", ipPort)
+	return callback(ipPort, addr, key)
+}
+
+func TestHostKeyTOFU(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+	client.HostKeyPolicy = HostKeyTOFU
+	key, otherKey := newHostKey(t), newHostKey(t)
+
+	// First use records the key, creating the file
+	if err := verifyTestHostKey(client, "10.0.0.1:22", key); err != nil {
+		t.Fatalf("first use refused: %s", err)
+	}
+	data, err := os.ReadFile(client.KnownHostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 || !strings.HasPrefix(lines[0], "10.0.0.1 ssh-ed25519 ") {
+		t.Errorf("known_hosts after first use: %q", data)
+	}
+
+	if err := verifyTestHostKey(client, "10.0.0.1:22", key); err != nil {
+		t.Errorf("known key refused: %s", err)
+	}
+	var changed *HostKeyChangedError
+	if err := verifyTestHostKey(client, "10.0.0.1:22", otherKey); !errors.As(err, &changed) {
+		t.Errorf("changed key: expected a HostKeyChangedError, got %v", err)
+	} else if changed.Fingerprint != ssh.FingerprintSHA256(otherKey) || len(changed.Known) != 1 {
+		t.Errorf("changed key error %+v", changed)
+	}
+	// Another port of the same address is another host
+	if err := verifyTestHostKey(client, "10.0.0.1:2222", otherKey); err != nil {
+		t.Errorf("first use on another port refused: %s", err)
+	}
+
+	// A new client reads the keys recorded before
+	reloaded := newTestClient(t)
+	defer reloaded.Close()
+	reloaded.HostKeyPolicy = HostKeyTOFU
+	reloaded.KnownHostsFile = client.KnownHostsFile
+	if err := verifyTestHostKey(reloaded, "10.0.0.1:22", otherKey); !errors.As(err, &changed) {
+		t.Errorf("changed key after reloading: expected a HostKeyChangedError, got %v", err)
+	}
+	data, _ = os.ReadFile(client.KnownHostsFile)
+	if strings.Count(string(data), "\n") != 2 {
+		t.Errorf("known_hosts after the changed key: %q", data)
+	}
+}
+
+func TestHostKeyStrict(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+	client.HostKeyPolicy = HostKeyStrict
+	key := newHostKey(t)
+	if err := os.WriteFile(client.KnownHostsFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var unknown *HostKeyUnknownError
+	if err := verifyTestHostKey(client, "10.0.0.2:22", key); !errors.As(err, &unknown) {
+		t.Fatalf("unknown host: expected a HostKeyUnknownError, got %v", err)
+	}
+	if data, _ := os.ReadFile(client.KnownHostsFile); len(data) != 0 {
+		t.Errorf("strict policy recorded a key: %q", data)
+	}
+
+	// Keys added to the file by the administrator are accepted
+	line := "10.0.0.2 " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))) + "\n"
+	if err := os.WriteFile(client.KnownHostsFile, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+	strict := newTestClient(t)
+	defer strict.Close()
+	strict.HostKeyPolicy = HostKeyStrict
+	strict.KnownHostsFile = client.KnownHostsFile
+	if err := verifyTestHostKey(strict, "10.0.0.2:22", key); err != nil {
+		t.Errorf("known key refused: %s", err)
+	}
+	if _, algorithms, _ := strict.hostKeys.clientOptions("10.0.0.2:22"); len(algorithms) != 1 || algorithms[0] != ssh.KeyAlgoED25519 {
+		t.Errorf("host key algorithms of the known host %v", algorithms)
+	}
+
+	// Without a known_hosts file nothing can be verified
+	missing := newTestClient(t)
+	defer missing.Close()
+	missing.HostKeyPolicy = HostKeyStrict
+	missing.KnownHostsFile = filepath.Join(t.TempDir(), "missing")
+	if err := verifyTestHostKey(missing, "10.0.0.2:22", key); err == nil {
+		t.Error("strict policy without known_hosts file accepted the key")
+	}
+}
@@ -0,0 +1,212 @@
+package switchssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/**
+ * Jump host (bastion) the connection to the device is tunneled through, like OpenSSH ProxyJump.
+ *
+ * @attr Address     Jump host IP and port
+ * @attr Credentials Credentials for the jump host
+ */
+type JumpHost struct {
+	Address     string
+	Credentials Credentials
+}
+
+/**
+ * Caches the connections to jump hosts, so all devices behind the same chain of jump hosts share them.
+ *
+ * @attr conns  Connections to jump hosts, keyed by the chain leading to them
+ * @attr locker Lock of the map and of the user counts, never held while talking to a jump host
+ * @attr client Client owning the pool, holding the settings
+ */
+type jumpPool struct {
+	conns  map[string]*jumpConn
+	locker sync.Mutex
+	client *Client
+}
+
+/**
+ * Connection to a jump host shared by the sessions tunneled through it.
+ *
+ * @attr client Connection (nil until dialed)
+ * @attr users  Number of sessions using or connecting through the entry, it is removed at 0
+ * @attr locker Held while checking or dialing the connection, so a chain is dialed once
+ *              without blocking the workers behind other chains
+ */
+type jumpConn struct {
+	client *ssh.Client
+	users  int
+	locker sync.Mutex
+}
+
+func newJumpPool(client *Client) *jumpPool {
+	return &jumpPool{
+		client: client,
+		conns:  make(map[string]*jumpConn),
+	}
+}
+
+/**
+ * Returns the key of a chain of jump hosts.
+ */
+func jumpChainKey(hops []JumpHost) string {
+	parts := make([]string, 0, len(hops))
+	for _, hop := range hops {
+		parts = append(parts, hop.Credentials.key()+"@"+hop.Address)
+	}
+	return strings.Join(parts, ">")
+}
+
+/**
+ * Returns a connection to the last jump host of the chain, reusing cached connections of the chain
+ * and dialing the missing or broken ones through the previous hop.
+ * Every successful call must be paired with a call to release.
+ *
+ * @param ctx  Context of the connection, cancelling it aborts dialing the missing hops
+ * @param hops Chain of jump hosts, the first one is dialed directly
+ * @return     Connection to the last jump host and errors
+ */
+func (this *jumpPool) acquire(ctx context.Context, hops []JumpHost) (*ssh.Client, error) {
+	var previous *ssh.Client
+	for i, hop := range hops {
+		key := jumpChainKey(hops[:i+1])
+		this.locker.Lock()
+		conn, ok := this.conns[key]
+		if !ok {
+			conn = &jumpConn{}
+			this.conns[key] = conn
+		}
+		// Counted before connecting, so the entry is not removed while another session dials it
+		conn.users++
+		this.locker.Unlock()
+
+		client, err := this.connect(ctx, conn, previous, hop)
+		if err != nil {
+			this.release(hops[:i+1])
+			return nil, fmt.Errorf("jump host %s: %w", hop.Address, err)
+		}
+		previous = client
+	}
+	return previous, nil
+}
+
+/**
+ * Returns the connection of the entry, dialing it through the previous hop if it is missing or broken.
+ */
+func (this *jumpPool) connect(ctx context.Context, conn *jumpConn, previous *ssh.Client, hop JumpHost) (*ssh.Client, error) {
+	conn.locker.Lock()
+	defer conn.locker.Unlock()
+	if conn.client != nil && !this.isClientAlive(conn.client) {
+		this.client.LogDebug("Jump host %s connection is broken, reconnecting", hop.Address)
+		conn.client.Close()
+		conn.client = nil
+	}
+	if conn.client == nil {
+		dial := (&net.Dialer{Timeout: this.client.DialTimeout}).DialContext
+		if previous != nil {
+			dial = previous.DialContext
+		}
+		client, err := this.client.dialSSH(ctx, dial, hop.Address, hop.Credentials, nil)
+		if err != nil {
+			return nil, err
+		}
+		conn.client = client
+	}
+	return conn.client, nil
+}
+
+/**
+ * Releases the chain acquired with acquire, connections no longer used by any session are closed.
+ *
+ * @param hops Chain of jump hosts
+ */
+func (this *jumpPool) release(hops []JumpHost) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	// Release from the last hop, the connections to it are tunneled through the previous ones
+	for i := len(hops); i > 0; i-- {
+		key := jumpChainKey(hops[:i])
+		conn, ok := this.conns[key]
+		if !ok {
+			continue
+		}
+		conn.users--
+		if conn.users > 0 {
+			continue
+		}
+		if conn.client != nil {
+			this.client.LogDebug("Closing unused jump host connection %s", hops[i-1].Address)
+			conn.client.Close()
+		}
+		delete(this.conns, key)
+	}
+}
+
+/**
+ * Checks that the SSH connection still answers requests within the dial timeout.
+ */
+func (this *jumpPool) isClientAlive(client *ssh.Client) bool {
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		result <- err
+	}()
+	timer := time.NewTimer(this.client.DialTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err == nil
+	case <-timer.C:
+		// Closing the connection by the caller ends the pending request
+		return false
+	}
+}
+
+/**
+ * Parses a comma separated chain of jump hosts "[user[:password]@]host[:port],...".
+ * Missing user, password and port are taken from defaults and port 22.
+ *
+ * @param spec     Chain of jump hosts
+ * @param defaults Credentials used when not given in the spec
+ * @return         Jump hosts in connection order and errors
+ */
+func ParseJumpHosts(spec string, defaults Credentials) ([]JumpHost, error) {
+	hops := make([]JumpHost, 0)
+	if spec == "" {
+		return hops, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		cred := defaults
+		address := part
+		if at := strings.LastIndex(part, "@"); at >= 0 {
+			userInfo := part[:at]
+			address = part[at+1:]
+			user, password, hasPassword := strings.Cut(userInfo, ":")
+			cred.User = user
+			if hasPassword {
+				cred.Password = password
+			}
+		}
+		if address == "" {
+			return nil, fmt.Errorf("invalid jump host %q", part)
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, "22")
+		}
+		if cred.User == "" {
+			return nil, fmt.Errorf("no user for jump host %q", part)
+		}
+		hops = append(hops, JumpHost{Address: address, Credentials: cred})
+	}
+	return hops, nil
+}
@@ -0,0 +1,1055 @@
+package switchssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Generic prompt shape used to find the prompt right after login, before the OS is known.
+const DefaultPromptPattern = `[\w\-\.\(\)/:@~]+\s?[#>\]\$]\s*$`
+
+var (
+	// Returned when the prompt does not reappear before the deadline.
+	ErrPromptTimeout = errors.New("timed out waiting for prompt")
+	// Returned when the output pipeline was closed while waiting for the prompt.
+	ErrChannelClosed = errors.New("session output channel closed")
+)
+
+var (
+	defaultPromptRegexp = regexp.MustCompile(DefaultPromptPattern)
+	morePromptRegexp    = regexp.MustCompile(`(?i)(-+ ?more ?-+|press any key to continue)[^\n]*$`)
+	ansiEscapeRegexp    = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+	promptBaseRegexp    = regexp.MustCompile(`^[<\[\(]?([\w\-\.\/:@~]+)`)
+)
+
+/**
+ * Device to connect to.
+ *
+ * @attr Address     Switch IP and port
+ * @attr Credentials Credentials for the switch
+ * @attr Fallback    Credentials tried in order when the device refuses the previous ones (can be empty)
+ * @attr JumpHosts   Jump hosts the connection is tunneled through, in connection order (can be empty)
+ * @attr Transport   ssh (default when empty), telnet, auto (ssh, falling back to telnet) or snmp (MAC tables only)
+ * @attr OS          Known OS name from devices.json, skips the detection (can be empty)
+ */
+type Target struct {
+	Address     string
+	Credentials Credentials
+	Fallback    []Credentials
+	JumpHosts   []JumpHost
+	Transport   string
+	OS          string
+}
+
+/**
+ * Returns the key identifying the target in the session cache.
+ */
+func (this Target) key() string {
+	key := this.Credentials.key() + "_" + this.Address
+	for _, cred := range this.Fallback {
+		key += "_or_" + cred.key()
+	}
+	if this.Transport != "" && this.Transport != TransportSSH {
+		key += "_" + this.Transport
+	}
+	if len(this.JumpHosts) > 0 {
+		key += "_via_" + jumpChainKey(this.JumpHosts)
+	}
+	return key
+}
+
+/**
+ * Returns the credentials to try, in order.
+ */
+func (this Target) credentialChain() []Credentials {
+	return append([]Credentials{this.Credentials}, this.Fallback...)
+}
+
+/**
+ * Encapsulated SSH session, including the native ssh.Session and its standard input/output pipelines,
+ * while also recording the last usage time.
+ *
+ * @attr client      Client that opened the session, holding the settings
+ * @attr sshClient   Native SSH client connection
+ * @attr telnet      Telnet connection, used instead of client and session for the telnet transport
+ * @attr jumpHosts   Jump hosts the client connection is tunneled through
+ * @attr session      Native SSH session
+ * @attr in          Pipeline bound to the session's standard input
+ * @attr out         Pipeline bound to the session's standard output
+ * @attr hangup      Closed when the device closes the connection
+ * @attr lastUseTime Last usage time
+ * @attr credentials Credentials the device accepted
+ * @attr driver      Driver of the OS of the device (nil until the OS is known)
+ * @attr prompt      Prompt learned from the device after login
+ * @attr unhealthy   An operation on the session was cancelled or timed out mid-way, its state is unknown and it must not be reused
+ * @author shenbowei
+ */
+type SSHSession struct {
+	client      *Client
+	sshClient   *ssh.Client
+	telnet      *telnetConn
+	jumpHosts   []JumpHost
+	session     *ssh.Session
+	in          chan string
+	out         chan string
+	hangup      chan struct{}
+	brand       string
+	candidates  []Candidate
+	version     string
+	banner      string
+	driver      Driver
+	lastUseTime time.Time
+	credentials Credentials
+	prompt      *regexp.Regexp
+	promptStr   string
+	unhealthy   bool
+}
+
+/**
+ * Creates an SSHSession, equivalent to the constructor of SSHSession.
+ *
+ * @param user     SSH connection username
+ * @param password Password
+ * @param ipPort   Switch IP and port
+ * @return         Opened SSHSession and execution errors
+ * @author shenbowei
+ */
+func (this *Client) NewSSHSession(user, password, ipPort string) (*SSHSession, error) {
+	return this.NewSSHSessionWithTarget(Target{Address: ipPort, Credentials: Credentials{User: user, Password: password}})
+}
+
+/**
+ * Creates an SSHSession to the target, authenticating with its credentials and tunneling through its jump hosts.
+ *
+ * @param target Switch address, credentials and jump hosts
+ * @return       Opened SSHSession and execution errors
+ */
+func (this *Client) NewSSHSessionWithTarget(target Target) (*SSHSession, error) {
+	return this.NewSSHSessionContext(context.Background(), target)
+}
+
+/**
+ * Same as NewSSHSessionWithTarget, but dialing, authentication and waiting for the first prompt
+ * are aborted when the context is cancelled.
+ *
+ * @param ctx    Context of the connection
+ * @param target Switch address, credentials and jump hosts
+ * @return       Opened SSHSession and execution errors (the context error when cancelled)
+ */
+func (this *Client) NewSSHSessionContext(ctx context.Context, target Target) (*SSHSession, error) {
+	sshSession := new(SSHSession)
+	sshSession.client = this
+	// Try first the credentials the device accepted last time
+	chain := this.credHistory.order(target.Address, target.credentialChain())
+	if err := sshSession.createConnection(ctx, target, chain); err != nil {
+		this.LogError("NewSSHSession createConnection error:%s", err.Error())
+		return nil, err
+	}
+	if err := sshSession.muxShell(); err != nil {
+		this.LogError("NewSSHSession muxShell error:%s", err.Error())
+		sshSession.Close()
+		return nil, err
+	}
+	if err := sshSession.start(ctx, chain); err != nil {
+		this.LogError("NewSSHSession start error:%s", err.Error())
+		sshSession.Close()
+		if errors.Is(err, ErrTelnetLogin) {
+			return nil, newAuthError(target.Address, chain, err)
+		}
+		return nil, err
+	}
+	if len(chain) > 1 {
+		this.credHistory.remember(target.Address, sshSession.credentials)
+	}
+	sshSession.lastUseTime = time.Now()
+	sshSession.brand = ""
+	return sshSession, nil
+}
+
+/**
+ * Retrieves the last usage time.
+ *
+ * @return time.Time
+ * @author shenbowei
+ */
+func (this *SSHSession) GetLastUseTime() time.Time {
+	return this.lastUseTime
+}
+
+/**
+ * Updates the last usage time.
+ *
+ * @author shenbowei
+ */
+func (this *SSHSession) UpdateLastUseTime() {
+	this.lastUseTime = time.Now()
+}
+
+/**
+ * Connects to the switch (through the jump hosts of the target, if any) and opens an SSH session,
+ * or a telnet connection when the transport of the target asks for it.
+ * SSH credentials are tried in order until the device accepts one, telnet logins try them in start.
+ *
+ * @param ctx      Context of the connection
+ * @param target   Switch address, jump hosts and transport
+ * @param creds    Credentials tried in order
+ * @return         Execution errors, AuthError if the device refused all credentials
+ * @author shenbowei
+ */
+func (this *SSHSession) createConnection(ctx context.Context, target Target, creds []Credentials) error {
+	if target.Transport == TransportSNMP {
+		return fmt.Errorf("%s: command line over SNMP: %w", target.Address, ErrNotSupported)
+	}
+	dial := (&net.Dialer{Timeout: this.client.DialTimeout}).DialContext
+	if len(target.JumpHosts) > 0 {
+		bastion, err := this.client.jumpHosts.acquire(ctx, target.JumpHosts)
+		if err != nil {
+			this.client.LogError("SSH jump host err:%s", err.Error())
+			return err
+		}
+		this.jumpHosts = target.JumpHosts
+		dial = bastion.DialContext
+	}
+	if target.Transport == TransportTelnet {
+		if err := this.createTelnetConnection(ctx, dial, target.Address); err != nil {
+			this.releaseJumpHosts()
+			return err
+		}
+		return nil
+	}
+	this.client.LogDebug("<Test> Begin connect")
+	client, err := this.dialWithFallback(ctx, dial, target.Address, creds)
+	if err != nil && target.Transport == TransportAuto && isConnectionRefused(err) {
+		this.client.LogDebug("SSH refused by %s, falling back to telnet", target.Address)
+		if err := this.createTelnetConnection(ctx, dial, this.client.telnetAddress(target.Address)); err != nil {
+			this.releaseJumpHosts()
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		this.client.LogError("SSH Dial err:%s", err.Error())
+		this.releaseJumpHosts()
+		return err
+	}
+	this.client.LogDebug("<Test> End connect")
+	this.client.LogDebug("<Test> Begin new session")
+	session, err := client.NewSession()
+	if err != nil {
+		this.client.LogError("NewSession err:%s", err.Error())
+		client.Close()
+		this.releaseJumpHosts()
+		return withKind(ErrNoShell, err)
+	}
+	this.sshClient = client
+	this.session = session
+	this.client.LogDebug("<Test> End new session")
+	return nil
+}
+
+/**
+ * Opens the SSH connection, trying the credentials in order while the device refuses them.
+ * Connection errors are returned right away, as other credentials would fail the same way.
+ *
+ * @param ctx     Context of the connection
+ * @param dial    Function opening the transport connection
+ * @param address Switch address
+ * @param creds   Credentials tried in order
+ * @return        SSH client, AuthError if the device refused all credentials, other connection errors
+ */
+func (this *SSHSession) dialWithFallback(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), address string, creds []Credentials) (*ssh.Client, error) {
+	var lastErr error
+	for _, cred := range creds {
+		client, err := this.client.dialSSH(ctx, dial, address, cred, this.rememberBanner)
+		if err == nil {
+			this.credentials = cred
+			this.version = string(client.ServerVersion())
+			return client, nil
+		}
+		if !isAuthFailure(err) {
+			return nil, err
+		}
+		this.client.LogDebug("Credentials %s refused by %s", cred.describe(), address)
+		lastErr = err
+	}
+	return nil, newAuthError(address, creds, lastErr)
+}
+
+/**
+ * Keeps the banner the SSH server sent before the authentication.
+ *
+ * @param message Banner text
+ * @return        Always nil, the banner does not affect the login
+ */
+func (this *SSHSession) rememberBanner(message string) error {
+	this.banner = strings.TrimSpace(message)
+	return nil
+}
+
+/**
+ * Releases the jump host connections used by the session.
+ */
+func (this *SSHSession) releaseJumpHosts() {
+	if len(this.jumpHosts) > 0 {
+		this.client.jumpHosts.release(this.jumpHosts)
+		this.jumpHosts = nil
+	}
+}
+
+/**
+ * Opens an authenticated SSH connection over a connection created by the dial function.
+ * Cancelling the context closes the connection, aborting the handshake and the authentication.
+ *
+ * @param ctx      Context of the connection
+ * @param dial     Function opening the transport connection (direct TCP or through a jump host)
+ * @param ipPort   IP and port to connect to
+ * @param cred     Credentials
+ * @param banner   Called with the banner the server sends before the authentication (can be nil)
+ * @return         SSH client and execution errors
+ */
+func (this *Client) dialSSH(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), ipPort string, cred Credentials, banner ssh.BannerCallback) (*ssh.Client, error) {
+	auth, agentConn, err := cred.authMethods()
+	if agentConn != nil {
+		defer agentConn.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, hostKeyAlgorithms, err := this.hostKeys.clientOptions(ipPort)
+	if err != nil {
+		return nil, err
+	}
+	// Once the host key is accepted the handshake moves on to the authentication,
+	// errors after that point other than timeouts mean the server refused the credentials
+	var authenticating atomic.Bool
+	verifyHostKey := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := hostKeyCallback(hostname, remote, key)
+		authenticating.Store(err == nil)
+		return err
+	}
+	conn, err := dial(ctx, "tcp", ipPort)
+	if err != nil {
+		return nil, classifyDialError(ctx, err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	// Connections tunneled through a jump host do not support deadlines, the error is ignored for them
+	conn.SetDeadline(time.Now().Add(this.DialTimeout))
+	c, chans, reqs, err := ssh.NewClientConn(conn, ipPort, &ssh.ClientConfig{
+		User:              cred.User,
+		Auth:              auth,
+		HostKeyCallback:   verifyHostKey,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		BannerCallback:    banner,
+		Timeout:           this.DialTimeout,
+		Config: ssh.Config{
+			Ciphers: []string{"aes128-ctr", "aes192-ctr", "aes256-ctr", "aes128-gcm@openssh.com",
+				"arcfour256", "arcfour128", "aes128-cbc", "aes256-cbc", "3des-cbc", "des-cbc",
+			},
+			KeyExchanges: []string{
+				"diffie-hellman-group-exchange-sha1",
+				"diffie-hellman-group-exchange-sha256",
+				"diffie-hellman-group14-sha1",
+				"ecdh-sha2-nistp256",
+				"ecdh-sha2-nistp384",
+				"ecdh-sha2-nistp521",
+			},
+		},
+	})
+	if !stop() {
+		// The context was cancelled during the handshake, the connection is already closed
+		if err == nil {
+			c.Close()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		var netErr net.Error
+		if authenticating.Load() && !(errors.As(err, &netErr) && netErr.Timeout()) {
+			return nil, &authRefusedError{err: err}
+		}
+		return nil, classifyDialError(ctx, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+/**
+ * Starts multiple threads to transfer data from the two returned pipes to the session's input and output pipes.
+ *
+ * @return Error information (error)
+ * @author shenbowei
+ */
+func (this *SSHSession) muxShell() error {
+	defer func() {
+		if err := recover(); err != nil {
+			this.client.LogError("SSHSession muxShell err:%s", err)
+		}
+	}()
+	if this.telnet != nil {
+		this.mux(this.telnet, this.telnet)
+		return nil
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,     // disable echoing
+		ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
+		ssh.TTY_OP_OSPEED: 14400, // output speed = 14.4kbaud
+	}
+	if err := this.session.RequestPty("vt100", 80, 40, modes); err != nil {
+		this.client.LogError("RequestPty error:%s", err)
+		return withKind(ErrNoShell, err)
+	}
+	w, err := this.session.StdinPipe()
+	if err != nil {
+		this.client.LogError("StdinPipe() error:%s", err.Error())
+		return withKind(ErrNoShell, err)
+	}
+	r, err := this.session.StdoutPipe()
+	if err != nil {
+		this.client.LogError("StdoutPipe() error:%s", err.Error())
+		return withKind(ErrNoShell, err)
+	}
+	this.mux(w, r)
+	return nil
+}
+
+/**
+ * Starts the threads copying the input pipeline to the writer and the reader to the output pipeline.
+ *
+ * @param w Standard input of the remote shell
+ * @param r Standard output of the remote shell
+ */
+func (this *SSHSession) mux(w io.Writer, r io.Reader) {
+	in := make(chan string, 1024)
+	out := make(chan string, 1024)
+	hangup := make(chan struct{})
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				this.client.LogError("Goroutine muxShell write err:%s", err)
+			}
+		}()
+		for cmd := range in {
+			_, err := w.Write([]byte(cmd + "\n"))
+			if err != nil {
+				this.client.LogDebug("Writer write err:%s", err.Error())
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(hangup)
+		defer func() {
+			if err := recover(); err != nil {
+				this.client.LogError("Goroutine muxShell read err:%s", err)
+			}
+		}()
+		var (
+			buf [65 * 1024]byte
+			t   int
+		)
+		for {
+			n, err := r.Read(buf[t:])
+			if err != nil {
+				this.client.LogDebug("Reader read err:%s", err.Error())
+				return
+			}
+			t += n
+			out <- string(buf[:t])
+			t = 0
+		}
+	}()
+	this.in = in
+	this.out = out
+	this.hangup = hangup
+}
+
+/**
+ * Waits until the device closes the connection.
+ *
+ * @param ctx     Context of the wait
+ * @param timeout Maximum time to wait
+ * @return        true if the device closed the connection
+ */
+func (this *SSHSession) waitHangup(ctx context.Context, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case <-this.hangup:
+		return true
+	case <-deadline.C:
+	case <-ctx.Done():
+	}
+	return false
+}
+
+/**
+ * Starts opening a remote SSH login shell, after which commands can be executed.
+ * Telnet connections log in by answering the username and password prompts instead.
+ *
+ * @param ctx   Context of the login
+ * @param creds Credentials tried in order for the telnet login
+ * @return ErrNoShell if the shell was refused, ErrPromptNotFound if no prompt was recognized, ErrTelnetLogin, the context error
+ * @author shenbowei
+ */
+func (this *SSHSession) start(ctx context.Context, creds []Credentials) error {
+	if this.telnet != nil {
+		err := this.telnetLogin(ctx, creds)
+		if errors.Is(err, ErrTelnetLogin) {
+			return err
+		}
+		return withKind(ErrPromptNotFound, err)
+	}
+	if err := this.session.Shell(); err != nil {
+		this.client.LogError("Start shell error:%s", err.Error())
+		return withKind(ErrNoShell, err)
+	}
+	// Wait for login information output and remember the prompt the device answers with
+	return withKind(ErrPromptNotFound, this.learnPrompt(ctx, defaultPromptRegexp))
+}
+
+/**
+ * Waits for a line matching the given prompt shape and remembers it as the session prompt.
+ * A single empty line is sent if the device stays silent, some devices only print the prompt after a keypress.
+ *
+ * @param ctx     Context of the read
+ * @param pattern Prompt shape to look for
+ * @return Error information (error)
+ */
+func (this *SSHSession) learnPrompt(ctx context.Context, pattern *regexp.Regexp) error {
+	output, err := this.readChannelRegexp(ctx, pattern, this.client.LoginTimeout)
+	if errors.Is(err, ErrPromptTimeout) {
+		// The prompt read after the keypress synchronizes the session again
+		this.unhealthy = false
+		this.WriteChannel("")
+		output, err = this.readChannelRegexp(ctx, pattern, this.client.LoginTimeout)
+	}
+	if err != nil {
+		this.client.LogError("learnPrompt error:%s", err.Error())
+		return err
+	}
+	return this.rememberPrompt(output)
+}
+
+/**
+ * Remembers the last line of the output as the session prompt.
+ *
+ * @param output Output ending with the prompt
+ * @return Error information (error)
+ */
+func (this *SSHSession) rememberPrompt(output string) error {
+	promptStr := lastLine(output)
+	match := promptBaseRegexp.FindStringSubmatch(promptStr)
+	if match == nil {
+		return fmt.Errorf("unable to learn prompt from %q", promptStr)
+	}
+	// The hostname stays the same, while the mode part (config, interface, system view) may change
+	this.prompt = regexp.MustCompile(`^[<\[\(]?` + regexp.QuoteMeta(match[1]) + `[^\r\n]{0,64}?[#>\]\$%]\s*$`)
+	this.promptStr = promptStr
+	this.client.LogDebug("Learned prompt '%s'", promptStr)
+	return nil
+}
+
+/**
+ * Re-learns the prompt using the prompt shape declared for the OS in devices.json.
+ *
+ * @param pattern Prompt regex of the OS (empty keeps the current prompt)
+ * @return Error information (error)
+ */
+func (this *SSHSession) SetPromptPattern(pattern string) error {
+	return this.setPromptPattern(context.Background(), pattern)
+}
+
+func (this *SSHSession) setPromptPattern(ctx context.Context, pattern string) error {
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid prompt pattern %q: %s", pattern, err)
+	}
+	this.ClearChannel()
+	this.WriteChannel("")
+	return this.learnPrompt(ctx, re)
+}
+
+/**
+ * Retrieves the prompt learned after login.
+ *
+ * @return The prompt line, for example "switch#"
+ */
+func (this *SSHSession) GetPrompt() string {
+	return this.promptStr
+}
+
+/**
+ * Checks if the current session is available.
+ * Sessions marked unhealthy by a cancelled or timed out operation are never available.
+ *
+ * @return true: Available, false: Not available
+ * @author shenbowei
+ */
+func (this *SSHSession) CheckSelf() bool {
+	defer func() {
+		if err := recover(); err != nil {
+			this.client.LogError("SSHSession CheckSelf err:%s", err)
+		}
+	}()
+	if this.unhealthy {
+		return false
+	}
+
+	this.ClearChannel()
+	this.WriteChannel("")
+	_, err := this.ReadChannelPrompt(2 * time.Second)
+	return err == nil
+}
+
+/**
+ * Retrieves the brand of the switch currently accessed via SSH.
+ *
+ * @return string (huawei, h3c, cisco)
+ * @author shenbowei
+ */
+func (this *SSHSession) GetSSHBrand() string {
+	brand, _ := this.GetSSHBrandContext(context.Background())
+	return brand
+}
+
+/**
+ * Same as GetSSHBrand, but the probes are aborted when the context is cancelled.
+ *
+ * @param ctx Context of the detection
+ * @return    Device OS name from devices.json ("" if unknown) and the context error when cancelled
+ */
+func (this *SSHSession) GetSSHBrandContext(ctx context.Context) (string, error) {
+	// A device that was not recognized is not probed again
+	if this.brand != "" || this.candidates != nil {
+		return this.brand, nil
+	}
+	_, err := this.DetectContext(ctx)
+	return this.brand, err
+}
+
+/**
+ * Probes the device in stages and ranks the OSes it may run (see Client.DetectOS).
+ * The best candidate becomes the brand of the session if its confidence reaches Client.MinConfidence
+ * and the OS was not known in advance.
+ *
+ * @param ctx Context of the detection
+ * @return    Ranked candidates and the context error when cancelled
+ */
+func (this *SSHSession) DetectContext(ctx context.Context) (candidates []Candidate, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			this.client.LogError("SSHSession GetSSHBrand err:%s", recovered)
+		}
+	}()
+	signals := DetectionSignals{SSHVersion: this.version, Banner: this.banner, Prompt: this.promptStr}
+	signals, err = this.probe(ctx, signals)
+	if err != nil {
+		return nil, err
+	}
+	this.candidates = this.client.DetectOS(signals)
+	this.client.LogDebug("Candidates: %s", FormatCandidates(this.candidates))
+	detect := this.client.detectedOS(this.candidates)
+	if detect != nil {
+		this.client.LogDebug("Match Found: Name: %s Confidence: %.2f", detect.Name, detect.Confidence)
+		if this.brand == "" {
+			this.brand = detect.Name
+		}
+	} else {
+		this.client.saveUnknownModel(fmt.Sprintf("----------------BEGIN---------------\n%s\n--------------------------END---------------------\n", signals.Output))
+	}
+	return this.candidates, nil
+}
+
+/**
+ * Returns the SSH server version string of the device, e.g. SSH-2.0-Cisco-1.25.
+ *
+ * @return Server version, empty for telnet sessions
+ */
+func (this *SSHSession) ServerVersion() string {
+	return this.version
+}
+
+/**
+ * Returns the banner the device showed before the login:
+ * the SSH authentication banner, or the text before the first telnet login prompt.
+ *
+ * @return Banner, empty if the device showed none
+ */
+func (this *SSHSession) Banner() string {
+	return this.banner
+}
+
+/**
+ * Returns the OS candidates ranked by the last detection of the session.
+ *
+ * @return Ranked candidates, nil if the OS was known in advance and never detected
+ */
+func (this *SSHSession) Candidates() []Candidate {
+	return this.candidates
+}
+
+/**
+ * Closes the SSHSession, shutting down the session and input/output pipelines.
+ * The CLI session is ended with the logout command of the driver first, unless the session is unhealthy.
+ *
+ * @author shenbowei
+ */
+func (this *SSHSession) Close() {
+	defer func() {
+		if err := recover(); err != nil {
+			this.client.LogError("SSHSession Close err:%s", err)
+		}
+	}()
+	if this.driver != nil && !this.unhealthy {
+		ctx, cancel := context.WithTimeout(context.Background(), this.client.CommandTimeout)
+		if err := this.driver.Logout(ctx, this); err != nil {
+			this.client.LogDebug("Logout err:%s", err.Error())
+		}
+		cancel()
+	}
+	if this.telnet != nil {
+		if err := this.telnet.Close(); err != nil {
+			this.client.LogDebug("Close telnet err:%s", err.Error())
+		}
+	} else {
+		if err := this.session.Close(); err != nil && err != io.EOF {
+			this.client.LogError("Close session err:%s", err.Error())
+		}
+		if err := this.sshClient.Close(); err != nil {
+			this.client.LogDebug("Close client err:%s", err.Error())
+		}
+	}
+	this.releaseJumpHosts()
+	close(this.in)
+	close(this.out)
+}
+
+/**
+ * Writes execution commands to the pipeline.
+ *
+ * @param cmds... Commands to execute (multiple commands allowed)
+ * @author shenbowei
+ */
+func (this *SSHSession) WriteChannel(cmds ...string) {
+	this.WriteChannelContext(context.Background(), cmds...)
+}
+
+/**
+ * Same as WriteChannel, but gives up when the context is cancelled while the input pipeline is full.
+ * The session is marked unhealthy then, as only a part of the commands may have been written.
+ *
+ * @param ctx     Context of the write
+ * @param cmds... Commands to execute (multiple commands allowed)
+ * @return        The context error when cancelled
+ */
+func (this *SSHSession) WriteChannelContext(ctx context.Context, cmds ...string) error {
+	this.client.LogDebug("WriteChannel <cmds=%v>", cmds)
+	for _, cmd := range cmds {
+		select {
+		case this.in <- cmd:
+		case <-ctx.Done():
+			this.unhealthy = true
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+/**
+ * Reads the execution results returned by the device from the output pipeline.
+ * If the output stream interval exceeds the timeout or contains characters from expects, it will return.
+ *
+ * @param timeout Time to wait when no data is received from the device (if the timeout is exceeded, it is considered that the device's response has been fully read)
+ * @param expects... Expected characters (can be multiple), returns when any of these are found
+ * @return The result read from the output pipeline
+ * @author shenbowei
+ */
+func (this *SSHSession) ReadChannelExpect(timeout time.Duration, expects ...string) string {
+	output, _ := this.ReadChannelExpectContext(context.Background(), timeout, expects...)
+	return output
+}
+
+/**
+ * Same as ReadChannelExpect, but returns as soon as the context is cancelled.
+ * The session is marked unhealthy then, as the rest of the output is still pending.
+ *
+ * @param ctx        Context of the read
+ * @param timeout    Time to wait when no data is received from the device
+ * @param expects... Expected characters (can be multiple), returns when any of these are found
+ * @return           The result read so far and the context error when cancelled
+ */
+func (this *SSHSession) ReadChannelExpectContext(ctx context.Context, timeout time.Duration, expects ...string) (string, error) {
+	this.client.LogDebug("ReadChannelExpect <wait timeout = %d>", timeout/time.Millisecond)
+	output := ""
+	isDelayed := false
+	for i := 0; i < 300; i++ { // Read from the device a maximum of 300 times to avoid the method not returning
+		// Sleep for 0.1 seconds each time to allow data in the out pipeline to accumulate for a while,
+		// avoiding prematurely triggering the default wait exit.
+		if err := this.sleepContext(ctx, time.Millisecond*100); err != nil {
+			return output, err
+		}
+		newData := this.readChannelData()
+		this.client.LogDebug("ReadChannelExpect: read chanel buffer: %s", newData)
+		if newData != "" {
+			output += newData
+			isDelayed = false
+			continue
+		}
+		for _, expect := range expects {
+			if strings.Contains(output, expect) {
+				return output, nil
+			}
+		}
+		// If it has already waited once before, exit directly; otherwise, wait for a timeout once and then read the content again.
+		if !isDelayed {
+			this.client.LogDebug("ReadChannelExpect: delay for timeout")
+			if err := this.sleepContext(ctx, timeout); err != nil {
+				return output, err
+			}
+			isDelayed = true
+		} else {
+			return output, nil
+		}
+	}
+	return output, nil
+}
+
+/**
+ * Reads the execution results returned by the device from the output pipeline.
+ * If the output stream interval exceeds the timeout, it will return.
+ *
+ * @param timeout Time to wait when no data is received from the device (if the timeout is exceeded, it is considered that the device's response has been fully read)
+ * @return The result read from the output pipeline
+ * @author shenbowei
+ */
+func (this *SSHSession) ReadChannelTiming(timeout time.Duration) string {
+	output, _ := this.ReadChannelTimingContext(context.Background(), timeout)
+	return output
+}
+
+/**
+ * Same as ReadChannelTiming, but returns as soon as the context is cancelled.
+ * The session is marked unhealthy then, as the rest of the output is still pending.
+ *
+ * @param ctx     Context of the read
+ * @param timeout Time to wait when no data is received from the device
+ * @return        The result read so far and the context error when cancelled
+ */
+func (this *SSHSession) ReadChannelTimingContext(ctx context.Context, timeout time.Duration) (string, error) {
+	this.client.LogDebug("ReadChannelTiming <wait timeout = %d>", timeout/time.Millisecond)
+	output := ""
+	isDelayed := false
+
+	for i := 0; i < 300; i++ { // Read from the device a maximum of 300 times to avoid the method not returning.
+		// Sleep for 0.1 seconds each time to allow data in the out pipeline to accumulate
+		// preventing premature triggering of the default wait exit.
+		if err := this.sleepContext(ctx, time.Millisecond*100); err != nil {
+			return output, err
+		}
+		newData := this.readChannelData()
+		this.client.LogDebug("ReadChannelTiming: read chanel buffer: %s", newData)
+		if newData != "" {
+			output += newData
+			isDelayed = false
+			continue
+		}
+		// If it has already waited once, exit directly; otherwise, wait for a timeout once and then read the content again.
+		if !isDelayed {
+			this.client.LogDebug("ReadChannelTiming: delay for timeout.")
+			if err := this.sleepContext(ctx, timeout); err != nil {
+				return output, err
+			}
+			isDelayed = true
+		} else {
+			return output, nil
+		}
+	}
+	return output, nil
+}
+
+/**
+ * Waits for the duration, returning early when the context is cancelled and marking the session unhealthy.
+ */
+func (this *SSHSession) sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		this.unhealthy = true
+		return ctx.Err()
+	}
+}
+
+/**
+ * Executes a single command and waits for the prompt to reappear.
+ *
+ * @param cmd     Command to execute
+ * @param timeout Hard deadline for the command
+ * @return The command result and ErrOutputTruncated (wrapping ErrPromptTimeout) if the prompt did not reappear in time
+ */
+func (this *SSHSession) ExecCommand(cmd string, timeout time.Duration) (CommandResult, error) {
+	return this.ExecCommandContext(context.Background(), cmd, timeout)
+}
+
+/**
+ * Same as ExecCommand, but returns as soon as the context is cancelled.
+ *
+ * @param ctx     Context of the command
+ * @param cmd     Command to execute
+ * @param timeout Hard deadline for the command
+ * @return The command result and ErrOutputTruncated or the context error if the prompt did not reappear
+ */
+func (this *SSHSession) ExecCommandContext(ctx context.Context, cmd string, timeout time.Duration) (CommandResult, error) {
+	result := CommandResult{Command: cmd, StartTime: time.Now()}
+	if err := this.WriteChannelContext(ctx, cmd); err != nil {
+		result.EndTime = time.Now()
+		return result, err
+	}
+	output, err := this.ReadChannelPromptContext(ctx, timeout)
+	result.EndTime = time.Now()
+	if err != nil {
+		// Keep the whole partial output, the last line is not a prompt
+		output += "\n"
+	}
+	result.Output = cleanCommandOutput(output, cmd)
+	result.Failed = this.isCommandError(result.Output)
+	return result, err
+}
+
+/**
+ * Reads the execution results returned by the device from the output pipeline until the learned prompt reappears.
+ * Pagination prompts (--More--) are answered with a space while reading.
+ *
+ * @param timeout Hard deadline for the whole read
+ * @return The result read from the output pipeline and ErrOutputTruncated (wrapping ErrPromptTimeout) if the prompt did not reappear in time
+ */
+func (this *SSHSession) ReadChannelPrompt(timeout time.Duration) (string, error) {
+	return this.ReadChannelPromptContext(context.Background(), timeout)
+}
+
+/**
+ * Same as ReadChannelPrompt, but returns as soon as the context is cancelled.
+ * The session is marked unhealthy then or when the prompt did not reappear, as the rest of the output is still pending.
+ *
+ * @param ctx     Context of the read
+ * @param timeout Hard deadline for the whole read
+ * @return The result read so far, ErrOutputTruncated (wrapping ErrPromptTimeout or ErrChannelClosed)
+ *         or the context error if the prompt did not reappear
+ */
+func (this *SSHSession) ReadChannelPromptContext(ctx context.Context, timeout time.Duration) (string, error) {
+	prompt := this.prompt
+	if prompt == nil {
+		prompt = defaultPromptRegexp
+	}
+	output, err := this.readChannelRegexp(ctx, prompt, timeout)
+	if errors.Is(err, ErrPromptTimeout) || errors.Is(err, ErrChannelClosed) {
+		err = fmt.Errorf("%w: %w", ErrOutputTruncated, err)
+	}
+	return output, err
+}
+
+/**
+ * Reads from the output pipeline until the last line of the output matches the given regex or the deadline passes.
+ * The session is marked unhealthy when the deadline passes or the context is cancelled,
+ * as the rest of the output is still pending and would be read by the next command.
+ *
+ * @param ctx     Context of the read
+ * @param pattern Regex matched against the last output line
+ * @param timeout Hard deadline for the whole read
+ * @return The result read from the output pipeline and execution errors
+ */
+func (this *SSHSession) readChannelRegexp(ctx context.Context, pattern *regexp.Regexp, timeout time.Duration) (string, error) {
+	this.client.LogDebug("readChannelRegexp <pattern=%s, deadline=%d>", pattern, timeout/time.Millisecond)
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	var buffer strings.Builder
+	// Start of the last line of the output, only the last line is matched so long outputs are not scanned again
+	lineStart := 0
+	// Position after the last answered pagination prompt, so it is not answered twice
+	moreAt := 0
+	for {
+		select {
+		case channelData, ok := <-this.out:
+			if !ok {
+				return buffer.String(), ErrChannelClosed
+			}
+			buffer.WriteString(channelData)
+			output := buffer.String()
+			if i := strings.LastIndex(channelData, "\n"); i >= 0 {
+				lineStart = len(output) - len(channelData) + i + 1
+			}
+			if pattern.MatchString(lastLine(output[lineStart:])) {
+				return output, nil
+			}
+			if morePromptRegexp.MatchString(output[max(lineStart, moreAt):]) {
+				this.WriteChannel(" ")
+				moreAt = len(output)
+			}
+		case <-deadline.C:
+			this.client.LogDebug("readChannelRegexp: deadline reached, read so far: %s", buffer.String())
+			this.unhealthy = true
+			return buffer.String(), ErrPromptTimeout
+		case <-ctx.Done():
+			this.client.LogDebug("readChannelRegexp: cancelled, read so far: %s", buffer.String())
+			this.unhealthy = true
+			return buffer.String(), ctx.Err()
+		}
+	}
+}
+
+/**
+ * Returns the last line of the output without carriage returns and terminal escape sequences.
+ */
+func lastLine(output string) string {
+	output = ansiEscapeRegexp.ReplaceAllString(output, "")
+	if i := strings.LastIndex(output, "\n"); i >= 0 {
+		output = output[i+1:]
+	}
+	output = strings.Replace(output, "\r", "", -1)
+	return strings.TrimLeft(output, " \b")
+}
+
+/**
+ * Clears the contents of the pipe buffer to prevent any leftover data from the previous read
+ * from affecting the results of the next operation.
+ */
+func (this *SSHSession) ClearChannel() {
+	//time.Sleep(time.Millisecond * 100)
+	this.readChannelData()
+}
+
+/**
+ * Clears the contents of the pipe buffer to avoid leftover data from the previous read
+ * affecting the results of the next operation.
+ */
+func (this *SSHSession) readChannelData() string {
+	output := ""
+	for {
+		time.Sleep(time.Millisecond * 100)
+		select {
+		case channelData, ok := <-this.out:
+			if !ok {
+				// If the out pipe is already closed, stop reading; otherwise, <-this.out will enter an infinite loop.
+				return output
+			}
+			output += channelData
+		default:
+			return output
+		}
+	}
+}
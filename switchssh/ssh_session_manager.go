@@ -0,0 +1,332 @@
+package switchssh
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Commands disabling pagination, as declared by the OSes of devices.json.
+var (
+	HuaweiNoPage  = "screen-length 0 temporary"
+	H3cNoPage     = "screen-length disable"
+	CiscoNoPage   = "terminal length 0"
+	CiscoSMNoPage = "terminal datadump"
+	ArubaCXNoPage = "no page"
+)
+
+/**
+ * Manages SSHSessions and caches opened sessions, automatically handling sessions that have not been used for more than 10 minutes.
+ *
+ * @attr sessionCache: Map that caches all opened sessions (used within the last 10 minutes)
+ * @attr sessionLocker: Device lock
+ * @attr globalLocker: Global lock
+ * @attr client: Client owning the manager, holding the settings
+ * @attr stopClean: Closed to stop the automatic cleanup thread
+ * @attr stopOnce: Closes stopClean once, Close can be called more than once
+ * @author shenbowei
+ */
+type SessionManager struct {
+	sessionCache           map[string]*SSHSession
+	sessionLocker          map[string]*sync.Mutex
+	sessionCacheLocker     *sync.RWMutex
+	sessionLockerMapLocker *sync.RWMutex
+	client                 *Client
+	stopClean              chan struct{}
+	stopOnce               sync.Once
+}
+
+/**
+ * Creates a SessionManager, equivalent to the constructor of SessionManager.
+ *
+ * @param client Client owning the manager
+ * @return SessionManager instance
+ * @author shenbowei
+ */
+func NewSessionManager(client *Client) *SessionManager {
+	sessionManager := new(SessionManager)
+	sessionManager.client = client
+	sessionManager.stopClean = make(chan struct{})
+	sessionManager.sessionCache = make(map[string]*SSHSession, 0)
+	sessionManager.sessionLocker = make(map[string]*sync.Mutex, 0)
+	sessionManager.sessionCacheLocker = new(sync.RWMutex)
+	sessionManager.sessionLockerMapLocker = new(sync.RWMutex)
+	// Start an automatic cleanup thread to clear session cache not used for 10 minutes.
+	sessionManager.RunAutoClean()
+	return sessionManager
+}
+
+func (this *SessionManager) SetSessionCache(sessionKey string, session *SSHSession) {
+	this.sessionCacheLocker.Lock()
+	defer this.sessionCacheLocker.Unlock()
+	this.sessionCache[sessionKey] = session
+}
+
+func (this *SessionManager) GetSessionCache(sessionKey string) *SSHSession {
+	this.sessionCacheLocker.RLock()
+	defer this.sessionCacheLocker.RUnlock()
+	cache, ok := this.sessionCache[sessionKey]
+	if ok {
+		return cache
+	} else {
+		return nil
+	}
+}
+
+/**
+ * Locks the specified session.
+ *
+ * @param sessionKey: The index key of the session
+ * @author shenbowei
+ */
+func (this *SessionManager) LockSession(sessionKey string) {
+	this.sessionLockerMapLocker.RLock()
+	mutex, ok := this.sessionLocker[sessionKey]
+	this.sessionLockerMapLocker.RUnlock()
+	if !ok {
+		// If the lock cannot be obtained, it needs to be created. A global lock is required when updating the lock storage.
+		// Check again under the global lock, another worker may have created it in the meantime.
+		this.sessionLockerMapLocker.Lock()
+		mutex, ok = this.sessionLocker[sessionKey]
+		if !ok {
+			mutex = new(sync.Mutex)
+			this.sessionLocker[sessionKey] = mutex
+		}
+		this.sessionLockerMapLocker.Unlock()
+	}
+	mutex.Lock()
+}
+
+/**
+ * Unlocks the specified session.
+ *
+ * @param sessionKey: The index key of the session
+ * @author shenbowei
+ */
+func (this *SessionManager) UnlockSession(sessionKey string) {
+	this.sessionLockerMapLocker.RLock()
+	this.sessionLocker[sessionKey].Unlock()
+	this.sessionLockerMapLocker.RUnlock()
+}
+
+/**
+ * Updates the session in the session cache, connects to the device, opens a session, initializes the session
+ * (wait for login, identify device type, execute disable pagination), and adds it to the cache.
+ *
+ * @param ctx      Context of the connection
+ * @param target   Switch address, credentials and jump hosts
+ * @return         Execution errors
+ * @author shenbowei
+ */
+func (this *SessionManager) updateSession(ctx context.Context, target Target, brand string) error {
+	sessionKey := target.key()
+	mySession, err := this.client.NewSSHSessionContext(ctx, target)
+	if err != nil {
+		this.client.LogError("NewSSHSession err:%s", err.Error())
+		return err
+	}
+	// Initializes the session, including waiting for login output, entering privileged mode and disabling pagination.
+	if err := this.initSession(ctx, mySession, brand, mySession.credentials.EnableSecret); err != nil {
+		this.client.LogError("initSession err:%s", err.Error())
+		mySession.Close()
+		return err
+	}
+	// Updates the session cache.
+	this.SetSessionCache(sessionKey, mySession)
+	return nil
+}
+
+/**
+ * Initializes the session (wait for login, identify device type, enter privileged mode, execute disable pagination)
+ * with the driver of the OS.
+ *
+ * @param ctx: Context of the initialization
+ * @param session: The SSHSession that requires initialization
+ * @param brand: OS name known in advance (can be empty, the OS is detected then)
+ * @param enableSecret: Secret for entering privileged mode (can be empty)
+ * @return Execution errors, ErrEnableFailed if privileged mode could not be entered
+ * @author shenbowei
+ */
+func (this *SessionManager) initSession(ctx context.Context, session *SSHSession, brand string, enableSecret string) error {
+	driver, ok := this.client.Driver(brand)
+	if ok {
+		// The OS is known in advance, no need to detect it.
+		session.brand = brand
+	} else {
+		// If the provided device model does not match, it will fetch the model itself.
+		detected, err := session.GetSSHBrandContext(ctx)
+		if err != nil {
+			return err
+		}
+		if driver, ok = this.client.Driver(detected); !ok {
+			this.client.LogDebug("No driver for OS '%s'", detected)
+			return nil
+		}
+	}
+	session.driver = driver
+	// Re-learn the prompt with the prompt shape declared for the detected OS
+	if err := session.setPromptPattern(ctx, driver.PromptPattern()); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		this.client.LogError("SetPromptPattern error:%s", err)
+	}
+	if err := driver.Enable(ctx, session, enableSecret); err != nil {
+		return err
+	}
+	if err := driver.DisablePager(ctx, session); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		this.client.LogError("DisablePager error:%s", err)
+	}
+	return nil
+}
+
+/**
+ * Retrieves the session from the cache. If it does not exist or is unavailable, it will be recreated.
+ *
+ * @param user     SSH connection username
+ * @param password Password
+ * @param ipPort   Switch IP and port
+ * @return         SSHSession
+ * @author shenbowei
+ */
+func (this *SessionManager) GetSession(user, password, ipPort, brand string) (*SSHSession, error) {
+	return this.GetSessionWithTarget(Target{Address: ipPort, Credentials: Credentials{User: user, Password: password}}, brand)
+}
+
+/**
+ * Retrieves the session to the target from the cache. If it does not exist or is unavailable, it will be recreated.
+ *
+ * @param target   Switch address, credentials and jump hosts
+ * @param brand    Switch brand (can be empty)
+ * @return         SSHSession
+ */
+func (this *SessionManager) GetSessionWithTarget(target Target, brand string) (*SSHSession, error) {
+	return this.GetSessionContext(context.Background(), target, brand)
+}
+
+/**
+ * Same as GetSessionWithTarget, but connecting and initializing a new session are aborted when the context is cancelled.
+ *
+ * @param ctx      Context of the connection
+ * @param target   Switch address, credentials and jump hosts
+ * @param brand    Switch brand (can be empty)
+ * @return         SSHSession and execution errors (the context error when cancelled)
+ */
+func (this *SessionManager) GetSessionContext(ctx context.Context, target Target, brand string) (*SSHSession, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if brand == "" {
+		brand = target.OS
+	}
+	sessionKey := target.key()
+	session := this.GetSessionCache(sessionKey)
+	if session != nil {
+		// Before returning, verify if the session is available. If not, it must be recreated and the cache updated.
+		if session.CheckSelf() {
+			this.client.LogDebug("-----GetSession from cache-----")
+			session.UpdateLastUseTime()
+			return session, nil
+		}
+		this.client.LogDebug("Check session failed")
+		session.Close()
+	}
+	// If it does not exist or validation fails, a reconnection is required, and the cache should be updated.
+	if err := this.updateSession(ctx, target, brand); err != nil {
+		this.client.LogError("SSH session pool updateSession err:%s", err.Error())
+		return nil, err
+	} else {
+		return this.GetSessionCache(sessionKey), nil
+	}
+}
+
+/**
+ * Closes and removes the cached session if an operation on it was cancelled, so the connection
+ * does not stay open with a half-read output until the next use.
+ *
+ * @param sessionKey: The index key of the session
+ */
+func (this *SessionManager) discardUnhealthy(sessionKey string) {
+	this.sessionCacheLocker.Lock()
+	defer this.sessionCacheLocker.Unlock()
+	if session, ok := this.sessionCache[sessionKey]; ok && session.unhealthy {
+		this.client.LogDebug("Discarding unhealthy session <%s>", sessionKey)
+		session.Close()
+		delete(this.sessionCache, sessionKey)
+	}
+}
+
+/**
+ * Starts automatically cleaning up sessions in the cache that have not been used for more than 10 minutes.
+ *
+ * @author shenbowei
+ */
+func (this *SessionManager) RunAutoClean() {
+	go func() {
+		for {
+			timeoutSessionIndex := this.getTimeoutSessionIndex()
+			this.sessionCacheLocker.Lock()
+			for _, sessionKey := range timeoutSessionIndex {
+				//this.LockSession(sessionKey)
+				delete(this.sessionCache, sessionKey)
+				//this.UnlockSession(sessionKey)
+			}
+			this.sessionCacheLocker.Unlock()
+			select {
+			case <-this.stopClean:
+				return
+			case <-time.After(30 * time.Second):
+			}
+		}
+	}()
+}
+
+/**
+ * Stops the automatic cleanup and closes all sessions in the cache.
+ * Calling it again only closes the sessions cached since.
+ */
+func (this *SessionManager) Close() {
+	this.stopOnce.Do(func() { close(this.stopClean) })
+	this.sessionCacheLocker.Lock()
+	defer this.sessionCacheLocker.Unlock()
+	// Sessions log out in parallel, each may wait a moment for its device to hang up
+	var wg sync.WaitGroup
+	for sessionKey, session := range this.sessionCache {
+		wg.Add(1)
+		go func(session *SSHSession) {
+			defer wg.Done()
+			session.Close()
+		}(session)
+		delete(this.sessionCache, sessionKey)
+	}
+	wg.Wait()
+}
+
+/**
+ * Retrieves all sessionKeys of sessions that have timed out (not used for more than 10 minutes) in the cache.
+ *
+ * @return []string Array of sessionKeys for all timed-out sessions
+ * @author shenbowei
+ */
+func (this *SessionManager) getTimeoutSessionIndex() []string {
+	timeoutSessionIndex := make([]string, 0)
+	this.sessionCacheLocker.RLock()
+	defer func() {
+		this.sessionCacheLocker.RUnlock()
+		if err := recover(); err != nil {
+			this.client.LogError("SSHSessionManager getTimeoutSessionIndex err:%s", err)
+		}
+	}()
+	for sessionKey, SSHSession := range this.sessionCache {
+		timeDuratime := time.Now().Sub(SSHSession.GetLastUseTime())
+		if timeDuratime.Minutes() > 10 {
+			this.client.LogDebug("RunAutoClean close session<%s, unuse time=%s>", sessionKey, timeDuratime.String())
+			SSHSession.Close()
+			timeoutSessionIndex = append(timeoutSessionIndex, sessionKey)
+		}
+	}
+	return timeoutSessionIndex
+}
@@ -0,0 +1,10 @@
+package switchssh
+
+import "testing"
+
+func TestClientCloseTwice(t *testing.T) {
+	client := newTestClient(t)
+	client.Close()
+	// Deferred and signal handler calls may both close the client
+	client.Close()
+}
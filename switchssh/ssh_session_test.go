@@ -0,0 +1,61 @@
+package switchssh
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// session reading the given chunks of device output, answers to pagination prompts are kept in the input pipeline
+func newChunkSession(t *testing.T, chunks ...string) *SSHSession {
+	client := newTestClient(t)
+	t.Cleanup(func() { client.Close() })
+	session := &SSHSession{client: client, in: make(chan string, 10), out: make(chan string, len(chunks))}
+	for _, chunk := range chunks {
+		session.out <- chunk
+	}
+	return session
+}
+
+func TestReadChannelRegexp(t *testing.T) {
+	prompt := regexp.MustCompile(`^sw1[>#]\s*$`)
+	lines := strings.Repeat("0011.2233.4455    DYNAMIC     Gi1/0/1\r\n", 1000)
+	chunks := []string{}
+	for i := 0; i < 50; i++ {
+		chunks = append(chunks, lines)
+	}
+	// The prompt arrives split, after a pagination prompt answered once, and a prompt-like word inside a line
+	chunks = append(chunks, "sw1# is in the description\r\n --More-- ", "\b\b\b\b\b\b\b\b\bmore lines\r\nsw", "1#")
+	session := newChunkSession(t, chunks...)
+
+	output, err := session.readChannelRegexp(context.Background(), prompt, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(output, "more lines\r\nsw1#") || len(output) != 50*len(lines)+len("sw1# is in the description\r\n --More-- \b\b\b\b\b\b\b\b\bmore lines\r\nsw1#") {
+		t.Errorf("output read up to %q", output[max(0, len(output)-40):])
+	}
+	if len(session.in) != 1 || <-session.in != " " {
+		t.Error("pagination prompt not answered once")
+	}
+	if session.unhealthy {
+		t.Error("session marked unhealthy")
+	}
+}
+
+func TestReadChannelRegexpTimeout(t *testing.T) {
+	session := newChunkSession(t, "show version\r\nCisco IOS Software\r\n")
+	output, err := session.readChannelRegexp(context.Background(), regexp.MustCompile(`^sw1#$`), 50*time.Millisecond)
+	if !errors.Is(err, ErrPromptTimeout) {
+		t.Errorf("expected ErrPromptTimeout, got %v", err)
+	}
+	if output != "show version\r\nCisco IOS Software\r\n" {
+		t.Errorf("output %q", output)
+	}
+	if !session.unhealthy {
+		t.Error("session not marked unhealthy after the timeout")
+	}
+}
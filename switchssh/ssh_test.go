@@ -0,0 +1,193 @@
+package switchssh
+
+import (
+	"bufio"
+	"errors"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ciscoPrompt  = regexp.MustCompile(`^[\w\-\.]+(\([\w\-]+\))?[#>]\s*$`)
+	huaweiPrompt = regexp.MustCompile(`^[<\[][\w\-\.]+[^\r\n]*[>\]]\s*$`)
+)
+
+// Captured output of single commands, from the echo to the prompt, with the output and the failure expected
+var commandSamples = []struct {
+	name     string
+	prompt   *regexp.Regexp
+	command  string
+	received string
+	output   string
+	failed   bool
+}{
+	{
+		name:     "Cisco IOS",
+		prompt:   ciscoPrompt,
+		command:  "show clock",
+		received: "show clock\r\n*10:15:42.123 UTC Fri Oct 16 2026\r\nsw1#",
+		output:   "*10:15:42.123 UTC Fri Oct 16 2026",
+	},
+	{
+		name:     "Cisco IOS invalid input",
+		prompt:   ciscoPrompt,
+		command:  "show clok",
+		received: "show clok\r\n          ^\r\n% Invalid input detected at '^' marker.\r\n\r\nsw1#",
+		output:   "          ^\n% Invalid input detected at '^' marker.\n",
+		failed:   true,
+	},
+	{
+		name:     "Cisco IOS incomplete command",
+		prompt:   ciscoPrompt,
+		command:  "show interfaces",
+		received: "show interfaces\r\n% Incomplete command.\r\n\r\nsw1(config)#",
+		output:   "% Incomplete command.\n",
+		failed:   true,
+	},
+	{
+		name:     "Cisco IOS output mentioning an error",
+		prompt:   ciscoPrompt,
+		command:  "show logging | include Error",
+		received: "show logging | include Error\r\n*Oct 16 10:01:02: %LINK-3-UPDOWN: Error counters cleared\r\nsw1#",
+		output:   "*Oct 16 10:01:02: %LINK-3-UPDOWN: Error counters cleared",
+	},
+	{
+		name:     "Huawei VRP with terminal escapes",
+		prompt:   huaweiPrompt,
+		command:  "display clock",
+		received: "display clock\r\n\x1b[42D2026-10-16 10:15:42\r\nFriday\r\nTime Zone(UTC) : UTC\r\n<HUAWEI>",
+		output:   "2026-10-16 10:15:42\nFriday\nTime Zone(UTC) : UTC",
+	},
+	{
+		name:     "Huawei VRP unrecognized command",
+		prompt:   huaweiPrompt,
+		command:  "display clok",
+		received: "display clok\r\n                ^\r\nError: Unrecognized command found at '^' position.\r\n<HUAWEI>",
+		output:   "                ^\nError: Unrecognized command found at '^' position.",
+		failed:   true,
+	},
+	{
+		name:     "Huawei VRP wrong parameter in system view",
+		prompt:   huaweiPrompt,
+		command:  "interface GigabitEthernet0/0/99",
+		received: "interface GigabitEthernet0/0/99\r\n                                      ^\r\nError: Wrong parameter found at '^' position.\r\n[HUAWEI]",
+		output:   "                                      ^\nError: Wrong parameter found at '^' position.",
+		failed:   true,
+	},
+}
+
+func TestExecCommandOutput(t *testing.T) {
+	for _, sample := range commandSamples {
+		t.Run(sample.name, func(t *testing.T) {
+			session := newChunkSession(t, sample.received)
+			session.prompt = sample.prompt
+			result, err := session.ExecCommand(sample.command, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if <-session.in != sample.command {
+				t.Error("command not written")
+			}
+			if result.Output != sample.output {
+				t.Errorf("output %q, expected %q", result.Output, sample.output)
+			}
+			if result.Failed != sample.failed {
+				t.Errorf("failed %t, expected %t", result.Failed, sample.failed)
+			}
+			if err := result.Err(); sample.failed != errors.Is(err, ErrCommandRejected) {
+				t.Errorf("error %v", err)
+			}
+		})
+	}
+}
+
+func TestCleanCommandOutput(t *testing.T) {
+	for _, test := range []struct {
+		received string
+		command  string
+		output   string
+	}{
+		// Output before the echo (the rest of the previous prompt) is dropped
+		{"\r\nsw1#show version\r\nCisco IOS Software\r\nsw1#", "show version", "Cisco IOS Software"},
+		// Without a command only the prompt is removed
+		{"line 1\r\nline 2\r\nsw1#", "", "line 1\nline 2"},
+		{"show run\r\n\x1b[7m--More--\x1b[m \b \b \b \b \b \b \b \b \binterface Gi1/0/1\r\nsw1#", "show run", "--More--interface Gi1/0/1"},
+	} {
+		if output := cleanCommandOutput(test.received, test.command); output != test.output {
+			t.Errorf("cleanCommandOutput(%q) = %q, expected %q", test.received, output, test.output)
+		}
+	}
+}
+
+// serves a Cisco IOS shell on each session channel: "hang" prints a line and never returns to the prompt
+func serveCiscoShell(shells *atomic.Int32) func(channels <-chan ssh.NewChannel) {
+	return func(channels <-chan ssh.NewChannel) {
+		for newChannel := range channels {
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				return
+			}
+			shells.Add(1)
+			go func() {
+				for request := range requests {
+					request.Reply(true, nil)
+				}
+			}()
+			go func() {
+				defer channel.Close()
+				channel.Write([]byte("\r\nsw1#"))
+				reader := bufio.NewReader(channel)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					cmd := strings.TrimSpace(line)
+					switch cmd {
+					case "hang":
+						channel.Write([]byte(cmd + "\r\nBuilding configuration...\r\n"))
+					case "":
+						channel.Write([]byte("\r\nsw1#"))
+					default:
+						channel.Write([]byte(cmd + "\r\n*10:15:42.123 UTC Fri Oct 16 2026\r\nsw1#"))
+					}
+				}
+			}()
+		}
+	}
+}
+
+func TestRunCommandsWithBrandDiscardsUnhealthySession(t *testing.T) {
+	shells := &atomic.Int32{}
+	address := newSSHServerStandIn(t, "secret", serveCiscoShell(shells))
+	client := newTestClient(t)
+	defer client.Close()
+	client.CommandTimeout = 200 * time.Millisecond
+
+	if _, err := client.RunCommandsWithBrand("admin", "secret", address, CISCO, "hang"); !errors.Is(err, ErrPromptTimeout) {
+		t.Fatalf("expected ErrPromptTimeout, got %v", err)
+	}
+	key := Target{Address: address, Credentials: Credentials{User: "admin", Password: "secret"}}.key()
+	client.sessions.sessionCacheLocker.Lock()
+	_, cached := client.sessions.sessionCache[key]
+	client.sessions.sessionCacheLocker.Unlock()
+	if cached {
+		t.Error("session with a half-read output kept in the cache")
+	}
+
+	output, err := client.RunCommandsWithBrand("admin", "secret", address, CISCO, "show clock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "10:15:42") || strings.Contains(output, "Building configuration") {
+		t.Errorf("output %q", output)
+	}
+	if shells.Load() != 2 {
+		t.Errorf("%d shells opened, expected a new one after the timeout", shells.Load())
+	}
+}
@@ -0,0 +1,268 @@
+package switchssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Transports
+const (
+	TransportSSH    = "ssh"
+	TransportTelnet = "telnet"
+	// SSH, falling back to telnet when the SSH port refuses the connection.
+	TransportAuto = "auto"
+)
+
+// Returned when the device asks for the username or password again after the login.
+var ErrTelnetLogin = errors.New("telnet login failed")
+
+// Telnet commands and options
+const (
+	telnetIAC  = 255
+	telnetDONT = 254
+	telnetDO   = 253
+	telnetWONT = 252
+	telnetWILL = 251
+	telnetSB   = 250
+	telnetSE   = 240
+
+	telnetOptEcho = 1
+	telnetOptSGA  = 3
+)
+
+var (
+	telnetUserRegexp     = regexp.MustCompile(`(?i)(user ?name|login)\s*:\s*$`)
+	telnetPasswordRegexp = regexp.MustCompile(`(?i)password\s*:\s*$`)
+	// During the login either a login prompt or the prompt of a logged in session is expected
+	telnetLoginOrPromptRegexp = regexp.MustCompile(`(?i)((user ?name|login)\s*:|password\s*:)\s*$|` + DefaultPromptPattern)
+)
+
+/**
+ * Telnet connection answering option negotiation and stripping telnet commands from the data.
+ * Only echo and suppress-go-ahead are accepted, all other options are refused.
+ *
+ * @attr conn      Underlying TCP connection
+ * @attr buf       Data read from the connection and not processed yet
+ * @attr data      Processed data not returned by Read yet
+ * @attr answered  Negotiations already answered, to avoid negotiation loops
+ * @attr writeLock Serializes data and negotiation answers
+ * @attr client    Client used for logging
+ */
+type telnetConn struct {
+	client    *Client
+	conn      net.Conn
+	buf       []byte
+	data      []byte
+	answered  map[[2]byte]bool
+	writeLock sync.Mutex
+}
+
+func newTelnetConn(conn net.Conn, client *Client) *telnetConn {
+	return &telnetConn{client: client, conn: conn, answered: make(map[[2]byte]bool)}
+}
+
+/**
+ * Reads data from the device, telnet commands are answered and removed.
+ */
+func (this *telnetConn) Read(p []byte) (int, error) {
+	for len(this.data) == 0 {
+		chunk := make([]byte, len(p))
+		n, err := this.conn.Read(chunk)
+		if n > 0 {
+			this.buf = append(this.buf, chunk[:n]...)
+			this.data = this.process()
+		}
+		if err != nil && len(this.data) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, this.data)
+	this.data = this.data[n:]
+	return n, nil
+}
+
+/**
+ * Extracts the data from the buffer and answers the complete telnet commands in it,
+ * incomplete commands stay in the buffer until more data is read.
+ */
+func (this *telnetConn) process() []byte {
+	data := make([]byte, 0, len(this.buf))
+	i := 0
+	for i < len(this.buf) {
+		b := this.buf[i]
+		if b == 0 {
+			// NUL after CR
+			i++
+			continue
+		}
+		if b != telnetIAC {
+			data = append(data, b)
+			i++
+			continue
+		}
+		if i+1 >= len(this.buf) {
+			break
+		}
+		command := this.buf[i+1]
+		switch command {
+		case telnetIAC:
+			data = append(data, telnetIAC)
+			i += 2
+		case telnetDO, telnetDONT, telnetWILL, telnetWONT:
+			if i+2 >= len(this.buf) {
+				this.buf = this.buf[i:]
+				return data
+			}
+			this.negotiate(command, this.buf[i+2])
+			i += 3
+		case telnetSB:
+			end := bytes.Index(this.buf[i:], []byte{telnetIAC, telnetSE})
+			if end < 0 {
+				this.buf = this.buf[i:]
+				return data
+			}
+			i += end + 2
+		default:
+			i += 2
+		}
+	}
+	this.buf = this.buf[i:]
+	return data
+}
+
+/**
+ * Answers an option negotiation request.
+ */
+func (this *telnetConn) negotiate(command, option byte) {
+	key := [2]byte{command, option}
+	if this.answered[key] {
+		return
+	}
+	this.answered[key] = true
+	var answer byte
+	switch command {
+	case telnetDO:
+		answer = telnetWONT
+		if option == telnetOptSGA {
+			answer = telnetWILL
+		}
+	case telnetWILL:
+		answer = telnetDONT
+		if option == telnetOptEcho || option == telnetOptSGA {
+			answer = telnetDO
+		}
+	case telnetDONT:
+		answer = telnetWONT
+	case telnetWONT:
+		answer = telnetDONT
+	}
+	this.client.LogDebug("Telnet negotiation <%d %d> answered with %d", command, option, answer)
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+	this.conn.Write([]byte{telnetIAC, answer, option})
+}
+
+/**
+ * Writes data to the device, escaping IAC and sending line ends as CR LF.
+ */
+func (this *telnetConn) Write(p []byte) (int, error) {
+	data := bytes.ReplaceAll(p, []byte{telnetIAC}, []byte{telnetIAC, telnetIAC})
+	data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+	if _, err := this.conn.Write(data); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (this *telnetConn) Close() error {
+	return this.conn.Close()
+}
+
+/**
+ * Opens a telnet connection to the switch.
+ *
+ * @param ctx     Context of the connection
+ * @param dial    Function opening the TCP connection (direct or through a jump host)
+ * @param address Switch IP and telnet port
+ * @return        Execution errors
+ */
+func (this *SSHSession) createTelnetConnection(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), address string) error {
+	this.client.LogDebug("<Test> Begin telnet connect to %s", address)
+	conn, err := dial(ctx, "tcp", address)
+	if err != nil {
+		this.client.LogError("Telnet dial err:%s", err.Error())
+		return classifyDialError(ctx, err)
+	}
+	this.telnet = newTelnetConn(conn, this.client)
+	this.client.LogDebug("<Test> End telnet connect")
+	return nil
+}
+
+/**
+ * Answers the username and password prompts and learns the prompt shown after the login.
+ * Devices configured with a line password only ask for the password, devices without login show the prompt directly.
+ * When the device asks again, the next credentials are tried.
+ *
+ * @param ctx   Context of the login
+ * @param creds Credentials tried in order
+ * @return      ErrTelnetLogin if the device refused all credentials, other execution errors
+ */
+func (this *SSHSession) telnetLogin(ctx context.Context, creds []Credentials) error {
+	current := 0
+	sentUser, sentPassword := false, false
+	// Moves to the next credentials after the device asked again
+	refused := func() bool {
+		this.client.LogDebug("Telnet credentials %s refused", creds[current].describe())
+		current++
+		sentUser, sentPassword = false, false
+		return current < len(creds)
+	}
+	for {
+		output, err := this.readChannelRegexp(ctx, telnetLoginOrPromptRegexp, this.client.LoginTimeout)
+		if err != nil {
+			this.client.LogError("Telnet login error:%s", err.Error())
+			return err
+		}
+		line := lastLine(output)
+		if current == 0 && !sentUser && !sentPassword {
+			// The text before the first login prompt is the banner of the device
+			this.banner = strings.TrimSpace(strings.TrimSuffix(strings.Replace(output, "\r", "", -1), line))
+		}
+		switch {
+		case telnetUserRegexp.MatchString(line):
+			if (sentUser || sentPassword) && !refused() {
+				return ErrTelnetLogin
+			}
+			this.WriteChannel(creds[current].User)
+			sentUser = true
+		case telnetPasswordRegexp.MatchString(line):
+			if sentPassword && !refused() {
+				return ErrTelnetLogin
+			}
+			this.WriteChannel(creds[current].Password)
+			sentPassword = true
+		default:
+			this.credentials = creds[current]
+			return this.rememberPrompt(output)
+		}
+	}
+}
+
+/**
+ * Returns the telnet address of the host of an SSH address.
+ */
+func (this *Client) telnetAddress(ipPort string) string {
+	host, _, err := net.SplitHostPort(ipPort)
+	if err != nil {
+		host = ipPort
+	}
+	return net.JoinHostPort(host, strconv.Itoa(this.TelnetPort))
+}
@@ -0,0 +1,240 @@
+package switchssh
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Telnet server standing in for a Cisco IOS device with a local login
+type telnetStandIn struct {
+	listener net.Listener
+	user     string
+	password string
+
+	locker  sync.Mutex
+	answers [][2]byte
+	logins  []string
+}
+
+func newTelnetStandIn(t *testing.T, user, password string) *telnetStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	standIn := &telnetStandIn{listener: listener, user: user, password: password}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go standIn.serve(conn)
+		}
+	}()
+	return standIn
+}
+
+func (this *telnetStandIn) port() int {
+	return this.listener.Addr().(*net.TCPAddr).Port
+}
+
+// reads a line sent by the client, recording the negotiation answers in front of it
+func (this *telnetStandIn) readLine(reader *bufio.Reader) (string, error) {
+	line := []byte{}
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case b == telnetIAC:
+			command, _ := reader.ReadByte()
+			option, err := reader.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			this.locker.Lock()
+			this.answers = append(this.answers, [2]byte{command, option})
+			this.locker.Unlock()
+		case b == '\n':
+			return strings.TrimSuffix(string(line), "\r"), nil
+		default:
+			line = append(line, b)
+		}
+	}
+}
+
+func (this *telnetStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	// The negotiation is split over two writes, the client has to keep the incomplete command
+	conn.Write([]byte{telnetIAC, telnetDO})
+	time.Sleep(20 * time.Millisecond)
+	conn.Write([]byte{telnetOptEcho, telnetIAC, telnetWILL, telnetOptEcho, telnetIAC, telnetWILL, telnetOptSGA})
+	conn.Write([]byte("\r\nUser Access Verification\r\n\r\nUsername: "))
+	for {
+		user, err := this.readLine(reader)
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("Password: "))
+		password, err := this.readLine(reader)
+		if err != nil {
+			return
+		}
+		this.locker.Lock()
+		this.logins = append(this.logins, user+":"+password)
+		this.locker.Unlock()
+		if user == this.user && password == this.password {
+			break
+		}
+		conn.Write([]byte("\r\n% Login invalid\r\n\r\nUsername: "))
+	}
+	conn.Write([]byte("\r\nsw1>"))
+	for {
+		cmd, err := this.readLine(reader)
+		if err != nil {
+			return
+		}
+		switch cmd {
+		case "show version":
+			// IAC in the data is doubled
+			conn.Write([]byte("show version\r\nCisco IOS Software, C2960 Software, Version 15.0(2)SE11\r\nbyte \xff\xff\r\nsw1>"))
+		case "exit":
+			return
+		default:
+			conn.Write([]byte(cmd + "\r\nsw1>"))
+		}
+	}
+}
+
+// client with short timeouts, whose known_hosts file is in the temporary directory of the test
+func newTestClient(t *testing.T) *Client {
+	client := NewClient()
+	client.LogOutput = io.Discard
+	client.LoginTimeout = 2 * time.Second
+	client.CommandTimeout = 2 * time.Second
+	client.DialTimeout = 2 * time.Second
+	client.KnownHostsFile = filepath.Join(t.TempDir(), "known_hosts")
+	return client
+}
+
+func TestTelnetLogin(t *testing.T) {
+	standIn := newTelnetStandIn(t, "admin", "secret")
+	client := newTestClient(t)
+	defer client.Close()
+	target := Target{
+		Address:     fmt.Sprintf("127.0.0.1:%d", standIn.port()),
+		Credentials: Credentials{User: "admin", Password: "wrong"},
+		Fallback:    []Credentials{{User: "admin", Password: "secret"}},
+		Transport:   TransportTelnet,
+	}
+	session, err := client.NewSSHSessionContext(context.Background(), target)
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	defer session.Close()
+
+	if session.GetPrompt() != "sw1>" {
+		t.Errorf("prompt %q, expected sw1>", session.GetPrompt())
+	}
+	if session.Banner() != "User Access Verification" {
+		t.Errorf("banner %q", session.Banner())
+	}
+	if session.credentials.Password != "secret" {
+		t.Errorf("logged in with %q, expected the fallback credentials", session.credentials.Password)
+	}
+	result, err := session.ExecCommand("show version", time.Second)
+	if err != nil {
+		t.Fatalf("show version: %s", err)
+	}
+	if !strings.Contains(result.Output, "Version 15.0(2)SE11") || !strings.Contains(result.Output, "byte \xff") || strings.Contains(result.Output, "\xff\xff") {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+
+	standIn.locker.Lock()
+	defer standIn.locker.Unlock()
+	if strings.Join(standIn.logins, ",") != "admin:wrong,admin:secret" {
+		t.Errorf("logins %v", standIn.logins)
+	}
+	expected := map[[2]byte]bool{
+		{telnetWONT, telnetOptEcho}: true,
+		{telnetDO, telnetOptEcho}:   true,
+		{telnetDO, telnetOptSGA}:    true,
+	}
+	for _, answer := range standIn.answers {
+		if !expected[answer] {
+			t.Errorf("unexpected negotiation answer %v", answer)
+		}
+		delete(expected, answer)
+	}
+	for answer := range expected {
+		t.Errorf("missing negotiation answer %v", answer)
+	}
+}
+
+func TestTelnetLoginRefused(t *testing.T) {
+	standIn := newTelnetStandIn(t, "admin", "secret")
+	client := newTestClient(t)
+	defer client.Close()
+	target := Target{
+		Address:     fmt.Sprintf("127.0.0.1:%d", standIn.port()),
+		Credentials: Credentials{User: "admin", Password: "wrong"},
+		Transport:   TransportTelnet,
+	}
+	_, err := client.NewSSHSessionContext(context.Background(), target)
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("expected an AuthError, got %v", err)
+	}
+}
+
+func TestAutoTransportFallsBackToTelnet(t *testing.T) {
+	standIn := newTelnetStandIn(t, "admin", "secret")
+	// Free port without an SSH server
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	client := newTestClient(t)
+	defer client.Close()
+	client.TelnetPort = standIn.port()
+	target := Target{
+		Address:     closed.Addr().String(),
+		Credentials: Credentials{User: "admin", Password: "secret"},
+		Transport:   TransportAuto,
+	}
+	session, err := client.NewSSHSessionContext(context.Background(), target)
+	if err != nil {
+		t.Fatalf("fallback failed: %s", err)
+	}
+	defer session.Close()
+	if session.telnet == nil {
+		t.Error("expected a telnet session")
+	}
+}
+
+func TestIsConnectionRefused(t *testing.T) {
+	refusedByJumpHost := fmt.Errorf("dial: %w", &ssh.OpenChannelError{Reason: ssh.ConnectionFailed, Message: "Connection refused"})
+	if !isConnectionRefused(refusedByJumpHost) {
+		t.Error("connect failure of a jump host not recognized as refused")
+	}
+	prohibited := &ssh.OpenChannelError{Reason: ssh.Prohibited}
+	if isConnectionRefused(prohibited) {
+		t.Error("forwarding prohibited by the jump host recognized as refused")
+	}
+}